@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type DocxWord struct {
@@ -15,19 +16,40 @@ type DocxWord struct {
 	Target   string
 }
 
-//转换文档
-func (d *DocxWord) ParseDocx() error {
-	err := d.unzip()
-	if err != nil {
-		return err
+//word/embeddings里的一个文件转换失败，Err可能是eqn.ParseError、eqn.LatexError
+type FileError struct {
+	Name string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Name, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+//转换失败的所有文件，一个公式转换失败不影响其他公式
+type Errors []*FileError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
 	}
+	return strings.Join(messages, "\n")
+}
 
-	err = d.getLatex()
+//转换文档，返回转换成功的LaTeX公式
+//有公式转换失败时，其他公式照样返回，error是Errors
+func (d *DocxWord) ParseDocx() ([]string, error) {
+	err := d.unzip()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return d.getLatex()
 }
 
 //解压缩文件
@@ -79,22 +101,27 @@ func (d *DocxWord) unzip() error {
 }
 
 //转latex
-func (d *DocxWord) getLatex() error {
+func (d *DocxWord) getLatex() ([]string, error) {
 	latexDir := filepath.Join(d.Target, "word/embeddings")
-	if _, err := os.Stat(latexDir); os.IsNotExist(err) {
-		return err
-	}
-
 	dirList, err := ioutil.ReadDir(latexDir)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
+	var latexes []string
+	var errs Errors
 	for _, file := range dirList {
 		latexFile := filepath.Join(latexDir, file.Name())
-		latex := eqn.Convert(latexFile)
-		fmt.Println(latex)
+		latex, err := eqn.Convert(latexFile)
+		if err != nil {
+			errs = append(errs, &FileError{Name: file.Name(), Err: err})
+			continue
+		}
+		latexes = append(latexes, latex)
 	}
 
-	return nil
+	if len(errs) > 0 {
+		return latexes, errs
+	}
+	return latexes, nil
 }
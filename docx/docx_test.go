@@ -0,0 +1,98 @@
+package docx
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zhexiao/mtef-go/eqn"
+)
+
+//docx里面放两个公式，第二个的MTEF数据第一个record无法识别
+func testDocx(t *testing.T, dir string) string {
+	t.Helper()
+	ole, err := ioutil.ReadFile("../test/oleObject1.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := append([]byte{}, ole...)
+	idx := bytes.Index(broken, []byte("DSMT6\x00"))
+	if idx < 0 {
+		t.Fatal("no MTEF header in oleObject1.bin")
+	}
+	broken[idx+7] = 0x50
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"word/document.xml", []byte("<w:document/>")},
+		{"word/embeddings/oleObject1.bin", ole},
+		{"word/embeddings/oleObject2.bin", broken},
+	}
+
+	filename := filepath.Join(dir, "test.docx")
+	out, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	writer := zip.NewWriter(out)
+	for _, file := range files {
+		w, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(file.data)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestParseDocx(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := DocxWord{Filename: testDocx(t, dir), Target: filepath.Join(dir, "unzip")}
+	latexes, err := d.ParseDocx()
+	want := `$$ \frac { -b±\sqrt[] { b ^ { 2 } -4ac } } { 2a } $$`
+	if len(latexes) != 1 || latexes[0] != want {
+		t.Errorf("ParseDocx() = %q, want [%q]", latexes, want)
+	}
+
+	//转换失败的公式在Errors里面，可以取得ParseError
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 1 || errs[0].Name != "oleObject2.bin" {
+		t.Fatalf("ParseDocx() error = %v, want Errors for oleObject2.bin", err)
+	}
+	var parseErr *eqn.ParseError
+	if !errors.As(errs[0], &parseErr) || !errors.Is(parseErr, eqn.ErrUnknownRecord) {
+		t.Errorf("errs[0] = %v, want ParseError with %v", errs[0], eqn.ErrUnknownRecord)
+	}
+}
+
+func TestParseDocxNoEmbeddings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//没有word/embeddings目录时返回ReadDir的错误
+	d := DocxWord{Filename: filepath.Join(dir, "test.docx"), Target: filepath.Join(dir, "unzip")}
+	zipFile, _ := os.Create(d.Filename)
+	zip.NewWriter(zipFile).Close()
+	zipFile.Close()
+	if _, err := d.ParseDocx(); !os.IsNotExist(err) {
+		t.Errorf("ParseDocx() error = %v, want not exist", err)
+	}
+}
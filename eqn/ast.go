@@ -0,0 +1,466 @@
+package eqn
+
+import "fmt"
+
+//对外暴露的节点，包装内部的MtAST，不需要重新解析LaTeX就可以分析公式结构
+//
+//	Equation 整个公式（ROOT）
+//	Line     LINE，包含其他节点
+//	Char     CHAR，以及挂在上面的embellishment
+//	Template TMPL，按照slot的用途读取（Numerator、Subscript等）
+//	Pile     PILE，包含多个Line
+//	Matrix   MATRIX，rows*cols个Line
+//	Size     FULL、SUB、SUB2、SYM、SUBSYM、SIZE
+//	Color    COLOR
+//	Definition COLOR_DEF、FONT_STYLE_DEF、FONT_DEF、ENCODING_DEF、EQN_PREFS
+type Node interface {
+	Record() RecordType
+	Children() []Node
+
+	mtAST() *MtAST
+}
+
+type Equation struct{ ast *MtAST }
+type Line struct{ ast *MtAST }
+type Char struct{ ast *MtAST }
+type Template struct{ ast *MtAST }
+type Pile struct{ ast *MtAST }
+type Matrix struct{ ast *MtAST }
+type Size struct{ ast *MtAST }
+type Color struct{ ast *MtAST }
+type Definition struct{ ast *MtAST }
+
+//CHAR上的embellishment，按照从里到外的顺序
+type Embellishment struct {
+	Type   EmbellType
+	NudgeX int16
+	NudgeY int16
+}
+
+//公式最外层的节点，包括定义record和公式本身（LINE或PILE）
+func (m *MTEFv5) Objects() []Node {
+	if m.ast == nil {
+		return nil
+	}
+	return wrapNodes(m.ast.children)
+}
+
+//整个公式，Walk、Inspect、Apply从这里开始就可以访问和替换最外层的节点
+func (m *MTEFv5) Root() *Equation {
+	if m.ast == nil {
+		m.ast = &MtAST{ROOT, nil, nil}
+	}
+	return &Equation{m.ast}
+}
+
+func wrapNode(ast *MtAST) Node {
+	switch ast.tag {
+	case ROOT:
+		return &Equation{ast}
+	case LINE:
+		return &Line{ast}
+	case CHAR:
+		return &Char{ast}
+	case TMPL:
+		return &Template{ast}
+	case PILE:
+		return &Pile{ast}
+	case MATRIX:
+		return &Matrix{ast}
+	case FULL, SUB, SUB2, SYM, SUBSYM, SIZE:
+		return &Size{ast}
+	case COLOR:
+		return &Color{ast}
+	}
+	return &Definition{ast}
+}
+
+func wrapNodes(list []*MtAST) []Node {
+	nodes := make([]Node, 0, len(list))
+	for _, ast := range list {
+		nodes = append(nodes, wrapNode(ast))
+	}
+	return nodes
+}
+
+//只保留LINE
+func wrapLines(list []*MtAST) []*Line {
+	lines := make([]*Line, 0, len(list))
+	for _, ast := range list {
+		if ast.tag == LINE {
+			lines = append(lines, &Line{ast})
+		}
+	}
+	return lines
+}
+
+func (n *Equation) Record() RecordType   { return ROOT }
+func (n *Line) Record() RecordType       { return LINE }
+func (n *Char) Record() RecordType       { return CHAR }
+func (n *Template) Record() RecordType   { return TMPL }
+func (n *Pile) Record() RecordType       { return PILE }
+func (n *Matrix) Record() RecordType     { return MATRIX }
+func (n *Size) Record() RecordType       { return n.ast.tag }
+func (n *Color) Record() RecordType      { return COLOR }
+func (n *Definition) Record() RecordType { return n.ast.tag }
+
+func (n *Equation) Children() []Node   { return wrapNodes(n.ast.children) }
+func (n *Line) Children() []Node       { return wrapNodes(n.ast.children) }
+func (n *Char) Children() []Node       { return nil }
+func (n *Template) Children() []Node   { return wrapNodes(n.ast.children) }
+func (n *Pile) Children() []Node       { return wrapNodes(n.ast.children) }
+func (n *Matrix) Children() []Node     { return wrapNodes(n.ast.children) }
+func (n *Size) Children() []Node       { return nil }
+func (n *Color) Children() []Node      { return nil }
+func (n *Definition) Children() []Node { return nil }
+
+func (n *Equation) mtAST() *MtAST   { return n.ast }
+func (n *Line) mtAST() *MtAST       { return n.ast }
+func (n *Char) mtAST() *MtAST       { return n.ast }
+func (n *Template) mtAST() *MtAST   { return n.ast }
+func (n *Pile) mtAST() *MtAST       { return n.ast }
+func (n *Matrix) mtAST() *MtAST     { return n.ast }
+func (n *Size) mtAST() *MtAST       { return n.ast }
+func (n *Color) mtAST() *MtAST      { return n.ast }
+func (n *Definition) mtAST() *MtAST { return n.ast }
+
+//新建CHAR，typeface的含义和Char.Typeface()一样，可以在Apply里替换或者插入
+func NewChar(r rune, typeface int) *Char {
+	return &Char{&MtAST{CHAR, &MtChar{mtcode: uint16(r), typeface: uint8(typeface + 128)}, nil}}
+}
+
+//新建LINE，没有子节点的时候是null line
+func NewLine(nodes ...Node) *Line {
+	line := &MtAST{LINE, &MtLine{null: len(nodes) == 0, size: FULL}, nil}
+	for _, node := range nodes {
+		line.children = append(line.children, node.mtAST())
+	}
+	return &Line{line}
+}
+
+//Line
+
+func (n *Line) line() *MtLine { return n.ast.value.(*MtLine) }
+
+//null line是空的slot，没有子节点
+func (n *Line) Null() bool { return n.line().null }
+
+func (n *Line) Nudge() (int16, int16) { return n.line().nudgeX, n.line().nudgeY }
+
+//行距，0表示默认
+func (n *Line) LineSpacing() uint8 { return n.line().lineSpace }
+
+func (n *Line) TabStops() []TabStop { return n.line().ruler.TabStops() }
+
+//line开始时的字号（FULL、SUB、SUB2、SYM、SUBSYM）
+func (n *Line) Typesize() RecordType { return n.line().size }
+
+//Char
+
+func (n *Char) char() *MtChar { return n.ast.value.(*MtChar) }
+
+func (n *Char) MTCode() uint16 { return n.char().mtcode }
+
+func (n *Char) Rune() rune { return rune(n.char().mtcode) }
+
+//typeface，正数是fnTEXT到fnTEXT_FE，负数引用第n个FONT_STYLE_DEF（-1是第1个）
+func (n *Char) Typeface() int { return int(n.char().typeface) - 128 }
+
+//字体里的位置，没有的时候ok为false
+func (n *Char) FontPosition() (position uint16, ok bool) {
+	options := OptionType(n.char().options)
+	switch {
+	case MtefOptCharEncChar8 == MtefOptCharEncChar8&options:
+		return uint16(n.char().bits8), true
+	case MtefOptCharEncChar16 == MtefOptCharEncChar16&options:
+		return n.char().bits16, true
+	}
+	return 0, false
+}
+
+//是否是函数名（比如sin）的第一个字符
+func (n *Char) FunctionStart() bool {
+	return MtefOptCharFuncStart == MtefOptCharFuncStart&OptionType(n.char().options)
+}
+
+func (n *Char) Nudge() (int16, int16) { return n.char().nudgeX, n.char().nudgeY }
+
+func (n *Char) Embellishments() []Embellishment {
+	var list []Embellishment
+	for embell := n.char().embellishments; embell != nil; embell = embell.next {
+		list = append(list, Embellishment{Type: EmbellType(embell.embell), NudgeX: embell.nudgeX, NudgeY: embell.nudgeY})
+	}
+	return list
+}
+
+//Template
+
+func (n *Template) tmpl() *MtTmpl { return n.ast.value.(*MtTmpl) }
+
+func (n *Template) Selector() SelectorType { return SelectorType(n.tmpl().selector) }
+
+func (n *Template) Variation() Variation { return Variation(n.tmpl().variation) }
+
+//template的options，比如tmSUM的上下限位置
+func (n *Template) Options() uint8 { return n.tmpl().options }
+
+func (n *Template) Nudge() (int16, int16) { return n.tmpl().nudgeX, n.tmpl().nudgeY }
+
+//按顺序返回所有slot，不包括字号、颜色等record
+func (n *Template) Slots() []Node { return wrapNodes(n.ast.slots()) }
+
+//第idx个slot，不存在的时候返回nil
+func (n *Template) Slot(idx int) Node {
+	slots := n.ast.slots()
+	if idx < 0 || idx >= len(slots) {
+		return nil
+	}
+	return wrapNode(slots[idx])
+}
+
+//slot在template里的用途，按照selector决定
+//	fence、interval: main, left fence, right fence
+//	root: radicand, index
+//	fraction: numerator, denominator
+//	arrow: top, bottom
+//	integral、big operator: main, lower limit, upper limit, operator
+//	limit: main, lower limit, upper limit
+//	sub/sup: subscript, superscript
+//	dirac: left, right
+//	hat、arc等: main, accent
+func (n *Template) slotFor(idx int, selectors ...SelectorType) Node {
+	for _, selector := range selectors {
+		if n.Selector() == selector {
+			return n.Slot(idx)
+		}
+	}
+	return nil
+}
+
+var (
+	fenceSelectors  = []SelectorType{tmANGLE, tmPAREN, tmBRACE, tmBRACK, tmBAR, tmDBAR, tmFLOOR, tmCEILING, tmOBRACK, tmINTERVAL}
+	bigOpSelectors  = []SelectorType{tmINTEG, tmSUM, tmPROD, tmCOPROD, tmUNION, tmINTER, tmINTOP, tmSUMOP}
+	limitSelectors  = append(append([]SelectorType{}, bigOpSelectors...), tmLIM)
+	scriptSelectors = []SelectorType{tmSUB, tmSUP, tmSUBSUP}
+	accentSelectors = []SelectorType{tmVEC, tmTILDE, tmHAT, tmARC, tmJSTATUS}
+	noMainSelectors = []SelectorType{tmFRACT, tmARROW, tmSUB, tmSUP, tmSUBSUP, tmDIRAC}
+	hfenceSelectors = []SelectorType{tmHBRACE, tmHBRACK}
+)
+
+//主要的slot，fraction、arrow、上下标、dirac没有
+func (n *Template) Main() Node {
+	for _, selector := range noMainSelectors {
+		if n.Selector() == selector {
+			return nil
+		}
+	}
+	return n.Slot(0)
+}
+
+func (n *Template) Numerator() Node   { return n.slotFor(0, tmFRACT) }
+func (n *Template) Denominator() Node { return n.slotFor(1, tmFRACT) }
+func (n *Template) Radicand() Node    { return n.slotFor(0, tmROOT) }
+
+//nth root的次数，square root的时候是null line
+func (n *Template) RootIndex() Node { return n.slotFor(1, tmROOT) }
+
+func (n *Template) LeftFence() Node  { return n.slotFor(1, fenceSelectors...) }
+func (n *Template) RightFence() Node { return n.slotFor(2, fenceSelectors...) }
+func (n *Template) Top() Node        { return n.slotFor(0, tmARROW) }
+func (n *Template) Bottom() Node     { return n.slotFor(1, tmARROW) }
+func (n *Template) LowerLimit() Node { return n.slotFor(1, limitSelectors...) }
+func (n *Template) UpperLimit() Node { return n.slotFor(2, limitSelectors...) }
+
+//big operator的符号（CHAR）
+func (n *Template) Operator() Node    { return n.slotFor(3, bigOpSelectors...) }
+func (n *Template) Subscript() Node   { return n.slotFor(0, scriptSelectors...) }
+func (n *Template) Superscript() Node { return n.slotFor(1, scriptSelectors...) }
+func (n *Template) Bra() Node         { return n.slotFor(0, tmDIRAC) }
+func (n *Template) Ket() Node         { return n.slotFor(1, tmDIRAC) }
+
+//hat、arc、tilde等放在main上面的符号（CHAR）
+func (n *Template) Accent() Node { return n.slotFor(1, accentSelectors...) }
+
+//horizontal brace/bracket的标注
+func (n *Template) Label() Node { return n.slotFor(1, hfenceSelectors...) }
+
+//Pile
+
+func (n *Pile) pile() *MtPile { return n.ast.value.(*MtPile) }
+
+func (n *Pile) HAlign() uint8         { return n.pile().halign }
+func (n *Pile) VAlign() uint8         { return n.pile().valign }
+func (n *Pile) Nudge() (int16, int16) { return n.pile().nudgeX, n.pile().nudgeY }
+func (n *Pile) TabStops() []TabStop   { return n.pile().ruler.TabStops() }
+func (n *Pile) Lines() []*Line        { return wrapLines(n.ast.children) }
+
+//Matrix
+
+func (n *Matrix) matrix() *MtMatrix { return n.ast.value.(*MtMatrix) }
+
+func (n *Matrix) Rows() int             { return int(n.matrix().rows) }
+func (n *Matrix) Cols() int             { return int(n.matrix().cols) }
+func (n *Matrix) VAlign() uint8         { return n.matrix().valign }
+func (n *Matrix) HJust() uint8          { return n.matrix().h_just }
+func (n *Matrix) VJust() uint8          { return n.matrix().v_just }
+func (n *Matrix) Nudge() (int16, int16) { return n.matrix().nudgeX, n.matrix().nudgeY }
+
+//按行的顺序返回所有单元格
+func (n *Matrix) Cells() []*Line { return wrapLines(n.ast.children) }
+
+//第row行第col列的单元格，从0开始，不存在的时候返回nil
+func (n *Matrix) Cell(row int, col int) *Line {
+	cells := n.Cells()
+	idx := row*n.Cols() + col
+	if row < 0 || col < 0 || col >= n.Cols() || idx >= len(cells) {
+		return nil
+	}
+	return cells[idx]
+}
+
+//行之间的分隔线（rows+1条，包括上下边框），0 没有，1 实线，2 虚线，3 点线
+func (n *Matrix) RowPartitions() []uint8 { return partitions(n.matrix().rowParts, n.Rows()+1) }
+
+//列之间的分隔线（cols+1条，包括左右边框）
+func (n *Matrix) ColPartitions() []uint8 { return partitions(n.matrix().colParts, n.Cols()+1) }
+
+func partitions(parts []byte, count int) []uint8 {
+	list := make([]uint8, 0, count)
+	for i := 0; i < count && i/4 < len(parts); i++ {
+		list = append(list, (parts[i/4]>>(uint(i%4)*2))&0x03)
+	}
+	return list
+}
+
+//Size
+
+//对应的字号，SIZE是用户自定义字号或者直接指定字号的时候ok为false
+func (n *Size) Typesize() (RecordType, bool) { return n.ast.typesize() }
+
+//SIZE record的lsize和dsize，其他字号record返回0
+func (n *Size) LSize() uint8 {
+	if size, ok := n.ast.value.(*MtSize); ok {
+		return size.lsize
+	}
+	return 0
+}
+
+func (n *Size) DSize() int16 {
+	if size, ok := n.ast.value.(*MtSize); ok {
+		return size.dsize
+	}
+	return 0
+}
+
+//Color
+
+//COLOR_DEF的编号，从0开始
+func (n *Color) Index() uint8 { return n.ast.value.(*MtColorDefIndex).index }
+
+//Variation
+
+//template的variation，按位组合
+type Variation uint16
+
+func (v Variation) Has(flag Variation) bool { return v&flag == flag }
+
+const (
+	VariationFenceLeft     = Variation(tvFENCE_L)
+	VariationFenceRight    = Variation(tvFENCE_R)
+	VariationRootNth       = Variation(tvROOT_NTH)
+	VariationFractionSmall = Variation(tvFR_SMALL)
+	VariationFractionSlash = Variation(tvFR_SLASH)
+	VariationFractionBase  = Variation(tvFR_BASE)
+	VariationBarDouble     = Variation(tvBAR_DOUBLE)
+	VariationArrowDouble   = Variation(tvAR_DOUBLE)
+	VariationArrowTop      = Variation(tvAR_TOP)
+	VariationArrowBottom   = Variation(tvAR_BOTTOM)
+	VariationArrowLeft     = Variation(tvAR_LEFT)
+	VariationArrowRight    = Variation(tvAR_RIGHT)
+	VariationIntegralLoop  = Variation(tvINT_LOOP)
+	VariationLowerLimit    = Variation(tvBO_LOWER)
+	VariationUpperLimit    = Variation(tvBO_UPPER)
+	VariationSumStyle      = Variation(tvBO_SUM)
+	VariationHBraceTop     = Variation(tvHB_TOP)
+	VariationLDivUpper     = Variation(tvLD_UPPER)
+	VariationScriptBefore  = Variation(tvSU_PRECEDES)
+	VariationDiracLeft     = Variation(tvDI_LEFT)
+	VariationDiracRight    = Variation(tvDI_RIGHT)
+)
+
+//Selector
+
+const (
+	SelectorAngle        = tmANGLE
+	SelectorParen        = tmPAREN
+	SelectorBrace        = tmBRACE
+	SelectorBracket      = tmBRACK
+	SelectorBar          = tmBAR
+	SelectorDoubleBar    = tmDBAR
+	SelectorFloor        = tmFLOOR
+	SelectorCeiling      = tmCEILING
+	SelectorOpenBracket  = tmOBRACK
+	SelectorInterval     = tmINTERVAL
+	SelectorRoot         = tmROOT
+	SelectorFraction     = tmFRACT
+	SelectorUnderbar     = tmUBAR
+	SelectorOverbar      = tmOBAR
+	SelectorArrow        = tmARROW
+	SelectorIntegral     = tmINTEG
+	SelectorSum          = tmSUM
+	SelectorProduct      = tmPROD
+	SelectorCoproduct    = tmCOPROD
+	SelectorUnion        = tmUNION
+	SelectorIntersection = tmINTER
+	SelectorIntegralOp   = tmINTOP
+	SelectorSumOp        = tmSUMOP
+	SelectorLimit        = tmLIM
+	SelectorHBrace       = tmHBRACE
+	SelectorHBracket     = tmHBRACK
+	SelectorLongDivision = tmLDIV
+	SelectorSub          = tmSUB
+	SelectorSup          = tmSUP
+	SelectorSubSup       = tmSUBSUP
+	SelectorDirac        = tmDIRAC
+	SelectorVector       = tmVEC
+	SelectorTilde        = tmTILDE
+	SelectorHat          = tmHAT
+	SelectorArc          = tmARC
+	SelectorJointStatus  = tmJSTATUS
+	SelectorStrike       = tmSTRIKE
+	SelectorBox          = tmBOX
+)
+
+var selectorNames = []string{
+	"angle", "paren", "brace", "bracket", "bar", "dbar", "floor", "ceiling", "obracket", "interval",
+	"root", "fraction", "ubar", "obar", "arrow", "integral", "sum", "product", "coproduct", "union",
+	"intersection", "intop", "sumop", "limit", "hbrace", "hbracket", "ldiv", "sub", "sup", "subsup",
+	"dirac", "vector", "tilde", "hat", "arc", "jstatus", "strike", "box",
+}
+
+func (s SelectorType) String() string {
+	if int(s) < len(selectorNames) {
+		return selectorNames[s]
+	}
+	return fmt.Sprintf("SelectorType(%d)", uint8(s))
+}
+
+//Embellishment
+
+var embellNames = map[EmbellType]string{
+	emb1DOT: "dot", emb2DOT: "ddot", emb3DOT: "dddot", emb4DOT: "ddddot",
+	emb1PRIME: "prime", emb2PRIME: "dprime", emb3PRIME: "tprime", embBPRIME: "bprime",
+	embTILDE: "tilde", embHAT: "hat", embNOT: "not", embMBAR: "mbar", embOBAR: "obar",
+	embRARROW: "rarrow", embLARROW: "larrow", embBARROW: "barrow", embR1ARROW: "r1arrow", embL1ARROW: "l1arrow",
+	embFROWN: "frown", embSMILE: "smile", embX_BARS: "xbars", embUP_BAR: "upbar", embDOWN_BAR: "downbar",
+	embU_1DOT: "udot", embU_2DOT: "uddot", embU_3DOT: "udddot", embU_4DOT: "uddddot",
+	embU_BAR: "ubar", embU_TILDE: "utilde", embU_FROWN: "ufrown", embU_SMILE: "usmile",
+	embU_RARROW: "urarrow", embU_LARROW: "ularrow", embU_BARROW: "ubarrow", embU_R1ARROW: "ur1arrow", embU_L1ARROW: "ul1arrow",
+}
+
+func (e EmbellType) String() string {
+	if name, ok := embellNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("EmbellType(%d)", uint8(e))
+}
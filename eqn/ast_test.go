@@ -0,0 +1,133 @@
+package eqn
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+//oleObject1.bin：(-b±√(b²-4ac))/2a
+func TestTemplateSlots(t *testing.T) {
+	objects := openFixture(t, "oleObject1.bin").Objects()
+	line := objects[len(objects)-1].(*Line)
+	if line.Null() || line.Typesize() != FULL {
+		t.Errorf("LINE null %v, typesize %v", line.Null(), line.Typesize())
+	}
+
+	fraction := line.Children()[0].(*Template)
+	if fraction.Selector() != SelectorFraction || fraction.Variation() != 0 {
+		t.Fatalf("TMPL %v variation %#x, want fraction", fraction.Selector(), uint16(fraction.Variation()))
+	}
+	if fraction.Main() != nil || fraction.Radicand() != nil || fraction.Subscript() != nil {
+		t.Errorf("fraction has main, radicand or subscript slot")
+	}
+	numerator := fraction.Numerator().(*Line)
+	if records := recordsOf(numerator.Children()); !reflect.DeepEqual(records, []RecordType{CHAR, CHAR, CHAR, TMPL}) {
+		t.Fatalf("numerator = %v", records)
+	}
+	if denominator := fraction.Denominator().(*Line); len(denominator.Children()) != 2 {
+		t.Errorf("denominator has %d children, want 2", len(denominator.Children()))
+	}
+	if slot := fraction.Slot(2); slot != nil {
+		t.Errorf("Slot(2) = %v, want nil", slot)
+	}
+
+	minus := numerator.Children()[0].(*Char)
+	if minus.Rune() != '−' || minus.MTCode() != 0x2212 || minus.Typeface() != int(fnSYMBOL) {
+		t.Errorf("CHAR %q %#x typeface %d, want minus sign", minus.Rune(), minus.MTCode(), minus.Typeface())
+	}
+
+	root := numerator.Children()[3].(*Template)
+	if root.Selector() != SelectorRoot || root.Variation().Has(VariationRootNth) {
+		t.Errorf("TMPL %v variation %#x, want square root", root.Selector(), uint16(root.Variation()))
+	}
+	if index := root.RootIndex().(*Line); !index.Null() {
+		t.Errorf("square root index is not a null line")
+	}
+	radicand := root.Radicand().(*Line)
+	if root.Main().(*Line).ast != radicand.ast {
+		t.Errorf("Main() and Radicand() differ")
+	}
+	//上标跟在b后面
+	sup := radicand.Children()[1].(*Template)
+	if sup.Selector() != SelectorSup || !sup.Subscript().(*Line).Null() {
+		t.Errorf("TMPL %v, want superscript with null subscript", sup.Selector())
+	}
+	if two := sup.Superscript().(*Line).Children()[0].(*Char); two.Rune() != '2' || two.Typeface() != int(fnNUMBER) {
+		t.Errorf("superscript %q typeface %d, want 2", two.Rune(), two.Typeface())
+	}
+}
+
+func TestCharOptions(t *testing.T) {
+	//函数名开头，带8位的字体位置和nudge
+	data := mtefData([]byte{1, 0}, []byte{2, 0x0E, 133, 121, 0x82, 's', 0, 0x73}, testChar, []byte{0, 0})
+	eqn, err := OpenMTEF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chars := eqn.Objects()[0].Children()
+	s, x := chars[0].(*Char), chars[1].(*Char)
+	if position, ok := s.FontPosition(); !ok || position != 0x73 || !s.FunctionStart() || s.Typeface() != int(fnFUNCTION) {
+		t.Errorf("CHAR s: font position %#x %v, function start %v, typeface %d", position, ok, s.FunctionStart(), s.Typeface())
+	}
+	if nudgeX, nudgeY := s.Nudge(); nudgeX != 5 || nudgeY != -7 {
+		t.Errorf("CHAR s nudge (%d, %d), want (5, -7)", nudgeX, nudgeY)
+	}
+	if _, ok := x.FontPosition(); ok || x.FunctionStart() || x.Embellishments() != nil {
+		t.Errorf("CHAR x has font position, function start or embellishments")
+	}
+}
+
+func TestMatrixCells(t *testing.T) {
+	//2x2，行分隔线：无、实线、虚线；列分隔线：无、点线、无
+	data := mtefData([]byte{1, 0, 5, 0, 1, 1, 1, 2, 2, 0x24, 0x0C},
+		[]byte{1, 0}, testChar, []byte{0},
+		[]byte{1, 1}, []byte{1, 1},
+		[]byte{1, 0}, []byte{2, 0, 0x88, '1', 0}, []byte{0},
+		[]byte{0, 0, 0},
+	)
+	eqn, err := OpenMTEF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	matrix := eqn.Objects()[0].Children()[0].(*Matrix)
+	if matrix.Rows() != 2 || matrix.Cols() != 2 || len(matrix.Cells()) != 4 {
+		t.Fatalf("matrix %dx%d with %d cells, want 2x2", matrix.Rows(), matrix.Cols(), len(matrix.Cells()))
+	}
+	if rows := matrix.RowPartitions(); !reflect.DeepEqual(rows, []uint8{0, 1, 2}) {
+		t.Errorf("RowPartitions() = %v, want [0 1 2]", rows)
+	}
+	if cols := matrix.ColPartitions(); !reflect.DeepEqual(cols, []uint8{0, 3, 0}) {
+		t.Errorf("ColPartitions() = %v, want [0 3 0]", cols)
+	}
+	if cell := matrix.Cell(1, 1); cell == nil || cell.Children()[0].(*Char).Rune() != '1' {
+		t.Errorf("Cell(1, 1) = %v, want 1", cell)
+	}
+	if !matrix.Cell(0, 1).Null() || !matrix.Cell(1, 0).Null() {
+		t.Errorf("Cell(0, 1) and Cell(1, 0) are not null lines")
+	}
+	for _, cell := range [][2]int{{-1, 0}, {0, 2}, {2, 0}} {
+		if line := matrix.Cell(cell[0], cell[1]); line != nil {
+			t.Errorf("Cell(%d, %d) = %v, want nil", cell[0], cell[1], line)
+		}
+	}
+}
+
+func TestTypeNames(t *testing.T) {
+	names := []struct {
+		value interface{ String() string }
+		want  string
+	}{
+		{SelectorFraction, "fraction"},
+		{SelectorType(200), "SelectorType(200)"},
+		{EmbellType(embHAT), "hat"},
+		{EmbellType(200), "EmbellType(200)"},
+		{TabStopDecimal, "decimal"},
+		{FONT_STYLE_DEF, "FONT_STYLE_DEF"},
+	}
+	for _, test := range names {
+		if name := test.value.String(); name != test.want {
+			t.Errorf("String() = %q, want %q", name, test.want)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package eqn
+
+//ParseLatex和OpenMathML共用的生成公式树的函数，节点的结构和MathType保存的一样：
+//	上下标、极限、根号的次数前面是SUB（或者SUB2）record，大型运算符的符号前面是SYM（或者SUBSYM）
+//	fence template的slot是main、左边的定界符、右边的定界符
+
+//PILE和MATRIX的对齐方式
+const (
+	alignLeft       uint8 = 1
+	alignCenter     uint8 = 2
+	alignRight      uint8 = 3
+	alignRelational uint8 = 4
+)
+
+//成对的定界符对应的template
+var fenceTemplates = []struct {
+	left, right uint16
+	selector    SelectorType
+}{
+	{'(', ')', tmPAREN},
+	{'[', ']', tmBRACK},
+	{'{', '}', tmBRACE},
+	{'|', '|', tmBAR},
+	{0x2016, 0x2016, tmDBAR},
+	{0x2329, 0x232a, tmANGLE},
+	{0x230a, 0x230b, tmFLOOR},
+	{0x2308, 0x2309, tmCEILING},
+	{0x27e6, 0x27e7, tmOBRACK},
+}
+
+//不成对的圆括号和方括号（tmINTERVAL），右边的variation左移4位
+var intervalVariations = map[uint16]uint16{
+	'(': tvINTV_LEFT_LP,
+	')': tvINTV_LEFT_RP,
+	'[': tvINTV_LEFT_LB,
+	']': tvINTV_LEFT_RB,
+}
+
+//大型运算符的符号对应的template，limits为true的时候上下限在符号的上下方（tvBO_SUM）
+var bigOperators = map[uint16]struct {
+	selector  SelectorType
+	variation uint16
+	limits    bool
+}{
+	0x2211: {tmSUM, 0, true},
+	0x220f: {tmPROD, 0, true},
+	0x2210: {tmCOPROD, 0, true},
+	0x22c3: {tmUNION, 0, true},
+	0x22c2: {tmINTER, 0, true},
+	0x222b: {tmINTEG, tvINT_1, false},
+	0x222c: {tmINTEG, tvINT_2, false},
+	0x222d: {tmINTEG, tvINT_3, false},
+	0x222e: {tmINTEG, tvINT_1 | tvINT_LOOP, false},
+}
+
+//关系符号，大型运算符的main slot到这里结束
+var relationCodes = map[uint16]bool{
+	'=': true, '<': true, '>': true,
+	0x2192: true, 0x21d2: true, 0x21d4: true, 0x2208: true, 0x221d: true, 0x223c: true,
+	0x2243: true, 0x2245: true, 0x2248: true, 0x2260: true, 0x2261: true, 0x2264: true, 0x2265: true,
+}
+
+//按照MathType的默认样式选择typeface
+func defaultTypeface(code uint16) uint8 {
+	switch {
+	case code >= 'a' && code <= 'z', code >= 'A' && code <= 'Z':
+		return fnVARIABLE
+	case code >= '0' && code <= '9':
+		return fnNUMBER
+	case code >= 0x0391 && code <= 0x03a9:
+		return fnUCGREEK
+	case code >= 0x03b1 && code <= 0x03c9, code == 0x03d1, code == 0x03d5, code == 0x03d6, code == 0x03f5:
+		return fnLCGREEK
+	case code&0xff00 == 0xef00:
+		return fnSPACE
+	case code >= 0xe000 && code <= 0xf8ff:
+		return fnMTEXTRA
+	}
+	return fnSYMBOL
+}
+
+func charNode(code uint16, typeface uint8) *MtAST {
+	return &MtAST{CHAR, &MtChar{typeface: typeface + 128, mtcode: code}, nil}
+}
+
+func tmplNode(selector SelectorType, variation uint16, children ...*MtAST) *MtAST {
+	return &MtAST{TMPL, &MtTmpl{selector: uint8(selector), variation: variation}, children}
+}
+
+//函数名，第一个字符标记function start
+func functionNodes(name string) []*MtAST {
+	var nodes []*MtAST
+	for _, r := range name {
+		nodes = append(nodes, charNode(uint16(r), fnFUNCTION))
+	}
+	nodes[0].value.(*MtChar).options = uint8(MtefOptCharFuncStart)
+	return nodes
+}
+
+//embellishment加在最后，prime重复的时候合并成dprime、tprime
+func addEmbell(char *MtChar, embell EmbellType) {
+	last := char.embellishments
+	for last != nil && last.next != nil {
+		last = last.next
+	}
+
+	if embell == emb1PRIME && last != nil {
+		switch EmbellType(last.embell) {
+		case emb1PRIME:
+			last.embell = uint8(emb2PRIME)
+			return
+		case emb2PRIME:
+			last.embell = uint8(emb3PRIME)
+			return
+		}
+	}
+
+	node := &MtEmbell{embell: uint8(embell)}
+	if last == nil {
+		char.embellishments = node
+	} else {
+		last.next = node
+	}
+}
+
+//把CHAR的typeface从from换成to，粗体、正体使用
+func retypeface(ast *MtAST, from uint8, to uint8) {
+	if char, ok := ast.value.(*MtChar); ok && char.typeface == from+128 {
+		char.typeface = to + 128
+	}
+	for _, child := range ast.children {
+		retypeface(child, from, to)
+	}
+}
+
+//上下标、极限的字号
+func smallerSize(size RecordType) RecordType {
+	if size == FULL || size == SYM {
+		return SUB
+	}
+	return SUB2
+}
+
+//没有子节点的是null line
+func finishLine(line *MtAST) *MtAST {
+	line.value.(*MtLine).null = len(line.children) == 0
+	return line
+}
+
+//定界符和main组成fence template，没有对应template的（比如只有右边的|）直接输出定界符，
+//定界符为0表示没有
+func fenceNodes(main *MtAST, left uint16, right uint16) []*MtAST {
+	fence := func(code uint16) *MtAST {
+		return charNode(code, fnSYMBOL)
+	}
+
+	for _, f := range fenceTemplates {
+		if f.left == left && f.right == right {
+			return []*MtAST{tmplNode(f.selector, tvFENCE_L|tvFENCE_R, main, fence(left), fence(right))}
+		}
+	}
+
+	//分段函数只有左边的大括号
+	if left == '{' && right == 0 {
+		return []*MtAST{tmplNode(tmBRACE, tvFENCE_L, main, fence(left))}
+	}
+
+	leftVariation, leftOk := intervalVariations[left]
+	rightVariation, rightOk := intervalVariations[right]
+	if leftOk && rightOk {
+		return []*MtAST{tmplNode(tmINTERVAL, leftVariation|rightVariation<<4, main, fence(left), fence(right))}
+	}
+
+	var nodes []*MtAST
+	if left != 0 {
+		nodes = append(nodes, fence(left))
+	}
+	nodes = append(nodes, main.children...)
+	if right != 0 {
+		nodes = append(nodes, fence(right))
+	}
+	return nodes
+}
+
+//记录当前的字号，新建的LINE和slot按字号设置
+type treeBuilder struct {
+	size RecordType
+}
+
+func (b *treeBuilder) newLine() *MtAST {
+	return &MtAST{LINE, &MtLine{size: b.size}, nil}
+}
+
+//在小一号的字里执行f，上下标、极限使用
+func (b *treeBuilder) smaller(f func() error) error {
+	size := b.size
+	b.size = smallerSize(size)
+	defer func() { b.size = size }()
+	return f()
+}
+
+//上下标和上下限的slot，前面是SUB（或者SUB2）record，nil是null line
+func (b *treeBuilder) scriptSlots(lines ...*MtAST) []*MtAST {
+	size := smallerSize(b.size)
+	slots := []*MtAST{{size, nil, nil}}
+	for _, line := range lines {
+		if line == nil {
+			line = &MtAST{LINE, &MtLine{size: size, null: true}, nil}
+		}
+		slots = append(slots, line)
+	}
+	return slots
+}
+
+//上下标template，base已经在前面的LINE里
+func (b *treeBuilder) script(sub *MtAST, sup *MtAST) *MtAST {
+	selector := tmSUBSUP
+	switch {
+	case sup == nil:
+		selector = tmSUB
+	case sub == nil:
+		selector = tmSUP
+	}
+	return tmplNode(selector, 0, b.scriptSlots(sub, sup)...)
+}
+
+//大型运算符的slot：main、下限、上限、运算符，多重积分是重复的积分号
+func (b *treeBuilder) bigOp(code uint16, variation uint16, main *MtAST, lower *MtAST, upper *MtAST) *MtAST {
+	op := bigOperators[code]
+	variation |= op.variation
+	if lower != nil {
+		variation |= tvBO_LOWER
+	}
+	if upper != nil {
+		variation |= tvBO_UPPER
+	}
+
+	children := append([]*MtAST{finishLine(main)}, b.scriptSlots(lower, upper)...)
+	if b.size == FULL {
+		children = append(children, &MtAST{SYM, nil, nil})
+	} else {
+		children = append(children, &MtAST{SUBSYM, nil, nil})
+	}
+
+	count := 1
+	if op.selector == tmINTEG {
+		code, count = 0x222b, int(op.variation&tvINT_3)
+		if op.variation&tvINT_LOOP != 0 {
+			code = 0x222e
+		}
+	}
+	for i := 0; i < count; i++ {
+		children = append(children, charNode(code, fnSYMBOL))
+	}
+	return tmplNode(op.selector, variation, children...)
+}
+
+//\lim、\max这样下面有极限的函数，slot是函数名、下限、上限
+func (b *treeBuilder) limit(main []*MtAST, lower *MtAST, upper *MtAST) *MtAST {
+	variation := uint16(0)
+	if lower != nil {
+		variation |= tvBO_LOWER
+	}
+	if upper != nil {
+		variation |= tvBO_UPPER
+	}
+
+	line := finishLine(&MtAST{LINE, &MtLine{size: b.size}, main})
+	return tmplNode(tmLIM, variation, append([]*MtAST{line}, b.scriptSlots(lower, upper)...)...)
+}
+
+//每行一个LINE，同一行的单元格连在一起
+func (b *treeBuilder) pile(rows [][]*MtAST, halign uint8) *MtAST {
+	pile := &MtAST{PILE, &MtPile{halign: halign, valign: 1}, nil}
+	for _, row := range rows {
+		line := b.newLine()
+		for _, cell := range row {
+			line.children = append(line.children, cell.children...)
+		}
+		pile.children = append(pile.children, finishLine(line))
+	}
+	return pile
+}
+
+//单元格按行排列，不够的用null line补齐，rowParts、colParts是分隔线（包括边框），
+//行或列超过255时ok为false
+func (b *treeBuilder) matrix(rows [][]*MtAST, halign uint8, rowParts []int, colParts []int) (matrix *MtAST, ok bool) {
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	if len(rows) > 0xff || cols > 0xff {
+		return nil, false
+	}
+
+	matrix = &MtAST{MATRIX, &MtMatrix{
+		valign:   1,
+		h_just:   halign,
+		v_just:   1,
+		rows:     uint8(len(rows)),
+		cols:     uint8(cols),
+		rowParts: packPartitions(rowParts, len(rows)+1),
+		colParts: packPartitions(colParts, cols+1),
+	}, nil}
+	for _, row := range rows {
+		matrix.children = append(matrix.children, row...)
+		for i := len(row); i < cols; i++ {
+			matrix.children = append(matrix.children, finishLine(b.newLine()))
+		}
+	}
+	return matrix, true
+}
@@ -2,22 +2,45 @@ package eqn
 
 import (
 	"bytes"
-	"fmt"
 	"io/ioutil"
+	"strings"
 )
 
-func Convert(filepath string) string {
-	buffer, err := ioutil.ReadFile(filepath)
+//读取文件并转换成LaTeX，解析出错时返回的error可能是*ParseError
+func Convert(filepath string) (string, error) {
+	mtef, err := OpenFile(filepath)
 	if err != nil {
-		fmt.Print(err)
+		return "", err
 	}
 
-	reader := bytes.NewReader(buffer)
-	mtef, err := Open(reader)
+	return mtef.Translate()
+}
+
+//按扩展名读取OLE对象、WMF/EMF预览图、MathType导出的图片、JSON、LaTeX（.tex）或者MathML（.mml）
+func OpenFile(filepath string) (mtef *MTEFv5, err error) {
+	buffer, err := ioutil.ReadFile(filepath)
 	if err != nil {
-		fmt.Println(err)
+		return nil, err
 	}
 
-	latex := mtef.Translate()
-	return latex
+	reader := bytes.NewReader(buffer)
+
+	//WMF/EMF预览图和MathType导出的图片里面也保存了MTEF数据
+	switch strings.ToLower(filepath[strings.LastIndex(filepath, ".")+1:]) {
+	case "wmf", "emf":
+		mtef, err = OpenMetafile(reader)
+	case "gif", "png", "eps", "svg":
+		mtef, err = OpenImage(reader)
+	case "json":
+		//MarshalJSON输出的JSON
+		mtef = new(MTEFv5)
+		err = mtef.UnmarshalJSON(buffer)
+	case "tex":
+		mtef, err = ParseLatex(string(buffer))
+	case "mml", "mathml":
+		mtef, err = OpenMathML(reader)
+	default:
+		mtef, err = Open(reader)
+	}
+	return mtef, err
 }
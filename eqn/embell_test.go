@@ -0,0 +1,78 @@
+package eqn
+
+import (
+	"strings"
+	"testing"
+)
+
+//按顺序挂上embellishment的x
+func embellishedChar(embells ...EmbellType) *Char {
+	char := NewChar('x', int(fnVARIABLE))
+	var last *MtEmbell
+	for _, embellType := range embells {
+		embell := &MtEmbell{embell: uint8(embellType)}
+		if last == nil {
+			char.char().embellishments = embell
+		} else {
+			last.next = embell
+		}
+		last = embell
+	}
+	return char
+}
+
+var embellTests = []struct {
+	embells []EmbellType
+	latex   string
+	mathml  string
+	omml    string
+}{
+	{
+		[]EmbellType{emb1PRIME, embHAT},
+		`\hat{ x }'`,
+		`<msup><mover accent="true"><mi>x</mi><mo>ˆ</mo></mover><mo>′</mo></msup>`,
+		"<m:sSup><m:e><m:acc><m:accPr><m:chr m:val=\"\u0302\"/></m:accPr><m:e>",
+	},
+	{
+		[]EmbellType{emb1DOT, embOBAR},
+		`\bar{ \dot{ x } }`,
+		`<mover accent="true"><mover accent="true"><mi>x</mi><mo>˙</mo></mover><mo>¯</mo></mover>`,
+		"<m:acc><m:accPr><m:chr m:val=\"\u0305\"/></m:accPr><m:e><m:acc><m:accPr><m:chr m:val=\"\u0307\"/></m:accPr>",
+	},
+	{
+		[]EmbellType{embHAT, emb2PRIME, embU_TILDE},
+		`\underset{ \sim }{ \hat{ x } }''`,
+		`<msup><munder accentunder="true"><mover accent="true"><mi>x</mi><mo>ˆ</mo></mover><mo>˜</mo></munder><mo>″</mo></msup>`,
+		`<m:sSup><m:e><m:groupChr>`,
+	},
+}
+
+func TestEmbellishmentOrder(t *testing.T) {
+	for _, test := range embellTests {
+		m := New(NewLine(embellishedChar(test.embells...)))
+
+		latex, err := m.Translate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(latex, test.latex) {
+			t.Errorf("%v: latex %q does not contain %q", test.embells, latex, test.latex)
+		}
+
+		mathml, err := m.TranslateMathML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(mathml, test.mathml) {
+			t.Errorf("%v: mathml %q does not contain %q", test.embells, mathml, test.mathml)
+		}
+
+		omml, err := m.TranslateOMML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(omml, test.omml) {
+			t.Errorf("%v: omml %q does not contain %q", test.embells, omml, test.omml)
+		}
+	}
+}
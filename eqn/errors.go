@@ -0,0 +1,80 @@
+package eqn
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	//遇到无法识别的record，后面的数据没办法继续解析
+	ErrUnknownRecord = errors.New("unknown record")
+	//record出现在不允许的位置，比如PILE里面直接是CHAR，或者object list没有END就结束了
+	ErrUnexpectedRecord = errors.New("unexpected record")
+	//TMPL的slot、MATRIX的单元格、PILE的LINE个数不对
+	ErrObjectCount = errors.New("wrong number of objects")
+	//MTEF版本不是3、4、5
+	ErrUnsupportedVersion = errors.New("unsupported MTEF version")
+	//OLE对象里面没有"Equation Native"
+	ErrNoEquationNative = errors.New(`no "Equation Native" stream`)
+	//公式里有还没实现转换的TMPL/EMBELL
+	ErrNotImplemented = errors.New("not implemented")
+	//LaTeX的语法错误，比如括号不匹配、缺少参数
+	ErrLatexSyntax = errors.New("invalid LaTeX")
+	//LaTeX里有不支持的命令或者环境
+	ErrUnknownCommand = errors.New("unknown LaTeX command")
+	//MathML的结构错误，比如mfrac的子节点不是2个
+	ErrInvalidMathML = errors.New("invalid MathML")
+	//MathML里有不支持的元素，比如content MathML
+	ErrUnknownElement = errors.New("unknown MathML element")
+)
+
+//解析MTEF数据出错时返回，Offset是出错的record在MTEF数据（不包括EQNOLEFILEHDR）中的位置
+//Record为ROOT表示header出错
+type ParseError struct {
+	Offset int64
+	Record RecordType
+	Err    error
+}
+
+func newParseError(offset int64, record RecordType, err error) *ParseError {
+	//record读到一半就结束，是数据被截断了
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return &ParseError{Offset: offset, Record: record, Err: err}
+}
+
+func (e *ParseError) Error() string {
+	if e.Record == ROOT {
+		return fmt.Sprintf("mtef: parse header at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("mtef: parse %v record at offset %d: %v", e.Record, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+//ParseLatex出错时返回，Offset是出错的位置（字节）
+//Translate遇到没办法转换成LaTeX的template时也返回，Template是这个template，可以取得selector和variation
+type LatexError struct {
+	Offset   int
+	Template *Template
+	Err      error
+}
+
+func newTemplateLatexError(ast *MtAST) *LatexError {
+	return &LatexError{Template: &Template{ast}, Err: ErrNotImplemented}
+}
+
+func (e *LatexError) Error() string {
+	if e.Template != nil {
+		return fmt.Sprintf("mtef: latex %v template (variation %#x): %v", e.Template.Selector(), uint16(e.Template.Variation()), e.Err)
+	}
+	return fmt.Sprintf("mtef: latex at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *LatexError) Unwrap() error {
+	return e.Err
+}
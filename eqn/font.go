@@ -0,0 +1,208 @@
+package eqn
+
+import (
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//ENCODING_DEF的编号从5开始，1-4是预定义的
+var predefinedEncodings = []string{"MTCode", "Unknown", "Symbol", "MTExtra"}
+
+//字体名可能使用的code page，Common判断一个字符编码后的字节是不是在这个code page常用的范围里
+type CodePage struct {
+	Name     string
+	Encoding encoding.Encoding
+	Common   func(encoded []byte) bool
+}
+
+var (
+	//GB2312的符号和汉字
+	CodePageGBK = CodePage{"GBK", simplifiedchinese.GBK, func(b []byte) bool {
+		return len(b) == 1 && b[0] < 0x80 || len(b) == 2 && b[0] >= 0xa1 && b[0] <= 0xf7 && b[1] >= 0xa1
+	}}
+	//JIS X 0208的符号、全角字母、假名和第一水准汉字，半角片假名不算
+	CodePageShiftJIS = CodePage{"Shift-JIS", japanese.ShiftJIS, func(b []byte) bool {
+		return len(b) == 1 && b[0] < 0x80 || len(b) == 2 && (b[0] >= 0x81 && b[0] <= 0x84 || b[0] >= 0x88 && b[0] <= 0x98)
+	}}
+	//Big5的符号和常用字
+	CodePageBig5 = CodePage{"Big5", traditionalchinese.Big5, func(b []byte) bool {
+		return len(b) == 1 && b[0] < 0x80 || len(b) == 2 && b[0] >= 0xa1 && b[0] <= 0xc6
+	}}
+	//ASCII和带重音的字母
+	CodePageWindows1252 = CodePage{"Windows-1252", charmap.Windows1252, func(b []byte) bool {
+		return len(b) == 1 && (b[0] < 0x80 || b[0] >= 0xc0 && b[0] != 0xd7 && b[0] != 0xf7)
+	}}
+	//ASCII和带重音的字母（0x80-0x9f）
+	CodePageMacRoman = CodePage{"MacRoman", charmap.Macintosh, func(b []byte) bool {
+		return len(b) == 1 && b[0] <= 0x9f
+	}}
+)
+
+//ENCODING_DEF名字里的关键字（小写）对应的code page，比如WinANSI、MacRoman
+var encodingCodePages = []struct {
+	keywords []string
+	codePage CodePage
+}{
+	{[]string{"mac"}, CodePageMacRoman},
+	{[]string{"shiftjis", "shift_jis", "japanese"}, CodePageShiftJIS},
+	{[]string{"gbk", "gb2312", "chinesesimp"}, CodePageGBK},
+	{[]string{"big5", "chinesetrad"}, CodePageBig5},
+	{[]string{"ansi", "1252", "western"}, CodePageWindows1252},
+}
+
+//Win*编码（比如WinAllBasicCodePages、WinAllCodePages）的字体名按照保存公式的系统的ANSI code page保存，
+//MTEF里面没有记录具体是哪一个，每个code page都解码一次，落在常用范围里的字节最多的结果生效，一样多的时候前面的优先
+var FontNameCodePages = []CodePage{
+	CodePageGBK,
+	CodePageShiftJIS,
+	CodePageBig5,
+	CodePageWindows1252,
+}
+
+//FONT_DEF，字体名已经按照ENCODING_DEF解码成UTF-8
+type FontDef struct {
+	//从1开始编号，FONT_STYLE_DEF和EQN_PREFS通过编号引用
+	Index    int
+	Name     string
+	RawName  []byte
+	Encoding string
+}
+
+//FONT_STYLE_DEF，CHAR的typeface为负数时引用
+type FontStyleDef struct {
+	//从1开始编号，typeface -1 对应第1个
+	Index  int
+	Font   FontDef
+	Bold   bool
+	Italic bool
+}
+
+//字体样式
+const (
+	fontStyleBold   uint8 = 0x01
+	fontStyleItalic uint8 = 0x02
+)
+
+//根据编号返回编码名字，1-4是预定义的编码，5开始是ENCODING_DEF
+func (m *MTEFv5) EncodingName(index uint8) string {
+	idx := int(index) - 1
+	if idx >= 0 && idx < len(predefinedEncodings) {
+		return predefinedEncodings[idx]
+	}
+
+	idx -= len(predefinedEncodings)
+	if idx >= 0 && idx < len(m.encodingDefs) {
+		return m.encodingDefs[idx]
+	}
+	return ""
+}
+
+//公式里所有的FONT_DEF
+func (m *MTEFv5) FontDefs() []FontDef {
+	fonts := make([]FontDef, 0, len(m.fontDefs))
+	for idx := range m.fontDefs {
+		fonts = append(fonts, m.fontDef(idx+1))
+	}
+	return fonts
+}
+
+//公式里所有的FONT_STYLE_DEF
+func (m *MTEFv5) FontStyleDefs() []FontStyleDef {
+	styles := make([]FontStyleDef, 0, len(m.fontStyleDefs))
+	for idx, def := range m.fontStyleDefs {
+		styles = append(styles, FontStyleDef{
+			Index:  idx + 1,
+			Font:   m.fontDef(int(def.fontDefIndex)),
+			Bold:   def.style&fontStyleBold != 0,
+			Italic: def.style&fontStyleItalic != 0,
+		})
+	}
+	return styles
+}
+
+func (m *MTEFv5) fontDef(index int) FontDef {
+	if index < 1 || index > len(m.fontDefs) {
+		return FontDef{Index: index}
+	}
+
+	def := m.fontDefs[index-1]
+	enc := m.EncodingName(def.encDefIndex)
+	return FontDef{
+		Index:    index,
+		Name:     decodeFontName([]byte(def.name), enc),
+		RawName:  []byte(def.name),
+		Encoding: enc,
+	}
+}
+
+func decodeFontName(raw []byte, enc string) string {
+	if isASCII(raw) {
+		return string(raw)
+	}
+
+	lower := strings.ToLower(enc)
+	if strings.Contains(lower, "utf") || strings.Contains(lower, "unicode") {
+		return string(raw)
+	}
+
+	//ENCODING_DEF指定了code page的直接使用
+	for _, e := range encodingCodePages {
+		for _, keyword := range e.keywords {
+			if !strings.Contains(lower, keyword) {
+				continue
+			}
+			if name, _, ok := e.codePage.decode(raw); ok {
+				return name
+			}
+		}
+	}
+
+	if utf8.Valid(raw) {
+		return string(raw)
+	}
+
+	name, best := string(raw), -1
+	for _, codePage := range FontNameCodePages {
+		if decoded, score, ok := codePage.decode(raw); ok && score > best {
+			name, best = decoded, score
+		}
+	}
+	return name
+}
+
+//解码raw，score是解码后落在常用范围里的字节数
+func (c CodePage) decode(raw []byte) (name string, score int, ok bool) {
+	out, err := c.Encoding.NewDecoder().Bytes(raw)
+	if err != nil {
+		return "", 0, false
+	}
+
+	//解码失败的字节会被替换成U+FFFD
+	encoder := c.Encoding.NewEncoder()
+	for _, r := range string(out) {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			return "", 0, false
+		}
+
+		encoded, err := encoder.Bytes([]byte(string(r)))
+		if err == nil && c.Common != nil && c.Common(encoded) {
+			score += len(encoded)
+		}
+	}
+	return string(out), score, true
+}
+
+func isASCII(raw []byte) bool {
+	for _, b := range raw {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
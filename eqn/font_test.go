@@ -0,0 +1,75 @@
+package eqn
+
+import (
+	"bytes"
+	"testing"
+)
+
+var fontNameTests = []struct {
+	raw      string
+	encoding string
+	name     string
+}{
+	//WinAllBasicCodePages，按照常用范围选择code page
+	{"\xcb\xce\xcc\xe5", "WinAllBasicCodePages", "宋体"},
+	{"\xba\xda\xcc\xe5", "WinAllBasicCodePages", "黑体"},
+	{"\xce\xa2\xc8\xed\xd1\xc5\xba\xda", "WinAllCodePages", "微软雅黑"},
+	{"\x82\x6c\x82\x72\x20\x96\xbe\x92\xa9", "WinAllBasicCodePages", "ＭＳ 明朝"},
+	{"\x82\x6c\x82\x72\x20\x83\x53\x83\x56\x83\x62\x83\x4e", "WinAllBasicCodePages", "ＭＳ ゴシック"},
+	{"\x83\x81\x83\x43\x83\x8a\x83\x49", "WinAllCodePages", "メイリオ"},
+	{"\xb7\x73\xb2\xd3\xa9\xfa\xc5\xe9", "WinAllBasicCodePages", "新細明體"},
+	{"\xb7\x4c\xb3\x6e\xa5\xbf\xb6\xc2\xc5\xe9", "WinAllCodePages", "微軟正黑體"},
+	{"\x43\x61\x66\xe9\x20\x53\x61\x6e\x73", "WinAllBasicCodePages", "Café Sans"},
+	{"\x4d\xe1\x6c\x61\x67\x61", "WinAllBasicCodePages", "Málaga"},
+
+	//ENCODING_DEF指定了code page
+	{"\x5a\x61\x70\x66\x20\x44\x69\x6e\x67\x62\x61\x74\x73\x20\x86", "MacRoman", "Zapf Dingbats Ü"},
+	{"\x4d\xe1\x6c\x61\x67\x61", "WinANSI", "Málaga"},
+	{"\xcb\xce\xcc\xe5", "WinChineseSimp", "宋体"},
+	{"\x82\x6c\x82\x72\x20\x96\xbe\x92\xa9", "WinShiftJIS", "ＭＳ 明朝"},
+	{"\xbc\xd0\xb7\xa2\xc5\xe9", "WinChineseTrad", "標楷體"},
+	{"宋体", "UTF-8", "宋体"},
+
+	{"Times New Roman", "WinAllBasicCodePages", "Times New Roman"},
+	{"ＭＳ 明朝", "WinAllBasicCodePages", "ＭＳ 明朝"},
+}
+
+func TestDecodeFontName(t *testing.T) {
+	for _, test := range fontNameTests {
+		if name := decodeFontName([]byte(test.raw), test.encoding); name != test.name {
+			t.Errorf("decodeFontName(%q, %v) = %q, want %q", test.raw, test.encoding, name, test.name)
+		}
+	}
+}
+
+func TestFontDefs(t *testing.T) {
+	//FONT_DEF写进MTEF数据再读出来，通过ENCODING_DEF的编号找到编码
+	m := New()
+	m.ast.children = append(m.ast.children[:1:1], append([]*MtAST{
+		{ENCODING_DEF, "WinShiftJIS", nil},
+		{FONT_DEF, &MtfontDef{encDefIndex: 6, name: "\x82\x6c\x82\x72\x20\x96\xbe\x92\xa9"}, nil},
+		{FONT_DEF, &MtfontDef{encDefIndex: 5, name: "\xcb\xce\xcc\xe5"}, nil},
+	}, m.ast.children[1:]...)...)
+
+	data, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	eqn, err := OpenMTEF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"ＭＳ 明朝": "WinShiftJIS", "宋体": "WinAllBasicCodePages"}
+	for _, font := range eqn.FontDefs() {
+		if enc, ok := want[font.Name]; ok {
+			if font.Encoding != enc {
+				t.Errorf("font %q encoding = %v, want %v", font.Name, font.Encoding, enc)
+			}
+			delete(want, font.Name)
+		}
+	}
+	for name := range want {
+		t.Errorf("font %q not found in %v", name, eqn.FontDefs())
+	}
+}
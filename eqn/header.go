@@ -0,0 +1,78 @@
+package eqn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+//MTEF header里的platform
+const (
+	PlatformMac     uint8 = 0
+	PlatformWindows uint8 = 1
+)
+
+//MTEF header里的product
+const (
+	ProductMathType       uint8 = 0
+	ProductEquationEditor uint8 = 1
+)
+
+//equation options，目前只定义了inline
+const mtefOptInline uint8 = 0x01
+
+//MTEF数据开头的header，MTEFv3和MTEFv4没有Application和Options
+type Header struct {
+	MtefVersion uint8  `json:"mtefVersion"`
+	Platform    uint8  `json:"platform"`
+	Product     uint8  `json:"product"`
+	Version     uint8  `json:"version"`
+	VersionSub  uint8  `json:"versionSub"`
+	Application string `json:"application,omitempty"`
+	Options     uint8  `json:"options,omitempty"`
+}
+
+//公式是否是行内公式（inline）
+func (h Header) Inline() bool {
+	return h.Options&mtefOptInline != 0
+}
+
+//EQNOLEFILEHDR，OLE对象"Equation Native" stream开头的28个字节
+type OleHeader struct {
+	CbHdr           uint16
+	Version         uint32
+	ClipboardFormat uint16
+	CbObject        uint32
+	Reserved        [4]uint32
+}
+
+func readOleHeader(buffer []byte) (hdr OleHeader, err error) {
+	if err = binary.Read(bytes.NewReader(buffer), binary.LittleEndian, &hdr); err != nil {
+		return hdr, err
+	}
+	if hdr.CbHdr != oleCbHdr {
+		return hdr, fmt.Errorf("invalid EQNOLEFILEHDR size %d", hdr.CbHdr)
+	}
+	return hdr, nil
+}
+
+//MTEF header
+func (m *MTEFv5) Header() Header {
+	return Header{
+		MtefVersion: m.mMtefVer,
+		Platform:    m.mPlatform,
+		Product:     m.mProduct,
+		Version:     m.mVersion,
+		VersionSub:  m.mVersionSub,
+		Application: m.mApplication,
+		Options:     m.mInline,
+	}
+}
+
+//EQNOLEFILEHDR，只有通过Open从OLE对象读取的公式才有，ok为false表示没有
+func (m *MTEFv5) OleHeader() (hdr OleHeader, ok bool) {
+	if m.oleHeader == nil {
+		return OleHeader{}, false
+	}
+	return *m.oleHeader, true
+}
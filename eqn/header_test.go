@@ -0,0 +1,64 @@
+package eqn
+
+import (
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		file   string
+		header Header
+		inline bool
+		ole    OleHeader
+	}{
+		{
+			"oleObject1.bin",
+			Header{MtefVersion: 5, Platform: PlatformWindows, Product: ProductMathType, Version: 6, VersionSub: 9, Application: "DSMT6"},
+			false,
+			OleHeader{CbHdr: oleCbHdr, Version: eqnOleVersion, ClipboardFormat: 0xC378, CbObject: 317},
+		},
+		{
+			"oleObject2.bin",
+			Header{MtefVersion: 5, Platform: PlatformWindows, Product: ProductMathType, Version: 6, VersionSub: 9, Application: "DSMT6", Options: mtefOptInline},
+			true,
+			OleHeader{CbHdr: oleCbHdr, Version: eqnOleVersion, ClipboardFormat: 0xC2DA, CbObject: 286},
+		},
+		//Equation Editor 3.0写的MTEFv3，header里没有Application和Options
+		{
+			"oleObject3.bin",
+			Header{MtefVersion: 3, Platform: PlatformWindows, Product: ProductEquationEditor, Version: 3},
+			false,
+			OleHeader{CbHdr: oleCbHdr, Version: eqnOleVersion, ClipboardFormat: 0xC1DF, CbObject: 50},
+		},
+		{
+			"oleObject4.bin",
+			Header{MtefVersion: 4, Platform: PlatformWindows, Product: ProductMathType, Version: 4},
+			false,
+			OleHeader{CbHdr: oleCbHdr, Version: eqnOleVersion, ClipboardFormat: 0xC1DF, CbObject: 53},
+		},
+	}
+	for _, test := range tests {
+		eqn := openFixture(t, test.file)
+		if header := eqn.Header(); header != test.header || header.Inline() != test.inline {
+			t.Errorf("%v: Header() = %+v, Inline() = %v, want %+v, %v", test.file, header, header.Inline(), test.header, test.inline)
+		}
+
+		//Reserved是MathType写的，不检查
+		hdr, ok := eqn.OleHeader()
+		hdr.Reserved = [4]uint32{}
+		if !ok || hdr != test.ole {
+			t.Errorf("%v: OleHeader() = %+v, %v, want %+v", test.file, hdr, ok, test.ole)
+		}
+	}
+}
+
+func TestReadOleHeader(t *testing.T) {
+	data := make([]byte, oleCbHdr)
+	data[0] = 30
+	if _, err := readOleHeader(data); err == nil {
+		t.Errorf("readOleHeader with cbHdr 30: no error")
+	}
+	if _, err := readOleHeader(data[:10]); err == nil {
+		t.Errorf("readOleHeader with 10 bytes: no error")
+	}
+}
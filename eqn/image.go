@@ -0,0 +1,296 @@
+package eqn
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+//MathType "Save as image" 导出的图片里面也保存了MTEF数据：
+//GIF: application extension "MathType"，sub-block里是MTEF数据
+//PNG: 关键字为"MathType"的tEXt/zTXt/iTXt chunk
+//EPS/SVG: 注释里的文本格式 "MathType@MTEF@5@5@+=...@checksum@"
+
+const (
+	gifExtension   = 0x21
+	gifApplication = 0xFF
+	gifImage       = 0x2C
+	gifTrailer     = 0x3B
+
+	epsBinaryKey = uint32(0xC6D3D0C5)
+)
+
+var (
+	gifAppID     = []byte("MathType")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+	//文本格式的MTEF，每个字符6个bit，低位在前
+	mtefTextAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+-"
+	mtefTextKey      = "MathType"
+)
+
+var (
+	ErrNoImageMTEF  = errors.New("no MathType data in image")
+	ErrMTEFChecksum = errors.New("MathType text checksum mismatch")
+)
+
+//从MathType导出的GIF/PNG/EPS/SVG图片里面读取MTEF数据并解析
+func OpenImage(reader io.Reader) (eqn *MTEFv5, err error) {
+	data, err := ExtractImage(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenMTEF(bytes.NewReader(data))
+}
+
+//根据文件头判断图片格式，返回里面保存的MTEF数据
+func ExtractImage(reader io.Reader) ([]byte, error) {
+	buffer, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	switch {
+	case bytes.HasPrefix(buffer, []byte("GIF8")):
+		payload = gifPayload(buffer)
+	case bytes.HasPrefix(buffer, pngSignature):
+		payload = pngPayload(buffer)
+	case len(buffer) >= 30 && binary.LittleEndian.Uint32(buffer) == epsBinaryKey:
+		//DOS EPS，PostScript部分的offset和长度在文件头里
+		start := binary.LittleEndian.Uint32(buffer[4:])
+		length := binary.LittleEndian.Uint32(buffer[8:])
+		if uint64(start)+uint64(length) <= uint64(len(buffer)) {
+			payload = epsPayload(buffer[start : start+length])
+		}
+	case bytes.HasPrefix(buffer, []byte("%!")):
+		payload = epsPayload(buffer)
+	default:
+		//SVG或者其他带注释的文本
+		payload = buffer
+	}
+
+	data, err := decodeMTEFPayload(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrNoImageMTEF
+	}
+	return data, nil
+}
+
+func gifPayload(buffer []byte) []byte {
+	//header(6) + logical screen descriptor(7)
+	if len(buffer) < 13 {
+		return nil
+	}
+	pos := 13
+	if buffer[10]&0x80 != 0 {
+		pos += 3 << (uint(buffer[10]&0x07) + 1)
+	}
+
+	//读取sub-block，返回数据和结束位置
+	subBlocks := func(pos int) ([]byte, int) {
+		var data []byte
+		for pos < len(buffer) && buffer[pos] != 0 {
+			size := int(buffer[pos])
+			if pos+1+size > len(buffer) {
+				return data, len(buffer)
+			}
+			data = append(data, buffer[pos+1:pos+1+size]...)
+			pos += 1 + size
+		}
+		return data, pos + 1
+	}
+
+	for pos < len(buffer) {
+		switch buffer[pos] {
+		case gifExtension:
+			if pos+2 > len(buffer) {
+				return nil
+			}
+			label := buffer[pos+1]
+			data, next := subBlocks(pos + 2)
+
+			//application extension的第一个sub-block是identifier(8)+authentication code(3)
+			if label == gifApplication && bytes.HasPrefix(data, gifAppID) && len(data) >= 11 {
+				return data[11:]
+			}
+			pos = next
+		case gifImage:
+			//image descriptor(10) + local color table + LZW code size(1) + image data
+			if pos+10 > len(buffer) {
+				return nil
+			}
+			flags := buffer[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (uint(flags&0x07) + 1)
+			}
+			_, pos = subBlocks(pos + 1)
+		default:
+			//gifTrailer或者无法识别的数据
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func pngPayload(buffer []byte) []byte {
+	pos := len(pngSignature)
+	for pos+12 <= len(buffer) {
+		length := int(binary.BigEndian.Uint32(buffer[pos:]))
+		chunkType := string(buffer[pos+4 : pos+8])
+		if pos+12+length > len(buffer) {
+			return nil
+		}
+		data := buffer[pos+8 : pos+8+length]
+		pos += 12 + length
+
+		idx := bytes.IndexByte(data, 0)
+		if idx < 0 || !strings.EqualFold(string(data[:idx]), mtefTextKey) {
+			continue
+		}
+		data = data[idx+1:]
+
+		switch chunkType {
+		case "tEXt":
+			return data
+		case "zTXt":
+			//compression method(1) + zlib数据
+			if len(data) > 0 {
+				return inflate(data[1:])
+			}
+		case "iTXt":
+			//compression flag(1) + compression method(1) + language\0 + translated keyword\0 + text
+			if len(data) < 2 {
+				continue
+			}
+			compressed := data[0] == 1
+			text := data[2:]
+			for i := 0; i < 2; i++ {
+				idx := bytes.IndexByte(text, 0)
+				if idx < 0 {
+					return nil
+				}
+				text = text[idx+1:]
+			}
+			if compressed {
+				return inflate(text)
+			}
+			return text
+		}
+	}
+
+	return nil
+}
+
+func epsPayload(buffer []byte) []byte {
+	//把注释行拼接起来，文本格式的MTEF数据可能被拆成了多行
+	var comments bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(buffer))
+	scanner.Buffer(make([]byte, 64*1024), len(buffer)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(line, []byte("%")) {
+			comments.Write(bytes.TrimLeft(line, "%"))
+		}
+	}
+
+	return comments.Bytes()
+}
+
+func inflate(data []byte) []byte {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	defer reader.Close()
+
+	out, _ := ioutil.ReadAll(reader)
+	return out
+}
+
+func decodeMTEFPayload(payload []byte) ([]byte, error) {
+	/**
+	payload可能是文本格式，也可能直接是MTEF二进制数据
+	*/
+	//前面可能还有"MathType@Translator@..."之类的注释，需要找到MTEF那一段
+	for text := payload; ; {
+		idx := bytes.Index(text, []byte(mtefTextKey))
+		if idx < 0 {
+			break
+		}
+		data, err := DecodeMTEFText(string(text[idx:]))
+		if err == nil || errors.Is(err, ErrMTEFChecksum) {
+			return data, err
+		}
+		text = text[idx+len(mtefTextKey):]
+	}
+
+	//二进制数据，MTEF第一个字节是版本号，可能带有EQNOLEFILEHDR
+	if len(payload) > int(oleCbHdr) && binary.LittleEndian.Uint16(payload) == oleCbHdr {
+		payload = payload[oleCbHdr:]
+	}
+	if len(payload) > 0 && payload[0] >= 3 && payload[0] <= 5 {
+		return payload, nil
+	}
+
+	return nil, ErrNoImageMTEF
+}
+
+//解码文本格式的MTEF，比如 "MathType@MTEF@5@5@+=feaag...@3A3C@"
+//分隔符可以是'@'或者'!'，数据部分以"+="开始，最后一段是校验码：数据部分字符的和(16位，十六进制)
+func DecodeMTEFText(text string) ([]byte, error) {
+	if !strings.HasPrefix(text, mtefTextKey) || len(text) <= len(mtefTextKey) {
+		return nil, ErrNoImageMTEF
+	}
+
+	sep := text[len(mtefTextKey) : len(mtefTextKey)+1]
+	fields := strings.SplitN(text, sep, 6)
+	if len(fields) < 6 || fields[1] != "MTEF" {
+		return nil, ErrNoImageMTEF
+	}
+	encoded := strings.TrimPrefix(fields[4], "+=")
+	checksum := strings.SplitN(fields[5], sep, 2)[0]
+
+	var out []byte
+	var acc, bits uint
+	var sum uint16
+	for _, c := range encoded {
+		//注释里面可能有换行和空格
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			continue
+		}
+
+		val := strings.IndexRune(mtefTextAlphabet, c)
+		if val < 0 {
+			return nil, ErrNoImageMTEF
+		}
+
+		sum += uint16(c)
+		acc |= uint(val) << bits
+		bits += 6
+		for bits >= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+			bits -= 8
+		}
+	}
+
+	if want, err := strconv.ParseUint(checksum, 16, 16); err != nil || uint16(want) != sum {
+		return nil, fmt.Errorf("%w: %q, data sums to %04X", ErrMTEFChecksum, checksum, sum)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,208 @@
+package eqn
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+//按文本格式编码MTEF数据，每个字符6个bit，低位在前，最后是字符的和
+func encodeMTEFText(data []byte, sep string) string {
+	var text strings.Builder
+	var acc, bits uint
+	for _, b := range data {
+		acc |= uint(b) << bits
+		bits += 8
+		for bits >= 6 {
+			text.WriteByte(mtefTextAlphabet[acc&0x3F])
+			acc >>= 6
+			bits -= 6
+		}
+	}
+	if bits > 0 {
+		text.WriteByte(mtefTextAlphabet[acc&0x3F])
+	}
+
+	var sum uint16
+	for _, c := range text.String() {
+		sum += uint16(c)
+	}
+	return strings.Join([]string{"MathType", "MTEF", "5", "5", "+=" + text.String(), fmt.Sprintf("%04X", sum), ""}, sep)
+}
+
+func deflate(data []byte) []byte {
+	var out bytes.Buffer
+	writer := zlib.NewWriter(&out)
+	writer.Write(data)
+	writer.Close()
+	return out.Bytes()
+}
+
+//GIF的sub-block，每个最多255字节，0结束
+func gifSubBlocks(data []byte) []byte {
+	var out []byte
+	for len(data) > 0 {
+		size := len(data)
+		if size > 255 {
+			size = 255
+		}
+		out = append(append(out, byte(size)), data[:size]...)
+		data = data[size:]
+	}
+	return append(out, 0)
+}
+
+//1x1的GIF，global color table、comment和一帧图像(带local color table)在extension前面
+func testGIF(extensions ...[]byte) []byte {
+	gif := []byte("GIF89a")
+	gif = append(gif, 1, 0, 1, 0, 0x80, 0, 0)
+	gif = append(gif, 0, 0, 0, 0xFF, 0xFF, 0xFF)
+	gif = append(append(gif, gifExtension, 0xFE), gifSubBlocks([]byte("comment"))...)
+	gif = append(gif, gifImage, 0, 0, 0, 0, 1, 0, 1, 0, 0x80, 0, 0, 0, 0xFF, 0xFF, 0xFF)
+	gif = append(append(gif, 2), gifSubBlocks([]byte{0x02, 0x44, 0x01})...)
+	for _, extension := range extensions {
+		gif = append(gif, extension...)
+	}
+	return append(gif, gifTrailer)
+}
+
+func gifMathType(data []byte) []byte {
+	return append([]byte{gifExtension, gifApplication}, gifSubBlocks(append([]byte("MathType001"), data...))...)
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, data...)
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+	return append(chunk, crc...)
+}
+
+//1x1的PNG，chunks放在IHDR和IEND之间
+func testPNG(chunks ...[]byte) []byte {
+	png := append([]byte{}, pngSignature...)
+	png = append(png, pngChunk("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0})...)
+	for _, chunk := range chunks {
+		png = append(png, chunk...)
+	}
+	return append(png, pngChunk("IEND", nil)...)
+}
+
+//文本格式的MTEF拆成多行注释
+func testEPS(text string) []byte {
+	eps := "%!PS-Adobe-3.0 EPSF-3.0\n%%BoundingBox: 0 0 20 10\n"
+	for len(text) > 60 {
+		eps += "%" + text[:60] + "\n"
+		text = text[60:]
+	}
+	eps += "%" + text + "\nshowpage\n%%EOF\n"
+	return []byte(eps)
+}
+
+//DOS EPS：30字节的文件头，PostScript部分后面是TIFF预览
+func dosEPS(eps []byte) []byte {
+	header := make([]byte, 30)
+	binary.LittleEndian.PutUint32(header, epsBinaryKey)
+	binary.LittleEndian.PutUint32(header[4:], 30)
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(eps)))
+	binary.LittleEndian.PutUint32(header[20:], uint32(30+len(eps)))
+	binary.LittleEndian.PutUint32(header[24:], 4)
+	binary.LittleEndian.PutUint16(header[28:], 0xFFFF)
+	return append(append(header, eps...), "II*\x00"...)
+}
+
+func TestExtractImage(t *testing.T) {
+	mtef := testMTEF(t)
+	text := encodeMTEFText(mtef, "@")
+	translator := "MathType@Translator@5@5@SVG.tdl@SVG@"
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"GIF", testGIF(gifMathType(mtef))},
+		//sub-block超过255字节要拆开
+		{"GIF in sub-blocks", testGIF(gifMathType(append(append([]byte{}, mtef...), make([]byte, 300)...)))},
+		{"PNG tEXt", testPNG(pngChunk("tEXt", []byte("Software\x00MathType")), pngChunk("tEXt", []byte("MathType\x00"+text)))},
+		{"PNG zTXt", testPNG(pngChunk("zTXt", append([]byte("MathType\x00\x00"), deflate(mtef)...)))},
+		{"PNG iTXt", testPNG(pngChunk("iTXt", []byte("MathType\x00\x00\x00en\x00\x00"+text)))},
+		{"PNG compressed iTXt", testPNG(pngChunk("iTXt", append([]byte("MathType\x00\x01\x00\x00\x00"), deflate([]byte(text))...)))},
+		{"EPS", testEPS(text)},
+		{"DOS EPS", dosEPS(testEPS(encodeMTEFText(mtef, "!")))},
+		{"SVG", []byte("<svg><!-- " + translator + " --><!-- " + text + " --></svg>")},
+	}
+	for _, test := range tests {
+		data, err := ExtractImage(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !bytes.HasPrefix(data, mtef) {
+			t.Errorf("%v: ExtractImage = %x, want %x", test.name, data, mtef)
+		}
+	}
+
+	noMTEF := [][]byte{
+		testGIF([]byte{gifExtension, gifApplication, 11, 'N', 'E', 'T', 'S', 'C', 'A', 'P', 'E', '2', '.', '0', 0}),
+		testPNG(pngChunk("tEXt", []byte("Software\x00MathType"))),
+		testEPS("no equation"),
+		[]byte("<svg><!-- " + translator + " --></svg>"),
+	}
+	for _, data := range noMTEF {
+		if _, err := ExtractImage(bytes.NewReader(data)); !errors.Is(err, ErrNoImageMTEF) {
+			t.Errorf("ExtractImage(%q): %v, want %v", data[:8], err, ErrNoImageMTEF)
+		}
+	}
+}
+
+func TestDecodeMTEFText(t *testing.T) {
+	mtef := testMTEF(t)
+	for _, sep := range []string{"@", "!"} {
+		text := encodeMTEFText(mtef, sep)
+		//注释里面的换行和空格跳过
+		text = strings.Replace(text, "+=", "+=\n  ", 1)
+		data, err := DecodeMTEFText(text)
+		if err != nil || !bytes.Equal(data, mtef) {
+			t.Errorf("DecodeMTEFText(%q) = %x, %v, want %x", text, data, err, mtef)
+		}
+	}
+
+	for _, text := range []string{"MathType", "MathType@Translator@5@5@SVG.tdl@SVG@", "MathType@MTEF@5@5@+=a*b@0000@"} {
+		if _, err := DecodeMTEFText(text); !errors.Is(err, ErrNoImageMTEF) {
+			t.Errorf("DecodeMTEFText(%q): %v, want %v", text, err, ErrNoImageMTEF)
+		}
+	}
+
+	//数据部分改了一个字符，或者校验码不是十六进制
+	text := encodeMTEFText(mtef, "@")
+	idx := strings.Index(text, "+=") + 10
+	corrupted := []string{
+		text[:idx] + string(mtefTextAlphabet[(strings.IndexByte(mtefTextAlphabet, text[idx])+1)%64]) + text[idx+1:],
+		text[:strings.LastIndex(text[:len(text)-1], "@")+1] + "XYZ@",
+	}
+	for _, text := range corrupted {
+		if _, err := DecodeMTEFText(text); !errors.Is(err, ErrMTEFChecksum) {
+			t.Errorf("DecodeMTEFText(%q): %v, want %v", text, err, ErrMTEFChecksum)
+		}
+		if _, err := ExtractImage(strings.NewReader("<svg><!-- " + text + " --></svg>")); !errors.Is(err, ErrMTEFChecksum) {
+			t.Errorf("ExtractImage(%q): %v, want %v", text, err, ErrMTEFChecksum)
+		}
+	}
+}
+
+func TestOpenImage(t *testing.T) {
+	eqn, err := OpenImage(bytes.NewReader(testPNG(pngChunk("tEXt", []byte("MathType\x00"+encodeMTEFText(testMTEF(t), "@"))))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latex, err := eqn.Translate(); err != nil || latex != "$$ a+b $$" {
+		t.Errorf("Translate() = %q, %v", latex, err)
+	}
+}
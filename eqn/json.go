@@ -0,0 +1,613 @@
+package eqn
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//公式的JSON格式：
+//
+//	{
+//	  "header":  {"mtefVersion": 5, "platform": 1, "product": 0, "version": 7, "versionSub": 0, "application": "DSMT7"},
+//	  "objects": [节点, ...]
+//	}
+//
+//每个节点都有"record"（RecordType的名字），其他字段由record决定，值为0的字段省略：
+//
+//	LINE            null, lineSpacing, tabStops, nudge, children
+//	CHAR            mtcode, char, typeface, functionStart, noMtcode, bits8, bits16, embellishments, nudge
+//	TMPL            selector, variation, variations, options, nudge, children
+//	PILE            halign, valign, tabStops, nudge, children
+//	MATRIX          rows, cols, valign, hJust, vJust, rowPartitions, colPartitions, nudge, children
+//	SIZE            lsize, dsize（FULL、SUB、SUB2、SYM、SUBSYM没有其他字段）
+//	COLOR           index
+//	COLOR_DEF       values（3个是RGB，4个是CMYK）, name, spot
+//	FONT_STYLE_DEF  font, bold, italic
+//	FONT_DEF        encoding, name（UTF-8）, rawName（原始字节，base64，名字不是ASCII时才有）
+//	ENCODING_DEF    name
+//	EQN_PREFS       options, sizes, spacing（"12pt"、"150%"这样的字符串）, styles（[{"font": 1, "bold": true, "italic": false}]）
+//
+//nudge是{"x": 0, "y": 0}，单位1/32 point；tabStops是[{"type": "left", "offset": 0}]；
+//embellishments是[{"type": "dot", "nudge": ...}]，按从里到外的顺序；
+//selector、variations、embellishment和tab stop的type都用名字（SelectorType、EmbellType、TabStopType的String()），
+//variation是原始值，读取的时候优先使用，没有的时候按variations的名字组合
+type jsonEquation struct {
+	Header  Header      `json:"header"`
+	Objects []*jsonNode `json:"objects"`
+}
+
+type jsonNudge struct {
+	X int16 `json:"x"`
+	Y int16 `json:"y"`
+}
+
+type jsonTabStop struct {
+	Type   string `json:"type"`
+	Offset int16  `json:"offset"`
+}
+
+type jsonEmbell struct {
+	Type  string     `json:"type"`
+	Nudge *jsonNudge `json:"nudge,omitempty"`
+}
+
+type jsonStyle struct {
+	Font   uint8 `json:"font"`
+	Bold   bool  `json:"bold,omitempty"`
+	Italic bool  `json:"italic,omitempty"`
+}
+
+type jsonNode struct {
+	Record string `json:"record"`
+
+	//LINE
+	Null        bool  `json:"null,omitempty"`
+	LineSpacing uint8 `json:"lineSpacing,omitempty"`
+
+	//CHAR
+	MTCode         uint16       `json:"mtcode,omitempty"`
+	Char           string       `json:"char,omitempty"`
+	Typeface       int          `json:"typeface,omitempty"`
+	FunctionStart  bool         `json:"functionStart,omitempty"`
+	NoMTCode       bool         `json:"noMtcode,omitempty"`
+	Bits8          *uint8       `json:"bits8,omitempty"`
+	Bits16         *uint16      `json:"bits16,omitempty"`
+	Embellishments []jsonEmbell `json:"embellishments,omitempty"`
+
+	//TMPL、EQN_PREFS
+	Selector   string   `json:"selector,omitempty"`
+	Variation  *uint16  `json:"variation,omitempty"`
+	Variations []string `json:"variations,omitempty"`
+	Options    uint8    `json:"options,omitempty"`
+
+	//PILE、MATRIX
+	HAlign        uint8 `json:"halign,omitempty"`
+	VAlign        uint8 `json:"valign,omitempty"`
+	Rows          uint8 `json:"rows,omitempty"`
+	Cols          uint8 `json:"cols,omitempty"`
+	HJust         uint8 `json:"hJust,omitempty"`
+	VJust         uint8 `json:"vJust,omitempty"`
+	RowPartitions []int `json:"rowPartitions,omitempty"`
+	ColPartitions []int `json:"colPartitions,omitempty"`
+
+	//SIZE
+	LSize uint8 `json:"lsize,omitempty"`
+	DSize int16 `json:"dsize,omitempty"`
+
+	//COLOR、COLOR_DEF
+	Index  uint8    `json:"index,omitempty"`
+	Values []uint16 `json:"values,omitempty"`
+	Spot   bool     `json:"spot,omitempty"`
+
+	//FONT_STYLE_DEF、FONT_DEF、ENCODING_DEF
+	Font     uint8  `json:"font,omitempty"`
+	Bold     bool   `json:"bold,omitempty"`
+	Italic   bool   `json:"italic,omitempty"`
+	Encoding uint8  `json:"encoding,omitempty"`
+	Name     string `json:"name,omitempty"`
+	RawName  []byte `json:"rawName,omitempty"`
+
+	//EQN_PREFS
+	Sizes   []Dimension `json:"sizes,omitempty"`
+	Spacing []Dimension `json:"spacing,omitempty"`
+	Styles  []jsonStyle `json:"styles,omitempty"`
+
+	TabStops []jsonTabStop `json:"tabStops,omitempty"`
+	Nudge    *jsonNudge    `json:"nudge,omitempty"`
+	Children []*jsonNode   `json:"children,omitempty"`
+}
+
+//variation里的一个名字，v&mask == value的时候生效
+type variationName struct {
+	name  string
+	mask  uint16
+	value uint16
+}
+
+func variationFlag(name string, bits uint16) variationName {
+	return variationName{name, bits, bits}
+}
+
+var (
+	fenceVariations = []variationName{variationFlag("left", tvFENCE_L), variationFlag("right", tvFENCE_R)}
+	limitVariations = []variationName{variationFlag("lower", tvBO_LOWER), variationFlag("upper", tvBO_UPPER), variationFlag("sumStyle", tvBO_SUM)}
+
+	variationNames = map[SelectorType][]variationName{
+		tmINTERVAL: {
+			{"leftLParen", 0x0003, tvINTV_LEFT_LP}, {"leftRParen", 0x0003, tvINTV_LEFT_RP},
+			{"leftLBracket", 0x0003, tvINTV_LEFT_LB}, {"leftRBracket", 0x0003, tvINTV_LEFT_RB},
+			{"rightLParen", 0x0030, tvINTV_RIGHT_LP}, {"rightRParen", 0x0030, tvINTV_RIGHT_RP},
+			{"rightLBracket", 0x0030, tvINTV_RIGHT_LB}, {"rightRBracket", 0x0030, tvINTV_RIGHT_RB},
+		},
+		tmROOT:  {variationFlag("nth", tvROOT_NTH)},
+		tmFRACT: {variationFlag("small", tvFR_SMALL), variationFlag("slash", tvFR_SLASH), variationFlag("baseline", tvFR_BASE)},
+		tmUBAR:  {variationFlag("double", tvBAR_DOUBLE)},
+		tmOBAR:  {variationFlag("double", tvBAR_DOUBLE)},
+		tmARROW: {
+			variationFlag("double", tvAR_DOUBLE), variationFlag("harpoon", 0x0002), variationFlag("top", tvAR_TOP), variationFlag("bottom", tvAR_BOTTOM),
+			variationFlag("left", tvAR_LEFT), variationFlag("right", tvAR_RIGHT),
+		},
+		tmINTEG: append([]variationName{
+			{"single", 0x0003, tvINT_1}, {"double", 0x0003, tvINT_2}, {"triple", 0x0003, tvINT_3},
+			{"loop", 0x000C, tvINT_LOOP}, {"cwLoop", 0x000C, 0x0008}, {"ccwLoop", 0x000C, 0x000C},
+			variationFlag("expand", 0x0100),
+		}, limitVariations...),
+		tmSUM:    limitVariations,
+		tmPROD:   limitVariations,
+		tmCOPROD: limitVariations,
+		tmUNION:  limitVariations,
+		tmINTER:  limitVariations,
+		tmINTOP:  limitVariations,
+		tmSUMOP:  limitVariations,
+		tmLIM:    append([]variationName{variationFlag("doubleUnderbar", 0x0001)}, limitVariations...),
+		tmHBRACE: {variationFlag("top", tvHB_TOP)},
+		tmHBRACK: {variationFlag("top", tvHB_TOP)},
+		tmLDIV:   {variationFlag("upper", tvLD_UPPER)},
+		tmSUB:    {variationFlag("precedes", tvSU_PRECEDES)},
+		tmSUP:    {variationFlag("precedes", tvSU_PRECEDES)},
+		tmSUBSUP: {variationFlag("precedes", tvSU_PRECEDES)},
+		tmDIRAC:  {variationFlag("left", tvDI_LEFT), variationFlag("right", tvDI_RIGHT)},
+		tmVEC:    {variationFlag("left", 0x0001), variationFlag("right", 0x0002), variationFlag("under", 0x0004), variationFlag("harpoon", 0x0008)},
+		tmSTRIKE: {variationFlag("horizontal", 0x0001), variationFlag("up", 0x0002), variationFlag("down", 0x0004)},
+		tmBOX: {
+			variationFlag("round", 0x0001), variationFlag("left", 0x0002), variationFlag("right", 0x0004), variationFlag("top", 0x0008), variationFlag("bottom", 0x0010),
+		},
+	}
+)
+
+func selectorVariations(selector SelectorType) []variationName {
+	if selector <= tmOBRACK {
+		return fenceVariations
+	}
+	return variationNames[selector]
+}
+
+//variation对应的名字，selector决定每个bit的含义
+func (v Variation) Names(selector SelectorType) []string {
+	var names []string
+	for _, name := range selectorVariations(selector) {
+		if uint16(v)&name.mask == name.value {
+			names = append(names, name.name)
+		}
+	}
+	return names
+}
+
+func parseVariation(selector SelectorType, names []string) (Variation, error) {
+	var v Variation
+next:
+	for _, name := range names {
+		for _, variation := range selectorVariations(selector) {
+			if variation.name == name {
+				v |= Variation(variation.value)
+				continue next
+			}
+		}
+		return 0, fmt.Errorf("unknown variation %q for selector %v", name, selector)
+	}
+	return v, nil
+}
+
+func newJSONNudge(nudgeX int16, nudgeY int16) *jsonNudge {
+	if nudgeX == 0 && nudgeY == 0 {
+		return nil
+	}
+	return &jsonNudge{nudgeX, nudgeY}
+}
+
+func (n *jsonNudge) values() (int16, int16) {
+	if n == nil {
+		return 0, 0
+	}
+	return n.X, n.Y
+}
+
+func newJSONTabStops(ruler *MtRuler) (stops []jsonTabStop) {
+	for _, stop := range ruler.TabStops() {
+		stops = append(stops, jsonTabStop{stop.Type.String(), stop.Offset})
+	}
+	return stops
+}
+
+func parseTabStops(stops []jsonTabStop) (*MtRuler, error) {
+	if len(stops) == 0 {
+		return nil, nil
+	}
+
+	ruler := new(MtRuler)
+	var last *MtTabStop
+next:
+	for _, stop := range stops {
+		for _type := TabStopLeft; _type <= TabStopDecimal; _type++ {
+			if _type.String() == stop.Type {
+				tabStop := &MtTabStop{_type: _type, offset: stop.Offset}
+				if last == nil {
+					ruler.tabStopList = tabStop
+				} else {
+					last.next = tabStop
+				}
+				last = tabStop
+				ruler.nStops++
+				continue next
+			}
+		}
+		return nil, fmt.Errorf("unknown tab stop type %q", stop.Type)
+	}
+	return ruler, nil
+}
+
+//把partition按每个2 bit打包，rows+1或cols+1个
+func packPartitions(values []int, count int) []byte {
+	parts := make([]byte, (2*count+7)/8)
+	for i, value := range values {
+		if i >= count {
+			break
+		}
+		parts[i/4] |= byte(value&0x03) << (uint(i%4) * 2)
+	}
+	return parts
+}
+
+//JSON格式见jsonEquation
+func (m *MTEFv5) MarshalJSON() ([]byte, error) {
+	eqn := jsonEquation{Header: m.Header(), Objects: []*jsonNode{}}
+	if m.ast != nil {
+		for _, child := range m.ast.children {
+			node, err := m.marshalNode(child)
+			if err != nil {
+				return nil, err
+			}
+			eqn.Objects = append(eqn.Objects, node)
+		}
+	}
+	return json.Marshal(eqn)
+}
+
+func (m *MTEFv5) marshalNode(ast *MtAST) (node *jsonNode, err error) {
+	node = &jsonNode{Record: ast.tag.String()}
+
+	switch value := ast.value.(type) {
+	case *MtLine:
+		node.Null = value.null
+		node.LineSpacing = value.lineSpace
+		node.TabStops = newJSONTabStops(value.ruler)
+		node.Nudge = newJSONNudge(value.nudgeX, value.nudgeY)
+	case *MtChar:
+		options := OptionType(value.options)
+		node.MTCode = value.mtcode
+		node.Char = string(rune(value.mtcode))
+		node.Typeface = int(value.typeface) - 128
+		node.FunctionStart = MtefOptCharFuncStart == MtefOptCharFuncStart&options
+		node.NoMTCode = MtefOptCharEncNoMtcode == MtefOptCharEncNoMtcode&options
+		if MtefOptCharEncChar8 == MtefOptCharEncChar8&options {
+			bits8 := value.bits8
+			node.Bits8 = &bits8
+		}
+		if MtefOptCharEncChar16 == MtefOptCharEncChar16&options {
+			bits16 := value.bits16
+			node.Bits16 = &bits16
+		}
+		for embell := value.embellishments; embell != nil; embell = embell.next {
+			node.Embellishments = append(node.Embellishments, jsonEmbell{
+				Type:  EmbellType(embell.embell).String(),
+				Nudge: newJSONNudge(embell.nudgeX, embell.nudgeY),
+			})
+		}
+		node.Nudge = newJSONNudge(value.nudgeX, value.nudgeY)
+	case *MtTmpl:
+		selector := SelectorType(value.selector)
+		variation := value.variation
+		node.Selector = selector.String()
+		node.Variation = &variation
+		node.Variations = Variation(variation).Names(selector)
+		node.Options = value.options
+		node.Nudge = newJSONNudge(value.nudgeX, value.nudgeY)
+	case *MtPile:
+		node.HAlign = value.halign
+		node.VAlign = value.valign
+		node.TabStops = newJSONTabStops(value.ruler)
+		node.Nudge = newJSONNudge(value.nudgeX, value.nudgeY)
+	case *MtMatrix:
+		node.Rows = value.rows
+		node.Cols = value.cols
+		node.VAlign = value.valign
+		node.HJust = value.h_just
+		node.VJust = value.v_just
+		for _, part := range partitions(value.rowParts, int(value.rows)+1) {
+			node.RowPartitions = append(node.RowPartitions, int(part))
+		}
+		for _, part := range partitions(value.colParts, int(value.cols)+1) {
+			node.ColPartitions = append(node.ColPartitions, int(part))
+		}
+		node.Nudge = newJSONNudge(value.nudgeX, value.nudgeY)
+	case *MtSize:
+		node.LSize = value.lsize
+		node.DSize = value.dsize
+	case *MtColorDefIndex:
+		node.Index = value.index
+	case *MtColorDef:
+		node.Values = value.values
+		node.Name = value.name
+		node.Spot = mtefCOLOR_SPOT == mtefCOLOR_SPOT&value.options
+	case *MtfontStyleDef:
+		node.Font = value.fontDefIndex
+		node.Bold = value.style&fontStyleBold != 0
+		node.Italic = value.style&fontStyleItalic != 0
+	case *MtfontDef:
+		node.Encoding = value.encDefIndex
+		node.Name = value.name
+		if !isASCII([]byte(value.name)) {
+			node.Name = decodeFontName([]byte(value.name), m.EncodingName(value.encDefIndex))
+			node.RawName = []byte(value.name)
+		}
+	case string:
+		node.Name = value
+	case *MtEqnPrefs:
+		node.Options = value.options
+		node.Sizes = value.sizes
+		node.Spacing = value.spaces
+		for _, style := range value.styles {
+			node.Styles = append(node.Styles, jsonStyle{
+				Font:   style.fontDefIndex,
+				Bold:   style.style&fontStyleBold != 0,
+				Italic: style.style&fontStyleItalic != 0,
+			})
+		}
+	case nil:
+		//FULL、SUB、SUB2、SYM、SUBSYM
+	default:
+		return nil, fmt.Errorf("mtef: json: unexpected %v record value %T", ast.tag, value)
+	}
+
+	for _, child := range ast.children {
+		childNode, err := m.marshalNode(child)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, childNode)
+	}
+	return node, nil
+}
+
+//读取MarshalJSON输出的JSON，重新生成公式
+func (m *MTEFv5) UnmarshalJSON(data []byte) (err error) {
+	var eqn jsonEquation
+	if err = json.Unmarshal(data, &eqn); err != nil {
+		return err
+	}
+
+	header := eqn.Header
+	switch header.MtefVersion {
+	case 3, 4, 5:
+	default:
+		return ErrUnsupportedVersion
+	}
+
+	*m = MTEFv5{
+		mMtefVer:     header.MtefVersion,
+		mPlatform:    header.Platform,
+		mProduct:     header.Product,
+		mVersion:     header.Version,
+		mVersionSub:  header.VersionSub,
+		mApplication: header.Application,
+		mInline:      header.Options,
+		RenderNudges: m.RenderNudges,
+		Valid:        true,
+	}
+
+	m.ast = &MtAST{tag: ROOT}
+	return m.unmarshalList(m.ast, eqn.Objects, FULL)
+}
+
+//和parseObjectList一样检查节点的位置，记录定义record和LINE开始时的字号
+func (m *MTEFv5) unmarshalList(parent *MtAST, nodes []*jsonNode, size RecordType) (err error) {
+	for _, node := range nodes {
+		record, ok := RecordType(0), false
+		for tag, name := range recordNames {
+			if name == node.Record {
+				record, ok = tag, true
+				break
+			}
+		}
+		switch record {
+		case END, EMBELL, RULER, ROOT:
+			ok = false
+		}
+		if !ok {
+			return fmt.Errorf("mtef: json record %q: %w", node.Record, ErrUnknownRecord)
+		}
+		if !allowedChild(parent.tag, record) {
+			return fmt.Errorf("mtef: json %v record in %v: %w", record, parent.tag, ErrUnexpectedRecord)
+		}
+
+		ast, err := unmarshalNode(record, node)
+		if err != nil {
+			return fmt.Errorf("mtef: json %v record: %w", record, err)
+		}
+		parent.children = append(parent.children, ast)
+
+		switch value := ast.value.(type) {
+		case *MtLine:
+			value.size = size
+			if !value.null {
+				err = m.unmarshalList(ast, node.Children, size)
+			}
+		case *MtTmpl, *MtPile, *MtMatrix:
+			if err = m.unmarshalList(ast, node.Children, size); err == nil {
+				if err = objectCountError(ast); err != nil {
+					err = fmt.Errorf("mtef: json %v record: %w", record, err)
+				}
+			}
+		default:
+			m.addDef(ast)
+		}
+		if err != nil {
+			return err
+		}
+
+		if _size, ok := ast.typesize(); ok {
+			size = _size
+		}
+	}
+	return nil
+}
+
+func unmarshalNode(record RecordType, node *jsonNode) (ast *MtAST, err error) {
+	ast = &MtAST{tag: record}
+	nudgeX, nudgeY := node.Nudge.values()
+
+	switch record {
+	case LINE:
+		line := &MtLine{nudgeX: nudgeX, nudgeY: nudgeY, lineSpace: node.LineSpacing, null: node.Null}
+		line.ruler, err = parseTabStops(node.TabStops)
+		ast.value = line
+	case CHAR:
+		char := &MtChar{nudgeX: nudgeX, nudgeY: nudgeY, typeface: uint8(node.Typeface + 128), mtcode: node.MTCode}
+		options := OptionType(0)
+		if node.MTCode == 0 && node.Char != "" {
+			char.mtcode = uint16([]rune(node.Char)[0])
+		}
+		if node.FunctionStart {
+			options |= MtefOptCharFuncStart
+		}
+		if node.NoMTCode {
+			options |= MtefOptCharEncNoMtcode
+		}
+		if node.Bits8 != nil {
+			options |= MtefOptCharEncChar8
+			char.bits8 = *node.Bits8
+		}
+		if node.Bits16 != nil {
+			options |= MtefOptCharEncChar16
+			char.bits16 = *node.Bits16
+		}
+		if nudgeX != 0 || nudgeY != 0 {
+			options |= MtefOptNudge
+		}
+
+		var last *MtEmbell
+		for _, embell := range node.Embellishments {
+			embellType, ok := EmbellType(0), false
+			for _type, name := range embellNames {
+				if name == embell.Type {
+					embellType, ok = _type, true
+					break
+				}
+			}
+			if !ok {
+				return nil, fmt.Errorf("unknown embellishment %q", embell.Type)
+			}
+
+			mtEmbell := &MtEmbell{embell: uint8(embellType)}
+			mtEmbell.nudgeX, mtEmbell.nudgeY = embell.Nudge.values()
+			if last == nil {
+				char.embellishments = mtEmbell
+			} else {
+				last.next = mtEmbell
+			}
+			last = mtEmbell
+			options |= MtefOptCharEmbell
+		}
+
+		char.options = uint8(options)
+		ast.value = char
+	case TMPL:
+		selector, ok := SelectorType(0), false
+		for idx, name := range selectorNames {
+			if name == node.Selector {
+				selector, ok = SelectorType(idx), true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown selector %q", node.Selector)
+		}
+
+		tmpl := &MtTmpl{nudgeX: nudgeX, nudgeY: nudgeY, selector: uint8(selector), options: node.Options}
+		if node.Variation != nil {
+			tmpl.variation = *node.Variation
+		} else {
+			var variation Variation
+			variation, err = parseVariation(selector, node.Variations)
+			tmpl.variation = uint16(variation)
+		}
+		ast.value = tmpl
+	case PILE:
+		pile := &MtPile{nudgeX: nudgeX, nudgeY: nudgeY, halign: node.HAlign, valign: node.VAlign}
+		pile.ruler, err = parseTabStops(node.TabStops)
+		ast.value = pile
+	case MATRIX:
+		ast.value = &MtMatrix{
+			nudgeX:   nudgeX,
+			nudgeY:   nudgeY,
+			valign:   node.VAlign,
+			h_just:   node.HJust,
+			v_just:   node.VJust,
+			rows:     node.Rows,
+			cols:     node.Cols,
+			rowParts: packPartitions(node.RowPartitions, int(node.Rows)+1),
+			colParts: packPartitions(node.ColPartitions, int(node.Cols)+1),
+		}
+	case SIZE:
+		ast.value = &MtSize{lsize: node.LSize, dsize: node.DSize}
+	case COLOR:
+		ast.value = &MtColorDefIndex{index: node.Index}
+	case COLOR_DEF:
+		if len(node.Values) != 3 && len(node.Values) != 4 {
+			return nil, fmt.Errorf("color needs 3 (RGB) or 4 (CMYK) values, got %d", len(node.Values))
+		}
+		colorDef := &MtColorDef{values: node.Values, name: node.Name}
+		if node.Spot {
+			colorDef.options = mtefCOLOR_SPOT
+		}
+		ast.value = colorDef
+	case FONT_STYLE_DEF:
+		ast.value = &MtfontStyleDef{fontDefIndex: node.Font, style: jsonStyle{node.Font, node.Bold, node.Italic}.style()}
+	case FONT_DEF:
+		name := node.Name
+		if node.RawName != nil {
+			name = string(node.RawName)
+		}
+		ast.value = &MtfontDef{encDefIndex: node.Encoding, name: name}
+	case ENCODING_DEF:
+		ast.value = node.Name
+	case EQN_PREFS:
+		prefs := &MtEqnPrefs{options: node.Options, sizes: node.Sizes, spaces: node.Spacing}
+		for _, style := range node.Styles {
+			prefs.styles = append(prefs.styles, MtfontStyleDef{fontDefIndex: style.Font, style: style.style()})
+		}
+		ast.value = prefs
+	}
+
+	return ast, err
+}
+
+func (s jsonStyle) style() (style uint8) {
+	if s.Bold {
+		style |= fontStyleBold
+	}
+	if s.Italic {
+		style |= fontStyleItalic
+	}
+	return style
+}
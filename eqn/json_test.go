@@ -0,0 +1,159 @@
+package eqn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//JSON的header和最外层的record和公式一样，读回来再写成MTEF数据不变
+func TestJSONFixtures(t *testing.T) {
+	for _, file := range []string{"oleObject1.bin", "oleObject2.bin", "oleObject3.bin", "oleObject4.bin", "oleObject5.bin"} {
+		eqn := openFixture(t, file)
+		data, err := eqn.MarshalJSON()
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+
+		var decoded struct {
+			Header  Header
+			Objects []struct{ Record string }
+		}
+		if err = json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		if decoded.Header != eqn.Header() {
+			t.Errorf("%v: JSON header = %+v, want %+v", file, decoded.Header, eqn.Header())
+		}
+		var records []string
+		for _, object := range decoded.Objects {
+			records = append(records, object.Record)
+		}
+		var want []string
+		for _, node := range eqn.Objects() {
+			want = append(want, node.Record().String())
+		}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("%v: JSON records = %v, want %v", file, records, want)
+		}
+
+		checkJSONRoundTrip(t, file, eqn, data)
+	}
+}
+
+func checkJSONRoundTrip(t *testing.T, name string, eqn *MTEFv5, data []byte) {
+	t.Helper()
+	mtef, err := eqn.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	decoded := new(MTEFv5)
+	if err = decoded.UnmarshalJSON(data); err != nil {
+		t.Fatalf("%v: UnmarshalJSON: %v", name, err)
+	}
+	again, err := decoded.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	if !bytes.Equal(again, mtef) {
+		t.Errorf("%v: MTEF data changed after JSON:\n%x\n%x", name, again, mtef)
+	}
+}
+
+//字号、颜色和定义record也写进JSON
+func TestJSONStyleRecords(t *testing.T) {
+	eqn, err := OpenMTEF(bytes.NewReader(styledData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := eqn.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`{"record":"COLOR_DEF","values":[65535,0,0]}`,
+		`{"record":"COLOR_DEF","values":[0,0,65535,0],"name":"blue"}`,
+		`{"record":"FONT_STYLE_DEF","font":1,"italic":true}`,
+		`{"record":"SIZE","lsize":101,"dsize":336}`,
+		`{"record":"COLOR","index":1}`,
+		`{"record":"TMPL","selector":"fraction","variation":0,"children":[{"record":"SUB"},`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON %s does not contain %s", data, want)
+		}
+	}
+	checkJSONRoundTrip(t, "styled", eqn, data)
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	//没有variation的时候按variations的名字组合，char可以代替mtcode
+	data := `{"header": {"mtefVersion": 5}, "objects": [{"record": "LINE", "children": [
+		{"record": "TMPL", "selector": "root", "variations": ["nth"], "children": [
+			{"record": "LINE", "children": [{"record": "CHAR", "char": "x", "typeface": 3, "embellishments": [{"type": "hat", "nudge": {"x": 1, "y": -2}}]}]},
+			{"record": "LINE", "children": [{"record": "CHAR", "char": "3", "typeface": 8}]}
+		]}
+	]}]}`
+	eqn := new(MTEFv5)
+	if err := eqn.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	root := eqn.Objects()[0].Children()[0].(*Template)
+	if root.Selector() != SelectorRoot || !root.Variation().Has(VariationRootNth) {
+		t.Errorf("TMPL %v variation %#x, want nth root", root.Selector(), uint16(root.Variation()))
+	}
+	x := root.Radicand().Children()[0].(*Char)
+	if embells := x.Embellishments(); x.Rune() != 'x' || !reflect.DeepEqual(embells, []Embellishment{{embHAT, 1, -2}}) {
+		t.Errorf("CHAR %q embellishments %+v, want x with nudged hat", x.Rune(), embells)
+	}
+	if latex, err := eqn.Translate(); err != nil || latex != `$$ \sqrt[3] { \hat{ x } } $$` {
+		t.Errorf("Translate() = %q, %v", latex, err)
+	}
+
+	errorTests := []struct {
+		data string
+		err  error
+	}{
+		{`{"header": {"mtefVersion": 6}}`, ErrUnsupportedVersion},
+		{`{"header": {"mtefVersion": 5}, "objects": [{"record": "EMBELL"}]}`, ErrUnknownRecord},
+		{`{"header": {"mtefVersion": 5}, "objects": [{"record": "LINE", "children": [{"record": "LINE"}]}]}`, ErrUnexpectedRecord},
+		{`{"header": {"mtefVersion": 5}, "objects": [{"record": "LINE", "children": [{"record": "TMPL", "selector": "fraction", "children": [{"record": "LINE"}]}]}]}`, ErrObjectCount},
+	}
+	for _, test := range errorTests {
+		if err := new(MTEFv5).UnmarshalJSON([]byte(test.data)); !errors.Is(err, test.err) {
+			t.Errorf("UnmarshalJSON(%s): %v, want %v", test.data, err, test.err)
+		}
+	}
+	for _, data := range []string{
+		`{"header": {"mtefVersion": 5}, "objects": [{"record": "LINE", "children": [{"record": "TMPL", "selector": "root", "variations": ["slash"]}]}]}`,
+		`{"header": {"mtefVersion": 5}, "objects": [{"record": "LINE", "children": [{"record": "CHAR", "embellishments": [{"type": "hats"}]}]}]}`,
+	} {
+		if err := new(MTEFv5).UnmarshalJSON([]byte(data)); err == nil {
+			t.Errorf("UnmarshalJSON(%s): no error", data)
+		}
+	}
+}
+
+func TestVariationNames(t *testing.T) {
+	tests := []struct {
+		selector  SelectorType
+		variation Variation
+		names     []string
+	}{
+		{tmPAREN, VariationFenceLeft | VariationFenceRight, []string{"left", "right"}},
+		{tmINTEG, Variation(tvINT_2 | tvINT_LOOP | tvBO_LOWER), []string{"double", "loop", "lower"}},
+		{tmINTERVAL, Variation(tvINTV_LEFT_LB | tvINTV_RIGHT_RP), []string{"leftLBracket", "rightRParen"}},
+		{tmFRACT, 0, nil},
+	}
+	for _, test := range tests {
+		names := test.variation.Names(test.selector)
+		if !reflect.DeepEqual(names, test.names) {
+			t.Errorf("%#x.Names(%v) = %v, want %v", uint16(test.variation), test.selector, names, test.names)
+		}
+		if v, err := parseVariation(test.selector, names); err != nil || v != test.variation {
+			t.Errorf("parseVariation(%v, %v) = %#x, %v", test.selector, names, uint16(v), err)
+		}
+	}
+}
@@ -0,0 +1,917 @@
+package eqn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//LaTeX转换成MTEF，和Translate相反：
+//	字母、数字、运算符和\alpha、\le这样的命令转成CHAR，命令按Chars反查mtcode
+//	\frac、\sqrt、上下标、\sum \int \lim、\left \right、重音转成TMPL或者CHAR的embellishment
+//	matrix、pmatrix、array、cases、aligned环境转成MATRIX和PILE
+//节点的结构见builder.go，只支持公式里常用的部分，遇到不认识的命令返回LatexError
+
+var (
+	latexTablesOnce sync.Once
+
+	//命令对应的mtcode，从Chars和SpecialChar反查得到
+	latexSymbols map[string]uint16
+
+	//只有一个字符的时候用的embellishment，从embellFormats反查得到
+	latexEmbells map[string]EmbellType
+)
+
+//Chars里有多个mtcode的命令，或者Chars里没有的常用写法
+var latexSymbolAliases = map[string]uint16{
+	"\\cdot":       0x22c5,
+	"\\rightarrow": 0x2192,
+	"\\gets":       0x2190,
+	"\\leq":        0x2264,
+	"\\geq":        0x2265,
+	"\\neq":        0x2260,
+	"\\lnot":       0x00ac,
+	"\\vert":       0x007c,
+	"\\Vert":       0x2016,
+	"\\lbrace":     0x007b,
+	"\\rbrace":     0x007d,
+	"\\lbrack":     0x005b,
+	"\\rbrack":     0x005d,
+}
+
+var latexEmbellAliases = map[string]EmbellType{
+	"\\overline":  embOBAR,
+	"\\widehat":   embHAT,
+	"\\widetilde": embTILDE,
+	"\\vec":       embRARROW,
+}
+
+//参数不止一个字符时用的template，HatBoxClass的template后面跟着重音字符
+var latexAccentTemplates = map[string]struct {
+	selector  SelectorType
+	variation uint16
+	char      uint16
+}{
+	"\\overline":           {tmOBAR, 0, 0},
+	"\\underline":          {tmUBAR, 0, 0},
+	"\\hat":                {tmHAT, 0, 0x02c6},
+	"\\widehat":            {tmHAT, 0, 0x02c6},
+	"\\tilde":              {tmTILDE, 0, 0x02dc},
+	"\\widetilde":          {tmTILDE, 0, 0x02dc},
+	"\\overparen":          {tmARC, 0, 0x2322},
+	"\\vec":                {tmVEC, tvVE_RIGHT, 0x20d7},
+	"\\overrightarrow":     {tmVEC, tvVE_RIGHT, 0x20d7},
+	"\\overleftarrow":      {tmVEC, tvVE_LEFT, 0x20d6},
+	"\\overleftrightarrow": {tmVEC, tvVE_LEFT | tvVE_RIGHT, 0x20e1},
+}
+
+//matrix环境外面的定界符
+var latexMatrixFences = map[string][2]uint16{
+	"matrix":  {0, 0},
+	"pmatrix": {'(', ')'},
+	"bmatrix": {'[', ']'},
+	"Bmatrix": {'{', '}'},
+	"vmatrix": {'|', '|'},
+	"Vmatrix": {0x2016, 0x2016},
+}
+
+//用fnFUNCTION输出的函数名，latexLimitFunctions后面跟下标的时候转成tmLIM
+var latexFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true, "tanh": true, "coth": true,
+	"log": true, "ln": true, "lg": true, "exp": true, "det": true, "dim": true, "ker": true, "deg": true,
+	"gcd": true, "hom": true, "arg": true, "Pr": true,
+}
+
+var latexLimitFunctions = map[string]bool{
+	"lim": true, "limsup": true, "liminf": true, "max": true, "min": true, "sup": true, "inf": true,
+}
+
+//只影响字号和间距的命令，转换的时候忽略
+var latexIgnored = map[string]bool{
+	"\\displaystyle": true, "\\textstyle": true, "\\scriptstyle": true, "\\scriptscriptstyle": true,
+	"\\big": true, "\\Big": true, "\\bigg": true, "\\Bigg": true,
+	"\\bigl": true, "\\Bigl": true, "\\biggl": true, "\\Biggl": true,
+	"\\bigr": true, "\\Bigr": true, "\\biggr": true, "\\Biggr": true,
+}
+
+func buildLatexTables() {
+	latexSymbols = make(map[string]uint16)
+	for key, value := range Chars {
+		//"\\alpha "这样的值后面有一个空格，"\\ "本身就是命令
+		name := value
+		if len(name) > 2 {
+			name = strings.TrimSuffix(name, " ")
+		}
+		if !isLatexCommand(name) {
+			continue
+		}
+
+		code, err := strconv.ParseUint(key[len("char/0x"):len("char/0x")+4], 16, 16)
+		if err != nil {
+			continue
+		}
+		if old, ok := latexSymbols[name]; !ok || preferCode(uint16(code), old) {
+			latexSymbols[name] = uint16(code)
+		}
+	}
+
+	//SpecialChar里只有这些是LaTeX需要转义的字符
+	for char, escaped := range SpecialChar {
+		if strings.Contains("#$%&_{}", char) {
+			latexSymbols[escaped] = uint16(char[0])
+		}
+	}
+	for name, code := range latexSymbolAliases {
+		latexSymbols[name] = code
+	}
+
+	//"\\hat{ %v }"这样只包一层命令的格式
+	latexEmbells = make(map[string]EmbellType)
+	for embell, format := range embellFormats {
+		name := strings.TrimSuffix(format, "{ %v }")
+		if name != format && isLatexCommand(name) {
+			latexEmbells[name] = embell
+		}
+	}
+	for name, embell := range latexEmbellAliases {
+		latexEmbells[name] = embell
+	}
+}
+
+func latexSymbol(name string) (uint16, bool) {
+	latexTablesOnce.Do(buildLatexTables)
+	code, ok := latexSymbols[name]
+	return code, ok
+}
+
+func latexEmbell(name string) (EmbellType, bool) {
+	latexTablesOnce.Do(buildLatexTables)
+	embell, ok := latexEmbells[name]
+	return embell, ok
+}
+
+//\加上字母，或者\加上一个其他字符
+func isLatexCommand(name string) bool {
+	runes := []rune(name)
+	if len(runes) < 2 || runes[0] != '\\' {
+		return false
+	}
+	if len(runes) == 2 && !isLatexLetter(runes[1]) {
+		return true
+	}
+	for _, r := range runes[1:] {
+		if !isLatexLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLatexLetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+//同一个命令有多个mtcode时，优先MathType的空格（0xEFxx），其次不是私有区的，最后取小的
+func preferCode(code uint16, old uint16) bool {
+	isSpace := func(c uint16) bool { return c&0xff00 == 0xef00 }
+	isPrivate := func(c uint16) bool { return c >= 0xe000 && c <= 0xf8ff }
+
+	if isSpace(code) != isSpace(old) {
+		return isSpace(code)
+	}
+	if isPrivate(code) != isPrivate(old) {
+		return !isPrivate(code)
+	}
+	return code < old
+}
+
+//把LaTeX公式转换成MTEF，外面的$$、$、\[ \]、\( \)可以省略，
+//多行（\\分隔）的公式转换成PILE，有&的时候按关系符对齐
+func ParseLatex(latex string) (*MTEFv5, error) {
+	src := strings.TrimSpace(latex)
+	base := strings.Index(latex, src)
+	for _, delims := range [][2]string{{"$$", "$$"}, {"\\[", "\\]"}, {"\\(", "\\)"}, {"$", "$"}} {
+		if len(src) >= len(delims[0])+len(delims[1]) && strings.HasPrefix(src, delims[0]) && strings.HasSuffix(src, delims[1]) {
+			src = src[len(delims[0]) : len(src)-len(delims[1])]
+			base += len(delims[0])
+			break
+		}
+	}
+
+	p := &latexParser{treeBuilder: treeBuilder{size: FULL}, src: []rune(src), base: base}
+	rows, _, err := p.parseRows()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != 0 {
+		return nil, p.errorf(ErrLatexSyntax, "unexpected %q", p.src[p.pos])
+	}
+
+	if len(rows) == 1 && len(rows[0]) == 1 {
+		return New(&Line{rows[0][0]}), nil
+	}
+	if hasColumns(rows) {
+		return New(&Pile{p.pile(rows, alignRelational)}), nil
+	}
+	return New(&Pile{p.pile(rows, alignLeft)}), nil
+}
+
+type latexParser struct {
+	treeBuilder
+
+	src  []rune
+	pos  int
+	base int
+
+	//在\sqrt[]里面的时候]是结束符
+	optional int
+}
+
+func (p *latexParser) errorf(err error, format string, args ...interface{}) error {
+	offset := p.base + len(string(p.src[:p.pos]))
+	return &LatexError{Offset: offset, Err: fmt.Errorf("%w: "+format, append([]interface{}{err}, args...)...)}
+}
+
+//跳过空格和%注释
+func (p *latexParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case unicode.IsSpace(p.src[p.pos]):
+			p.pos++
+		case p.src[p.pos] == '%':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+//下一个字符，结束的时候返回0
+func (p *latexParser) peek() rune {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+//下一个命令（包括\），不是命令的时候返回空字符串
+func (p *latexParser) peekCommand() string {
+	if p.peek() != '\\' {
+		return ""
+	}
+
+	end := p.pos + 1
+	for end < len(p.src) && isLatexLetter(p.src[end]) {
+		end++
+	}
+	if end == p.pos+1 && end < len(p.src) {
+		end++
+	}
+	return string(p.src[p.pos:end])
+}
+
+func (p *latexParser) readCommand() string {
+	name := p.peekCommand()
+	p.pos += len([]rune(name))
+	return name
+}
+
+func (p *latexParser) expect(r rune) error {
+	if p.peek() != r {
+		return p.errorf(ErrLatexSyntax, "missing %q", r)
+	}
+	p.pos++
+	return nil
+}
+
+//{}里面的原始文本，\text和环境名使用
+func (p *latexParser) readGroupText() (string, error) {
+	if err := p.expect('{'); err != nil {
+		return "", err
+	}
+
+	start, depth := p.pos, 0
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos++
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				text := string(p.src[start:p.pos])
+				p.pos++
+				return text, nil
+			}
+			depth--
+		}
+	}
+	return "", p.errorf(ErrLatexSyntax, "missing %q", '}')
+}
+
+//当前的object list是否结束
+func (p *latexParser) atEnd() bool {
+	switch p.peek() {
+	case 0, '}', '&':
+		return true
+	case ']':
+		return p.optional > 0
+	}
+
+	switch p.peekCommand() {
+	case "\\\\", "\\cr", "\\end", "\\right", "\\hline":
+		return true
+	}
+	return false
+}
+
+func (p *latexParser) atRelation() bool {
+	r := p.peek()
+	if r == '\\' {
+		code, ok := latexSymbol(p.peekCommand())
+		return ok && relationCodes[code]
+	}
+	return r <= 0xffff && relationCodes[uint16(r)]
+}
+
+func (p *latexParser) parseList(line *MtAST) error {
+	for !p.atEnd() {
+		if err := p.parseAtom(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//{}里面的内容，]不再是结束符
+func (p *latexParser) parseGroup(line *MtAST) error {
+	if err := p.expect('{'); err != nil {
+		return err
+	}
+
+	optional := p.optional
+	p.optional = 0
+	defer func() { p.optional = optional }()
+
+	if err := p.parseList(line); err != nil {
+		return err
+	}
+	return p.expect('}')
+}
+
+//命令的参数，{}或者单个字符、命令
+func (p *latexParser) parseArg() (*MtAST, error) {
+	line := p.newLine()
+	if p.peek() == '{' {
+		if err := p.parseGroup(line); err != nil {
+			return nil, err
+		}
+		return finishLine(line), nil
+	}
+
+	if p.atEnd() || p.peek() == '^' || p.peek() == '_' {
+		return nil, p.errorf(ErrLatexSyntax, "missing argument")
+	}
+	nodes, err := p.parseBase()
+	if err != nil {
+		return nil, err
+	}
+	line.children = nodes
+	return finishLine(line), nil
+}
+
+//上下标、极限用小一号的字
+func (p *latexParser) parseSmallArg() (arg *MtAST, err error) {
+	err = p.smaller(func() error {
+		arg, err = p.parseArg()
+		return err
+	})
+	return arg, err
+}
+
+//一个元素和它后面的'、上下标
+func (p *latexParser) parseAtom(line *MtAST) error {
+	nodes, err := p.parseBase()
+	if err != nil {
+		return err
+	}
+	line.children = append(line.children, nodes...)
+	return p.parseScripts(line)
+}
+
+func (p *latexParser) parseScripts(line *MtAST) (err error) {
+	var sub, sup *MtAST
+	for {
+		switch p.peek() {
+		case '\'':
+			p.pos++
+			//前面是字符的时候是prime embellishment，已经有上下标的时候放到上标里
+			if sub == nil && sup == nil && len(line.children) > 0 {
+				if char, ok := line.children[len(line.children)-1].value.(*MtChar); ok {
+					addEmbell(char, emb1PRIME)
+					continue
+				}
+			}
+			prime := charNode(0x2032, fnSYMBOL)
+			switch {
+			case sub == nil && sup == nil:
+				line.children = append(line.children, prime)
+			case sup == nil:
+				sup = &MtAST{LINE, &MtLine{size: smallerSize(p.size)}, []*MtAST{prime}}
+			default:
+				return p.errorf(ErrLatexSyntax, "double superscript")
+			}
+			continue
+		case '_':
+			if sub != nil {
+				return p.errorf(ErrLatexSyntax, "double subscript")
+			}
+			p.pos++
+			if sub, err = p.parseSmallArg(); err != nil {
+				return err
+			}
+			continue
+		case '^':
+			if sup != nil {
+				return p.errorf(ErrLatexSyntax, "double superscript")
+			}
+			p.pos++
+			if sup, err = p.parseSmallArg(); err != nil {
+				return err
+			}
+			continue
+		}
+		break
+	}
+
+	if sub == nil && sup == nil {
+		return nil
+	}
+
+	line.children = append(line.children, p.script(sub, sup))
+	return nil
+}
+
+//一个元素：{}、命令或者字符，返回要加到LINE里的节点
+func (p *latexParser) parseBase() ([]*MtAST, error) {
+	r := p.peek()
+	switch r {
+	case '{':
+		//{}只是分组，里面的内容直接放到外面的LINE里
+		line := p.newLine()
+		if err := p.parseGroup(line); err != nil {
+			return nil, err
+		}
+		return line.children, nil
+	case '\\':
+		return p.parseCommand()
+	case '^', '_', '\'':
+		//没有底数的上下标
+		return nil, nil
+	case '~':
+		p.pos++
+		return []*MtAST{charNode(0xef04, fnSPACE)}, nil
+	case '#', '$':
+		return nil, p.errorf(ErrLatexSyntax, "unexpected %q", r)
+	}
+
+	if r > 0xffff {
+		return nil, p.errorf(ErrLatexSyntax, "character %q outside of the BMP", r)
+	}
+	p.pos++
+
+	code := uint16(r)
+	if r == '-' {
+		code = 0x2212
+	}
+	return []*MtAST{charNode(code, defaultTypeface(code))}, nil
+}
+
+func (p *latexParser) parseCommand() ([]*MtAST, error) {
+	start := p.pos
+	name := p.readCommand()
+
+	switch name {
+	case "\\frac", "\\dfrac", "\\tfrac":
+		num, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		den, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		return []*MtAST{tmplNode(tmFRACT, 0, num, den)}, nil
+	case "\\sqrt":
+		return p.parseRoot()
+	case "\\left":
+		return p.parseFence()
+	case "\\begin":
+		return p.parseEnvironment()
+	case "\\text", "\\textrm", "\\mbox":
+		return p.parseText()
+	case "\\operatorname":
+		text, err := p.readGroupText()
+		if err != nil {
+			return nil, err
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			return nil, p.errorf(ErrLatexSyntax, "missing argument")
+		}
+		return functionNodes(text), nil
+	case "\\mathrm", "\\mathbf", "\\boldsymbol":
+		arg, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		//正体用fnTEXT，粗体用fnVECTOR（MathType的Vector-Matrix样式）
+		typeface := fnVECTOR
+		if name == "\\mathrm" {
+			typeface = fnTEXT
+		}
+		retypeface(arg, fnVARIABLE, typeface)
+		return arg.children, nil
+	}
+
+	if latexIgnored[name] {
+		return nil, nil
+	}
+	if code, ok := latexSymbol(name); ok {
+		if _, ok := bigOperators[code]; ok {
+			return p.parseBigOp(code)
+		}
+	}
+
+	function := strings.TrimPrefix(name, "\\")
+	if latexLimitFunctions[function] {
+		return p.parseLimit(function)
+	}
+	if latexFunctions[function] {
+		return functionNodes(function), nil
+	}
+
+	_, isTmpl := latexAccentTemplates[name]
+	if _, isEmbell := latexEmbell(name); isTmpl || isEmbell {
+		return p.parseAccent(name)
+	}
+
+	if code, ok := latexSymbol(name); ok {
+		return []*MtAST{charNode(code, defaultTypeface(code))}, nil
+	}
+
+	p.pos = start
+	return nil, p.errorf(ErrUnknownCommand, "%v", name)
+}
+
+//\sqrt{x}和\sqrt[n]{x}，slot是被开方数和次数
+func (p *latexParser) parseRoot() ([]*MtAST, error) {
+	var index *MtAST
+	if p.peek() == '[' {
+		p.pos++
+		p.optional++
+		err := p.smaller(func() error {
+			index = p.newLine()
+			return p.parseList(index)
+		})
+		p.optional--
+
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(']'); err != nil {
+			return nil, err
+		}
+		if finishLine(index).value.(*MtLine).null {
+			index = nil
+		}
+	}
+
+	radicand, err := p.parseArg()
+	if err != nil {
+		return nil, err
+	}
+
+	if index == nil {
+		return []*MtAST{tmplNode(tmROOT, tvROOT_SQ, radicand, finishLine(p.newLine()))}, nil
+	}
+	return []*MtAST{tmplNode(tmROOT, tvROOT_NTH, radicand, &MtAST{smallerSize(p.size), nil, nil}, index)}, nil
+}
+
+//\hat{x}这样的重音，参数是一个字符的时候加embellishment，否则用template
+func (p *latexParser) parseAccent(name string) ([]*MtAST, error) {
+	start := p.pos
+	arg, err := p.parseArg()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(arg.children) == 1 {
+		char, isChar := arg.children[0].value.(*MtChar)
+		if embell, ok := latexEmbell(name); ok && isChar {
+			addEmbell(char, embell)
+			return arg.children, nil
+		}
+	}
+
+	accent, ok := latexAccentTemplates[name]
+	if !ok {
+		p.pos = start
+		return nil, p.errorf(ErrLatexSyntax, "%v needs a single character", name)
+	}
+	if accent.char == 0 {
+		return []*MtAST{tmplNode(accent.selector, accent.variation, arg)}, nil
+	}
+	return []*MtAST{tmplNode(accent.selector, accent.variation, arg, charNode(accent.char, fnMTEXTRA))}, nil
+}
+
+//大型运算符，main slot一直到关系符号或者结束
+func (p *latexParser) parseBigOp(code uint16) ([]*MtAST, error) {
+	variation := uint16(0)
+	if bigOperators[code].limits {
+		variation = tvBO_SUM
+	}
+
+	lower, upper, variation, err := p.parseLimits(variation)
+	if err != nil {
+		return nil, err
+	}
+
+	main := p.newLine()
+	for !p.atEnd() && !p.atRelation() {
+		if err = p.parseAtom(main); err != nil {
+			return nil, err
+		}
+	}
+	return []*MtAST{p.bigOp(code, variation, main, lower, upper)}, nil
+}
+
+//\lim、\max这样的函数，后面有下标的时候转成tmLIM
+func (p *latexParser) parseLimit(function string) ([]*MtAST, error) {
+	lower, upper, _, err := p.parseLimits(0)
+	if err != nil {
+		return nil, err
+	}
+	if lower == nil && upper == nil {
+		return functionNodes(function), nil
+	}
+	return []*MtAST{p.limit(functionNodes(function), lower, upper)}, nil
+}
+
+//运算符后面的\limits、\nolimits和上下限
+func (p *latexParser) parseLimits(variation uint16) (lower *MtAST, upper *MtAST, _ uint16, err error) {
+	for {
+		switch p.peekCommand() {
+		case "\\limits":
+			p.readCommand()
+			variation |= tvBO_SUM
+			continue
+		case "\\nolimits":
+			p.readCommand()
+			variation &^= tvBO_SUM
+			continue
+		}
+
+		switch {
+		case p.peek() == '_' && lower == nil:
+			p.pos++
+			if lower, err = p.parseSmallArg(); err != nil {
+				return nil, nil, 0, err
+			}
+			continue
+		case p.peek() == '^' && upper == nil:
+			p.pos++
+			if upper, err = p.parseSmallArg(); err != nil {
+				return nil, nil, 0, err
+			}
+			continue
+		}
+		return lower, upper, variation, nil
+	}
+}
+
+//\left ... \right
+func (p *latexParser) parseFence() ([]*MtAST, error) {
+	left, err := p.parseDelimiter()
+	if err != nil {
+		return nil, err
+	}
+
+	optional := p.optional
+	p.optional = 0
+	main := p.newLine()
+	err = p.parseList(main)
+	p.optional = optional
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peekCommand() != "\\right" {
+		return nil, p.errorf(ErrLatexSyntax, "missing \\right")
+	}
+	p.readCommand()
+
+	right, err := p.parseDelimiter()
+	if err != nil {
+		return nil, err
+	}
+	return fenceNodes(finishLine(main), left, right), nil
+}
+
+//定界符的mtcode，\left.和\right.返回0
+func (p *latexParser) parseDelimiter() (uint16, error) {
+	switch r := p.peek(); r {
+	case 0:
+		return 0, p.errorf(ErrLatexSyntax, "missing delimiter")
+	case '.':
+		p.pos++
+		return 0, nil
+	case '<':
+		p.pos++
+		return 0x2329, nil
+	case '>':
+		p.pos++
+		return 0x232a, nil
+	case '\\':
+		start := p.pos
+		name := p.readCommand()
+		if code, ok := latexSymbol(name); ok {
+			return code, nil
+		}
+		p.pos = start
+		return 0, p.errorf(ErrLatexSyntax, "invalid delimiter %v", name)
+	default:
+		if r > 0xffff {
+			return 0, p.errorf(ErrLatexSyntax, "invalid delimiter %q", r)
+		}
+		p.pos++
+		return uint16(r), nil
+	}
+}
+
+//\begin{...} ... \end{...}
+func (p *latexParser) parseEnvironment() ([]*MtAST, error) {
+	start := p.pos
+	name, err := p.readGroupText()
+	if err != nil {
+		return nil, err
+	}
+
+	_, isMatrix := latexMatrixFences[name]
+	switch name {
+	case "array", "cases", "aligned", "align", "align*", "split", "gathered", "gather", "gather*":
+	default:
+		if !isMatrix {
+			p.pos = start
+			return nil, p.errorf(ErrUnknownCommand, "environment %v", name)
+		}
+	}
+
+	var spec string
+	if name == "array" {
+		if spec, err = p.readGroupText(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, rowParts, err := p.parseRows()
+	if err != nil {
+		return nil, err
+	}
+	if p.peekCommand() != "\\end" {
+		return nil, p.errorf(ErrLatexSyntax, "missing \\end{%v}", name)
+	}
+	p.readCommand()
+	if end, err := p.readGroupText(); err != nil || end != name {
+		return nil, p.errorf(ErrLatexSyntax, "\\begin{%v} ended by \\end{%v}", name, end)
+	}
+
+	halign, colParts := alignCenter, []int(nil)
+	switch name {
+	case "array":
+		halign, colParts = parseColumnSpec(spec)
+	case "cases":
+		//一列的时候是左对齐的PILE
+		halign = alignLeft
+		if !hasColumns(rows) {
+			return fenceNodes(&MtAST{LINE, &MtLine{size: p.size}, []*MtAST{p.pile(rows, alignLeft)}}, '{', 0), nil
+		}
+	case "aligned", "align", "align*", "split":
+		return []*MtAST{p.pile(rows, alignRelational)}, nil
+	case "gathered", "gather", "gather*":
+		return []*MtAST{p.pile(rows, alignCenter)}, nil
+	}
+
+	matrix, ok := p.matrix(rows, halign, rowParts, colParts)
+	if !ok {
+		return nil, p.errorf(ErrLatexSyntax, "matrix too large")
+	}
+
+	fences := latexMatrixFences[name]
+	if name == "cases" {
+		fences = [2]uint16{'{', 0}
+	}
+	if fences[0] == 0 {
+		return []*MtAST{matrix}, nil
+	}
+	return fenceNodes(&MtAST{LINE, &MtLine{size: p.size}, []*MtAST{matrix}}, fences[0], fences[1]), nil
+}
+
+//是否有一行不止一个单元格
+func hasColumns(rows [][]*MtAST) bool {
+	for _, row := range rows {
+		if len(row) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+//\\分隔的行和&分隔的单元格，每个单元格是一个LINE，rowParts记录\hline的位置
+func (p *latexParser) parseRows() (rows [][]*MtAST, rowParts []int, err error) {
+	var row []*MtAST
+	for {
+		for len(row) == 0 && p.peekCommand() == "\\hline" {
+			p.readCommand()
+			for len(rowParts) <= len(rows) {
+				rowParts = append(rowParts, 0)
+			}
+			rowParts[len(rows)] = 1
+		}
+
+		cell := p.newLine()
+		if err = p.parseList(cell); err != nil {
+			return nil, nil, err
+		}
+		row = append(row, finishLine(cell))
+
+		if p.peek() == '&' {
+			p.pos++
+			continue
+		}
+		if command := p.peekCommand(); command == "\\\\" || command == "\\cr" {
+			p.readCommand()
+			rows = append(rows, row)
+			row = nil
+			continue
+		}
+		break
+	}
+
+	//最后一行后面的\\不算新的一行
+	if len(rows) == 0 || len(row) > 1 || !row[0].value.(*MtLine).null {
+		rows = append(rows, row)
+	}
+	return rows, rowParts, nil
+}
+
+//array的列格式，比如{c|cc}，|是列之间的分隔线，对齐方式取第一列的
+func parseColumnSpec(spec string) (halign uint8, colParts []int) {
+	halign = alignCenter
+	col := 0
+	for _, r := range spec {
+		switch r {
+		case '|':
+			for len(colParts) <= col {
+				colParts = append(colParts, 0)
+			}
+			colParts[col] = 1
+		case 'l', 'c', 'r':
+			if col == 0 {
+				halign = map[rune]uint8{'l': alignLeft, 'c': alignCenter, 'r': alignRight}[r]
+			}
+			col++
+		}
+	}
+	return halign, colParts
+}
+
+//\text{...}里面的字符都用fnTEXT，空格保留
+func (p *latexParser) parseText() ([]*MtAST, error) {
+	text, err := p.readGroupText()
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []*MtAST
+	escaped := false
+	for _, r := range text {
+		switch {
+		case r == '\\' && !escaped:
+			escaped = true
+			continue
+		case (r == '{' || r == '}') && !escaped:
+			continue
+		case r > 0xffff:
+			return nil, p.errorf(ErrLatexSyntax, "character %q outside of the BMP", r)
+		}
+		escaped = false
+		nodes = append(nodes, charNode(uint16(r), fnTEXT))
+	}
+	return nodes, nil
+}
@@ -0,0 +1,152 @@
+package eqn
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+//ParseLatex建出来的公式再Translate，输出是LaTeX的标准写法
+func TestParseLatex(t *testing.T) {
+	tests := []struct {
+		latex string
+		want  string
+	}{
+		{`\frac{a}{b}`, `$$ \frac { a } { b } $$`},
+		{`\frac{1}{\frac{1}{2}}`, `$$ \frac { 1 } { \frac { 1 } { 2 } } $$`},
+		{`\sqrt{x}`, `$$ \sqrt[] { x } $$`},
+		{`\sqrt[3]{x}`, `$$ \sqrt[3] { x } $$`},
+		{`x^{2}`, `$$ x ^ { 2 }  $$`},
+		{`x_{i}^{2}`, `$$ x_{ i }  ^{ 2 } $$`},
+		{`\sum_{i=1}^{n} i`, `$$ ∑ \limits_{ i=1 } ^ n { i } $$`},
+		{`\lim_{x \to 0} x`, `$$ \mathop { lim } \limits_{ x→0 } x $$`},
+		{`\left( a \right)`, `$$ \left ( { a } \right ) $$`},
+		{`\left[ a \right)`, `$$ \left [ { a } \right ) $$`},
+		{`\begin{matrix} a & b \\ c & d \end{matrix}`, `$$  \begin{array} {} a & b \\ c & d \\  \end{array}  $$`},
+		{`\begin{pmatrix} 1 & 0 \\ 0 & 1 \end{pmatrix}`, `$$ \left ( {  \begin{array} {} 1 & 0 \\ 0 & 1 \\  \end{array}  } \right ) $$`},
+		{`\hat{x}`, `$$ \hat{ x } $$`},
+		{`\dot{x}`, `$$ \dot{ x } $$`},
+		{`\vec{v}`, `$$ \overrightarrow{ v } $$`},
+		{`\alpha + \beta \le \Gamma`, `$$ α+β≤Γ $$`},
+	}
+	for _, test := range tests {
+		eqn, err := ParseLatex(test.latex)
+		if err != nil {
+			t.Errorf("ParseLatex(%q): %v", test.latex, err)
+			continue
+		}
+		if latex, err := eqn.Translate(); err != nil || latex != test.want {
+			t.Errorf("ParseLatex(%q).Translate() = %q, %v, want %q", test.latex, latex, err, test.want)
+		}
+	}
+}
+
+//ParseLatex的结果的第一个节点
+func firstLatexNode(t *testing.T, latex string) Node {
+	t.Helper()
+	eqn, err := ParseLatex(latex)
+	if err != nil {
+		t.Fatalf("ParseLatex(%q): %v", latex, err)
+	}
+	objects := eqn.Objects()
+	children := objects[len(objects)-1].Children()
+	if len(children) == 0 {
+		t.Fatalf("ParseLatex(%q): empty line", latex)
+	}
+	return children[0]
+}
+
+func TestParseLatexNodes(t *testing.T) {
+	fraction := firstLatexNode(t, `\frac{a}{b}`).(*Template)
+	if fraction.Selector() != SelectorFraction {
+		t.Errorf(`\frac: TMPL %v, want fraction`, fraction.Selector())
+	}
+	if a := fraction.Numerator().Children()[0].(*Char); a.Rune() != 'a' || a.Typeface() != int(fnVARIABLE) {
+		t.Errorf(`\frac numerator %q typeface %d, want variable a`, a.Rune(), a.Typeface())
+	}
+
+	root := firstLatexNode(t, `\sqrt[3]{x}`).(*Template)
+	if root.Selector() != SelectorRoot || !root.Variation().Has(VariationRootNth) {
+		t.Errorf(`\sqrt[3]: TMPL %v variation %#x, want nth root`, root.Selector(), uint16(root.Variation()))
+	}
+	if three := root.RootIndex().Children()[0].(*Char); three.Rune() != '3' || three.Typeface() != int(fnNUMBER) {
+		t.Errorf(`\sqrt[3] index %q typeface %d, want number 3`, three.Rune(), three.Typeface())
+	}
+
+	sum := firstLatexNode(t, `\sum_{i=1}^{n} i`).(*Template)
+	if sum.Selector() != SelectorSum || !sum.Variation().Has(VariationLowerLimit|VariationUpperLimit) {
+		t.Errorf(`\sum: TMPL %v variation %#x, want sum with both limits`, sum.Selector(), uint16(sum.Variation()))
+	}
+
+	fence := firstLatexNode(t, `\left( a \right)`).(*Template)
+	if fence.Selector() != SelectorParen || !fence.Variation().Has(VariationFenceLeft|VariationFenceRight) {
+		t.Errorf(`\left(: TMPL %v variation %#x, want parentheses`, fence.Selector(), uint16(fence.Variation()))
+	}
+
+	matrix, ok := firstLatexNode(t, `\begin{matrix} a & b \\ c & d \end{matrix}`).(*Matrix)
+	if !ok || matrix.Rows() != 2 || matrix.Cols() != 2 {
+		t.Fatalf(`\begin{matrix}: %v, want 2x2 matrix`, matrix)
+	}
+	var cells []rune
+	for _, cell := range matrix.Cells() {
+		cells = append(cells, cell.Children()[0].(*Char).Rune())
+	}
+	if want := []rune("abcd"); !reflect.DeepEqual(cells, want) {
+		t.Errorf(`\begin{matrix} cells %q, want %q`, cells, want)
+	}
+
+	x := firstLatexNode(t, `\hat{x}`).(*Char)
+	if embells := x.Embellishments(); x.Rune() != 'x' || len(embells) != 1 || embells[0].Type != embHAT {
+		t.Errorf(`\hat: CHAR %q embellishments %+v, want x with hat`, x.Rune(), embells)
+	}
+
+	alpha := firstLatexNode(t, `\alpha`).(*Char)
+	if alpha.Rune() != 'α' || alpha.Typeface() != int(fnLCGREEK) {
+		t.Errorf(`\alpha: CHAR %q typeface %d, want lower case greek α`, alpha.Rune(), alpha.Typeface())
+	}
+}
+
+func TestParseLatexErrors(t *testing.T) {
+	tests := []struct {
+		latex  string
+		err    error
+		offset int
+	}{
+		{`\frac{a}`, ErrLatexSyntax, 8},
+		{`x^`, ErrLatexSyntax, 2},
+		{`{a`, ErrLatexSyntax, 2},
+		{`a}`, ErrLatexSyntax, 1},
+		{`\left( a`, ErrLatexSyntax, 8},
+		{`\begin{matrix} a \end{pmatrix}`, ErrLatexSyntax, 30},
+		{`\foo`, ErrUnknownCommand, 0},
+		{`\begin{foo} a \end{foo}`, ErrUnknownCommand, 6},
+	}
+	for _, test := range tests {
+		_, err := ParseLatex(test.latex)
+		if !errors.Is(err, test.err) {
+			t.Errorf("ParseLatex(%q): %v, want %v", test.latex, err, test.err)
+			continue
+		}
+		var latexErr *LatexError
+		if !errors.As(err, &latexErr) || latexErr.Offset != test.offset {
+			t.Errorf("ParseLatex(%q): %#v, want LatexError at offset %d", test.latex, err, test.offset)
+		}
+	}
+}
+
+//fixture的LaTeX输出再导入，转换出来的结果不变
+func TestParseLatexFixtures(t *testing.T) {
+	for _, file := range []string{"oleObject1.bin", "oleObject3.bin", "oleObject4.bin", "oleObject5.bin"} {
+		want, err := openFixture(t, file).Translate()
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		eqn, err := ParseLatex(want)
+		if err != nil {
+			t.Fatalf("%v: ParseLatex(%q): %v", file, want, err)
+		}
+		if latex, err := eqn.Translate(); err != nil || latex != want {
+			t.Errorf("%v: ParseLatex(%q).Translate() = %q, %v", file, want, latex, err)
+		}
+	}
+}
@@ -0,0 +1,1461 @@
+package eqn
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//presentation MathML转换成MTEF：
+//	mi mn mo mtext转成CHAR，多个字母的mi（比如sin）用fnFUNCTION
+//	mfrac msqrt mroot msub msup msubsup转成对应的template
+//	munder mover munderover：大型运算符转成tmSUM等，重音转成embellishment或者tmHAT等，其他的转成tmLIM
+//	mrow两边是成对的mo定界符、mfenced转成fence template，mtable转成MATRIX
+//节点的结构见builder.go，content MathML和不认识的元素返回ErrUnknownElement
+
+//MathML里常用、但是HTML里没有的实体
+var mathmlEntities = map[string]string{
+	"InvisibleTimes": "⁢", "it": "⁢",
+	"ApplyFunction": "⁡", "af": "⁡",
+	"InvisibleComma": "⁣", "ic": "⁣",
+	"PlusMinus": "±", "MinusPlus": "∓", "Integral": "∫", "Sum": "∑", "Product": "∏",
+	"PartialD": "∂", "Del": "∇", "Element": "∈", "CenterDot": "·", "Cross": "⨯",
+	"RightArrow": "→", "LeftArrow": "←", "DoubleRightArrow": "⇒", "LeftRightArrow": "↔",
+	"LeftAngleBracket": "〈", "RightAngleBracket": "〉", "VerticalBar": "∣",
+	"ThinSpace": " ", "MediumSpace": " ", "NoBreak": "⁠", "NewLine": "\n",
+}
+
+//mover、munder里的重音字符，一个字符的时候用embellishment，否则用template
+var mathmlAccents = map[uint16]struct {
+	embell    EmbellType
+	selector  SelectorType
+	variation uint16
+	char      uint16
+}{
+	'^':    {embHAT, tmHAT, 0, 0x02c6},
+	0x02c6: {embHAT, tmHAT, 0, 0x02c6},
+	'~':    {embTILDE, tmTILDE, 0, 0x02dc},
+	0x02dc: {embTILDE, tmTILDE, 0, 0x02dc},
+	0x00af: {embOBAR, tmOBAR, 0, 0},
+	0x203e: {embOBAR, tmOBAR, 0, 0},
+	0x2192: {embRARROW, tmVEC, tvVE_RIGHT, 0x20d7},
+	0x20d7: {embRARROW, tmVEC, tvVE_RIGHT, 0x20d7},
+	0x2190: {embLARROW, tmVEC, tvVE_LEFT, 0x20d6},
+	0x20d6: {embLARROW, tmVEC, tvVE_LEFT, 0x20d6},
+	0x2194: {embBARROW, tmVEC, tvVE_LEFT | tvVE_RIGHT, 0x20e1},
+	0x2322: {embFROWN, tmARC, 0, 0x2322},
+	0x02d9: {emb1DOT, 0, 0, 0},
+	0x00a8: {emb2DOT, 0, 0, 0},
+	0x20db: {emb3DOT, 0, 0, 0},
+}
+
+var mathmlUnderAccents = map[uint16]struct {
+	embell   EmbellType
+	selector SelectorType
+}{
+	'_':    {embU_BAR, tmUBAR},
+	0x00af: {embU_BAR, tmUBAR},
+	0x0332: {embU_BAR, tmUBAR},
+}
+
+//mo的开始和结束定界符，MathML常用的尖括号换成MathType用的
+var mathmlFenceCodes = map[uint16]uint16{
+	0x27e8: 0x2329,
+	0x27e9: 0x232a,
+	0x3008: 0x2329,
+	0x3009: 0x232a,
+	0x2223: '|',
+	0x2225: 0x2016,
+}
+
+type mathmlNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Text     string       `xml:",chardata"`
+	Children []mathmlNode `xml:",any"`
+}
+
+func (n *mathmlNode) name() string {
+	return n.XMLName.Local
+}
+
+func (n *mathmlNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return strings.TrimSpace(attr.Value)
+		}
+	}
+	return ""
+}
+
+//token元素的内容，去掉两边的空白
+func (n *mathmlNode) text() string {
+	return strings.TrimSpace(n.Text)
+}
+
+//只有一个字符的mo返回它的mtcode，定界符按mathmlFenceCodes替换
+func (n *mathmlNode) operator() (uint16, bool) {
+	if n.name() != "mo" {
+		return 0, false
+	}
+	runes := []rune(n.text())
+	if len(runes) != 1 || runes[0] > 0xffff {
+		return 0, false
+	}
+	if code, ok := mathmlFenceCodes[uint16(runes[0])]; ok {
+		return code, true
+	}
+	return uint16(runes[0]), true
+}
+
+//读取MathML的<math>元素，没有display="block"的是行内公式
+func OpenMathML(reader io.Reader) (*MTEFv5, error) {
+	decoder := xml.NewDecoder(reader)
+	decoder.Entity = make(map[string]string, len(xml.HTMLEntity)+len(mathmlEntities))
+	for name, value := range xml.HTMLEntity {
+		decoder.Entity[name] = value
+	}
+	for name, value := range mathmlEntities {
+		decoder.Entity[name] = value
+	}
+
+	var root mathmlNode
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("mtef: mathml: %w", err)
+	}
+	if root.name() != "math" {
+		return nil, fmt.Errorf("mtef: mathml <%v>: %w", root.name(), ErrUnknownElement)
+	}
+
+	b := &mathmlBuilder{treeBuilder{size: FULL}}
+	line := b.newLine()
+	if err := b.appendList(line, root.Children); err != nil {
+		return nil, err
+	}
+
+	m := New(&Line{finishLine(line)})
+	if root.attr("display") != "block" {
+		m.mInline = 1
+	}
+	return m, nil
+}
+
+type mathmlBuilder struct {
+	treeBuilder
+}
+
+//按顺序把元素加到LINE里，大型运算符后面一直到关系符号的元素是它的main slot
+func (b *mathmlBuilder) appendList(line *MtAST, nodes []mathmlNode) error {
+	for i := 0; i < len(nodes); i++ {
+		if code, ok := bigOperator(&nodes[i]); ok {
+			end := i + 1
+			for end < len(nodes) && !isRelation(&nodes[end]) {
+				end++
+			}
+
+			op, err := b.bigOpNode(&nodes[i], code, nodes[i+1:end])
+			if err != nil {
+				return err
+			}
+			line.children = append(line.children, op)
+			i = end - 1
+			continue
+		}
+
+		if err := b.appendNode(line, &nodes[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//mo，或者底数是mo的上下标、上下限元素，mo是大型运算符的时候返回它的mtcode
+func bigOperator(node *mathmlNode) (uint16, bool) {
+	switch node.name() {
+	case "msub", "msup", "msubsup", "munder", "mover", "munderover":
+		if len(node.Children) == 0 {
+			return 0, false
+		}
+		node = &node.Children[0]
+	}
+
+	code, ok := node.operator()
+	if _, isBigOp := bigOperators[code]; ok && isBigOp {
+		return code, true
+	}
+	return 0, false
+}
+
+func isRelation(node *mathmlNode) bool {
+	code, ok := node.operator()
+	return ok && relationCodes[code]
+}
+
+//一个元素对应的LINE，mrow这样的元素里面的内容直接放到LINE里
+func (b *mathmlBuilder) line(node *mathmlNode) (*MtAST, error) {
+	line := b.newLine()
+	if err := b.appendNode(line, node); err != nil {
+		return nil, err
+	}
+	return finishLine(line), nil
+}
+
+//上下标、极限用小一号的字
+func (b *mathmlBuilder) smallLine(node *mathmlNode) (line *MtAST, err error) {
+	err = b.smaller(func() error {
+		line, err = b.line(node)
+		return err
+	})
+	return line, err
+}
+
+//元素的子节点（inferred mrow）对应的LINE
+func (b *mathmlBuilder) rowLine(nodes []mathmlNode) (*MtAST, error) {
+	line := b.newLine()
+	if err := b.appendList(line, nodes); err != nil {
+		return nil, err
+	}
+	return finishLine(line), nil
+}
+
+//检查子节点个数，msub、mfrac这些元素的参数个数是固定的
+func (b *mathmlBuilder) children(node *mathmlNode, count int) ([]mathmlNode, error) {
+	if len(node.Children) != count {
+		return nil, fmt.Errorf("mtef: mathml <%v> has %d children, want %d: %w", node.name(), len(node.Children), count, ErrInvalidMathML)
+	}
+	return node.Children, nil
+}
+
+func (b *mathmlBuilder) appendNode(line *MtAST, node *mathmlNode) (err error) {
+	var nodes []*MtAST
+
+	switch node.name() {
+	case "mrow", "mstyle", "mpadded", "merror":
+		if left, right, ok := mathmlFence(node.Children); ok {
+			var main *MtAST
+			if main, err = b.rowLine(node.Children[1 : len(node.Children)-1]); err != nil {
+				return err
+			}
+			nodes = fenceNodes(main, left, right)
+		} else if left, ok := mathmlLeftFence(node.Children); ok {
+			var main *MtAST
+			if main, err = b.rowLine(node.Children[1:]); err != nil {
+				return err
+			}
+			nodes = fenceNodes(main, left, 0)
+		} else {
+			return b.appendList(line, node.Children)
+		}
+	case "semantics", "maction":
+		//只用第一个子节点，annotation和其他action忽略
+		if len(node.Children) > 0 {
+			return b.appendNode(line, &node.Children[0])
+		}
+		return nil
+	case "mphantom", "none", "mprescripts", "annotation", "annotation-xml":
+		return nil
+	case "mi", "mn", "mo", "mtext", "ms":
+		if nodes, err = b.token(node); err != nil {
+			return err
+		}
+	case "mspace":
+		//宽度不小于1em的是\quad，否则是细空格
+		code := uint16(0xef02)
+		if width := node.attr("width"); strings.HasSuffix(width, "em") && !strings.HasPrefix(width, "0") {
+			code = 0xef05
+		}
+		nodes = []*MtAST{charNode(code, fnSPACE)}
+	case "mfrac":
+		var children []mathmlNode
+		if children, err = b.children(node, 2); err != nil {
+			return err
+		}
+		num, err := b.line(&children[0])
+		if err != nil {
+			return err
+		}
+		den, err := b.line(&children[1])
+		if err != nil {
+			return err
+		}
+
+		variation := uint16(0)
+		if node.attr("bevelled") == "true" {
+			variation = tvFR_SLASH
+		}
+		nodes = []*MtAST{tmplNode(tmFRACT, variation, num, den)}
+	case "msqrt":
+		radicand, err := b.rowLine(node.Children)
+		if err != nil {
+			return err
+		}
+		nodes = []*MtAST{tmplNode(tmROOT, tvROOT_SQ, radicand, finishLine(b.newLine()))}
+	case "mroot":
+		var children []mathmlNode
+		if children, err = b.children(node, 2); err != nil {
+			return err
+		}
+		radicand, err := b.line(&children[0])
+		if err != nil {
+			return err
+		}
+		index, err := b.smallLine(&children[1])
+		if err != nil {
+			return err
+		}
+		nodes = []*MtAST{tmplNode(tmROOT, tvROOT_NTH, radicand, &MtAST{smallerSize(b.size), nil, nil}, index)}
+	case "msub", "msup", "msubsup":
+		return b.appendScripts(line, node)
+	case "munder", "mover", "munderover":
+		if nodes, err = b.underOver(node); err != nil {
+			return err
+		}
+	case "mtable":
+		if nodes, err = b.table(node); err != nil {
+			return err
+		}
+	case "mfenced":
+		if nodes, err = b.fenced(node); err != nil {
+			return err
+		}
+	case "menclose":
+		main, err := b.rowLine(node.Children)
+		if err != nil {
+			return err
+		}
+
+		switch notation := node.attr("notation"); {
+		case strings.Contains(notation, "box"):
+			variation := tvBX_LEFT | tvBX_RIGHT | tvBX_TOP | tvBX_BOTTOM
+			if strings.Contains(notation, "roundedbox") {
+				variation |= tvBX_ROUND
+			}
+			nodes = []*MtAST{tmplNode(tmBOX, variation, main)}
+		case notation == "radical":
+			nodes = []*MtAST{tmplNode(tmROOT, tvROOT_SQ, main, finishLine(b.newLine()))}
+		case strings.Contains(notation, "strike"):
+			nodes = []*MtAST{tmplNode(tmSTRIKE, tvST_HORIZ, main)}
+		default:
+			nodes = main.children
+		}
+	default:
+		return fmt.Errorf("mtef: mathml <%v>: %w", node.name(), ErrUnknownElement)
+	}
+
+	line.children = append(line.children, nodes...)
+	return nil
+}
+
+//mi、mn、mo、mtext里的字符
+func (b *mathmlBuilder) token(node *mathmlNode) ([]*MtAST, error) {
+	text := node.text()
+	if node.name() == "mtext" || node.name() == "ms" {
+		//文本里的空格保留
+		text = strings.Join(strings.Fields(node.Text), " ")
+	}
+
+	letters := len([]rune(text)) > 1
+	for _, r := range text {
+		if !isLatexLetter(r) {
+			letters = false
+		}
+	}
+
+	//多个字母的mi和mo是函数名
+	if letters && (node.name() == "mi" || node.name() == "mo") {
+		return functionNodes(text), nil
+	}
+
+	var nodes []*MtAST
+	for _, r := range text {
+		if r > 0xffff {
+			return nil, fmt.Errorf("mtef: mathml <%v>: character %q outside of the BMP: %w", node.name(), r, ErrUnknownElement)
+		}
+
+		code, typeface := uint16(r), defaultTypeface(uint16(r))
+		switch node.name() {
+		case "mi":
+			switch node.attr("mathvariant") {
+			case "normal":
+				if typeface == fnVARIABLE {
+					typeface = fnTEXT
+				}
+			case "bold", "bold-italic":
+				if typeface == fnVARIABLE {
+					typeface = fnVECTOR
+				}
+			}
+		case "mn":
+			typeface = fnNUMBER
+		case "mo":
+			//不可见的运算符MathType里不需要
+			if code >= 0x2061 && code <= 0x2064 {
+				continue
+			}
+			if code == '-' {
+				code = 0x2212
+			}
+		case "mtext", "ms":
+			typeface = fnTEXT
+		}
+		nodes = append(nodes, charNode(code, typeface))
+	}
+	return nodes, nil
+}
+
+//msub、msup、msubsup：底数放到LINE里，后面跟着上下标template
+func (b *mathmlBuilder) appendScripts(line *MtAST, node *mathmlNode) (err error) {
+	count := 2
+	if node.name() == "msubsup" {
+		count = 3
+	}
+	children, err := b.children(node, count)
+	if err != nil {
+		return err
+	}
+	if err = b.appendNode(line, &children[0]); err != nil {
+		return err
+	}
+
+	var sub, sup *MtAST
+	switch node.name() {
+	case "msub":
+		sub, err = b.smallLine(&children[1])
+	case "msup":
+		sup, err = b.smallLine(&children[1])
+	default:
+		if sub, err = b.smallLine(&children[1]); err == nil {
+			sup, err = b.smallLine(&children[2])
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	//上标只有′的时候是底数的prime
+	if sub == nil && len(sup.children) == 1 && len(line.children) > 0 {
+		prime, isChar := sup.children[0].value.(*MtChar)
+		base, baseIsChar := line.children[len(line.children)-1].value.(*MtChar)
+		if isChar && baseIsChar && prime.mtcode == 0x2032 {
+			addEmbell(base, emb1PRIME)
+			return nil
+		}
+	}
+
+	line.children = append(line.children, b.script(sub, sup))
+	return nil
+}
+
+//上下限：munder munderover msub msubsup（msub、msubsup的上下限在右边）
+func (b *mathmlBuilder) limits(node *mathmlNode) (lower *MtAST, upper *MtAST, err error) {
+	children := node.Children
+	switch node.name() {
+	case "msub", "munder":
+		if children, err = b.children(node, 2); err == nil {
+			lower, err = b.smallLine(&children[1])
+		}
+	case "msup", "mover":
+		if children, err = b.children(node, 2); err == nil {
+			upper, err = b.smallLine(&children[1])
+		}
+	case "msubsup", "munderover":
+		if children, err = b.children(node, 3); err == nil {
+			if lower, err = b.smallLine(&children[1]); err == nil {
+				upper, err = b.smallLine(&children[2])
+			}
+		}
+	}
+	return lower, upper, err
+}
+
+//大型运算符，main是后面到关系符号为止的元素
+func (b *mathmlBuilder) bigOpNode(node *mathmlNode, code uint16, mainNodes []mathmlNode) (*MtAST, error) {
+	lower, upper, err := b.limits(node)
+	if err != nil {
+		return nil, err
+	}
+
+	//munder、mover的上下限在符号的上下方，msub、msup在右边，只有mo的时候按运算符的习惯
+	variation := uint16(0)
+	switch node.name() {
+	case "munder", "mover", "munderover":
+		variation = tvBO_SUM
+	case "mo":
+		if bigOperators[code].limits {
+			variation = tvBO_SUM
+		}
+	}
+
+	main, err := b.rowLine(mainNodes)
+	if err != nil {
+		return nil, err
+	}
+	return b.bigOp(code, variation, main, lower, upper), nil
+}
+
+//munder、mover、munderover：重音、\lim这样的函数和其他上下限
+func (b *mathmlBuilder) underOver(node *mathmlNode) ([]*MtAST, error) {
+	if len(node.Children) == 2 {
+		base, accent := &node.Children[0], &node.Children[1]
+		if code, ok := accent.operator(); ok {
+			if node.name() == "mover" {
+				if over, ok := mathmlAccents[code]; ok {
+					return b.accent(base, over.embell, over.selector, over.variation, over.char)
+				}
+			} else if under, ok := mathmlUnderAccents[code]; ok {
+				return b.accent(base, under.embell, under.selector, 0, 0)
+			}
+		}
+	}
+
+	lower, upper, err := b.limits(node)
+	if err != nil {
+		return nil, err
+	}
+	main, err := b.line(&node.Children[0])
+	if err != nil {
+		return nil, err
+	}
+	return []*MtAST{b.limit(main.children, lower, upper)}, nil
+}
+
+//底数是一个字符的时候加embellishment，否则用template，selector为0的只能是一个字符
+func (b *mathmlBuilder) accent(base *mathmlNode, embell EmbellType, selector SelectorType, variation uint16, char uint16) ([]*MtAST, error) {
+	main, err := b.line(base)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(main.children) == 1 {
+		if baseChar, ok := main.children[0].value.(*MtChar); ok {
+			addEmbell(baseChar, embell)
+			return main.children, nil
+		}
+	}
+	if selector == 0 {
+		return nil, fmt.Errorf("mtef: mathml accent %v needs a single character: %w", embell, ErrUnknownElement)
+	}
+	if char == 0 {
+		return []*MtAST{tmplNode(selector, variation, main)}, nil
+	}
+	return []*MtAST{tmplNode(selector, variation, main, charNode(char, fnMTEXTRA))}, nil
+}
+
+//mrow的第一个和最后一个子节点是成对的定界符
+func mathmlFence(nodes []mathmlNode) (left uint16, right uint16, ok bool) {
+	if len(nodes) < 2 {
+		return 0, 0, false
+	}
+	first, last := &nodes[0], &nodes[len(nodes)-1]
+	if first.attr("stretchy") == "false" || last.attr("stretchy") == "false" {
+		return 0, 0, false
+	}
+
+	left, leftOk := first.operator()
+	right, rightOk := last.operator()
+	if !leftOk || !rightOk {
+		return 0, 0, false
+	}
+	for _, f := range fenceTemplates {
+		if f.left == left && f.right == right {
+			return left, right, true
+		}
+	}
+	_, leftOk = intervalVariations[left]
+	_, rightOk = intervalVariations[right]
+	return left, right, leftOk && rightOk
+}
+
+//分段函数：mrow的第一个子节点是{，后面没有}，stretchy="false"的不算
+func mathmlLeftFence(nodes []mathmlNode) (uint16, bool) {
+	if len(nodes) < 2 {
+		return 0, false
+	}
+	first := &nodes[0]
+	if code, ok := first.operator(); !ok || code != '{' || first.attr("stretchy") == "false" {
+		return 0, false
+	}
+	return '{', true
+}
+
+//mfenced，open、close默认是圆括号，子节点之间用separators分隔（默认逗号）
+func (b *mathmlBuilder) fenced(node *mathmlNode) ([]*MtAST, error) {
+	delimiter := func(attr string, value string) uint16 {
+		for _, a := range node.Attrs {
+			if a.Name.Local == attr {
+				value = strings.TrimSpace(a.Value)
+			}
+		}
+		runes := []rune(value)
+		if len(runes) != 1 || runes[0] > 0xffff {
+			return 0
+		}
+		if code, ok := mathmlFenceCodes[uint16(runes[0])]; ok {
+			return code
+		}
+		return uint16(runes[0])
+	}
+	left, right := delimiter("open", "("), delimiter("close", ")")
+
+	separators := []rune(",")
+	for _, a := range node.Attrs {
+		if a.Name.Local == "separators" {
+			separators = []rune(strings.Join(strings.Fields(a.Value), ""))
+		}
+	}
+
+	main := b.newLine()
+	for i := range node.Children {
+		if i > 0 && len(separators) > 0 {
+			separator := separators[len(separators)-1]
+			if i-1 < len(separators) {
+				separator = separators[i-1]
+			}
+			main.children = append(main.children, charNode(uint16(separator), fnSYMBOL))
+		}
+		if err := b.appendNode(main, &node.Children[i]); err != nil {
+			return nil, err
+		}
+	}
+	return fenceNodes(finishLine(main), left, right), nil
+}
+
+//mtable转成MATRIX，mlabeledtr的第一个单元格是标签，忽略
+func (b *mathmlBuilder) table(node *mathmlNode) ([]*MtAST, error) {
+	var rows [][]*MtAST
+	for i := range node.Children {
+		tr := &node.Children[i]
+		cells := tr.Children
+		switch tr.name() {
+		case "mtr":
+		case "mlabeledtr":
+			if len(cells) > 0 {
+				cells = cells[1:]
+			}
+		default:
+			return nil, fmt.Errorf("mtef: mathml <%v> in <mtable>: %w", tr.name(), ErrUnknownElement)
+		}
+
+		var row []*MtAST
+		for j := range cells {
+			if cells[j].name() != "mtd" {
+				return nil, fmt.Errorf("mtef: mathml <%v> in <%v>: %w", cells[j].name(), tr.name(), ErrUnknownElement)
+			}
+			cell, err := b.rowLine(cells[j].Children)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, cell)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		rows = [][]*MtAST{{finishLine(b.newLine())}}
+	}
+
+	cols := 0
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+
+	halign := alignCenter
+	switch strings.Fields(node.attr("columnalign") + " center")[0] {
+	case "left":
+		halign = alignLeft
+	case "right":
+		halign = alignRight
+	}
+
+	matrix, ok := b.matrix(rows, halign,
+		mathmlLines(node.attr("rowlines"), node.attr("frame"), len(rows)),
+		mathmlLines(node.attr("columnlines"), node.attr("frame"), cols))
+	if !ok {
+		return nil, fmt.Errorf("mtef: mathml <mtable> with %d rows and %d columns: %w", len(rows), cols, ErrInvalidMathML)
+	}
+	return []*MtAST{matrix}, nil
+}
+
+//rowlines、columnlines是中间的分隔线（最后一个值重复使用），frame是边框，一共count+1条
+func mathmlLines(lines string, frame string, count int) []int {
+	styles := map[string]int{"none": 0, "solid": 1, "dashed": 2, "dotted": 3}
+
+	parts := make([]int, count+1)
+	parts[0], parts[count] = styles[frame], styles[frame]
+	values := strings.Fields(lines)
+	for i := 1; i < count && len(values) > 0; i++ {
+		value := values[len(values)-1]
+		if i-1 < len(values) {
+			value = values[i-1]
+		}
+		parts[i] = styles[value]
+	}
+	return parts
+}
+
+//公式树转换成presentation MathML：
+//	CHAR按typeface分成mi mn mo mtext，相邻的数字、函数名、文本合并成一个元素，函数名后面加上⁡
+//	上下标template的底数是LINE里前面的一个元素
+//	template转成mfrac mroot msqrt munderover mover munder menclose，定界符类的template转成两边是mo的mrow
+//	PILE和MATRIX转成mtable
+//header里是行内公式的时候没有display="block"
+
+const mathmlNamespace = "http://www.w3.org/1998/Math/MathML"
+
+//定界符类template默认的左右定界符
+var fenceChars = map[SelectorType][2]uint16{
+	tmANGLE:   {0x27e8, 0x27e9},
+	tmPAREN:   {'(', ')'},
+	tmBRACE:   {'{', '}'},
+	tmBRACK:   {'[', ']'},
+	tmBAR:     {'|', '|'},
+	tmDBAR:    {0x2016, 0x2016},
+	tmFLOOR:   {0x230a, 0x230b},
+	tmCEILING: {0x2308, 0x2309},
+	tmOBRACK:  {0x27e6, 0x27e7},
+}
+
+//tmINTERVAL的variation（tvINTV_LEFT_LP...）对应的定界符
+var intervalChars = [4]uint16{'(', ')', '[', ']'}
+
+//大型运算符的符号，tmINTOP、tmSUMOP用template里的符号
+var bigOpChars = map[SelectorType]uint16{
+	tmSUM:    0x2211,
+	tmPROD:   0x220f,
+	tmCOPROD: 0x2210,
+	tmUNION:  0x22c3,
+	tmINTER:  0x22c2,
+	tmINTOP:  0x222b,
+	tmSUMOP:  0x2211,
+}
+
+//MathType的空格（fnSPACE）对应的宽度
+var spaceWidths = map[uint16]string{
+	0xef02: "0.167em",
+	0xef03: "0.278em",
+	0xef04: "0.333em",
+	0xef05: "1em",
+	0xef06: "2em",
+	0xef08: "0.056em",
+}
+
+//embellishment的位置和符号：over、under是字符上下的重音，script是上标（prime），enclose是删除线
+var embellMarks = map[EmbellType]struct {
+	kind  string
+	value string
+}{
+	emb1DOT:      {"over", "˙"},
+	emb2DOT:      {"over", "¨"},
+	emb3DOT:      {"over", "⃛"},
+	emb4DOT:      {"over", "⃜"},
+	emb1PRIME:    {"script", "′"},
+	emb2PRIME:    {"script", "″"},
+	emb3PRIME:    {"script", "‴"},
+	embBPRIME:    {"script", "‵"},
+	embTILDE:     {"over", "˜"},
+	embHAT:       {"over", "ˆ"},
+	embNOT:       {"enclose", "updiagonalstrike"},
+	embRARROW:    {"over", "→"},
+	embLARROW:    {"over", "←"},
+	embBARROW:    {"over", "↔"},
+	embR1ARROW:   {"over", "⇀"},
+	embL1ARROW:   {"over", "↼"},
+	embMBAR:      {"enclose", "horizontalstrike"},
+	embOBAR:      {"over", "¯"},
+	embFROWN:     {"over", "⌢"},
+	embSMILE:     {"over", "⌣"},
+	embX_BARS:    {"enclose", "updiagonalstrike downdiagonalstrike"},
+	embUP_BAR:    {"enclose", "updiagonalstrike"},
+	embDOWN_BAR:  {"enclose", "downdiagonalstrike"},
+	embU_1DOT:    {"under", "˙"},
+	embU_2DOT:    {"under", "¨"},
+	embU_3DOT:    {"under", "⃛"},
+	embU_4DOT:    {"under", "⃜"},
+	embU_BAR:     {"under", "_"},
+	embU_TILDE:   {"under", "˜"},
+	embU_FROWN:   {"under", "⌢"},
+	embU_SMILE:   {"under", "⌣"},
+	embU_RARROW:  {"under", "→"},
+	embU_LARROW:  {"under", "←"},
+	embU_BARROW:  {"under", "↔"},
+	embU_R1ARROW: {"under", "⇀"},
+	embU_L1ARROW: {"under", "↼"},
+}
+
+//embellishment按渲染的顺序返回：先是上下方的符号和删除线，按顺序从里到外包在字符上，
+//然后是prime这样跟在字符后面的符号，所以prime后面加hat是 \hat{x}' 而不是 \hat{x'}
+func orderedEmbells(char *MtChar) []*MtEmbell {
+	var embells, postfix []*MtEmbell
+	for embell := char.embellishments; embell != nil; embell = embell.next {
+		if embellMarks[EmbellType(embell.embell)].kind == "script" {
+			postfix = append(postfix, embell)
+		} else {
+			embells = append(embells, embell)
+		}
+	}
+	return append(embells, postfix...)
+}
+
+//CHAR按typeface的分类，决定MathML的元素和OMML的样式
+type charKind uint8
+
+const (
+	kindOperator charKind = iota
+	kindVariable
+	//正体的字母，比如大写希腊字母
+	kindUpright
+	kindBold
+	kindFunction
+	kindNumber
+	kindText
+)
+
+//返回CHAR的分类和输出的字符，运算符里的'-'换成减号
+func classifyChar(char *MtChar) (kind charKind, code uint16) {
+	code = char.mtcode
+	switch char.typeface - 128 {
+	case fnTEXT, fnTEXT_FE:
+		kind = kindText
+	case fnFUNCTION:
+		kind = kindFunction
+	case fnVARIABLE, fnLCGREEK, fnUSER1, fnUSER2:
+		kind = kindVariable
+	case fnUCGREEK:
+		kind = kindUpright
+	case fnVECTOR:
+		kind = kindBold
+	case fnNUMBER:
+		kind = kindNumber
+	case fnSYMBOL, fnMTEXTRA, fnEXPAND:
+		kind = kindOperator
+	default:
+		switch {
+		case code >= '0' && code <= '9':
+			kind = kindNumber
+		case code >= 'a' && code <= 'z', code >= 'A' && code <= 'Z':
+			kind = kindVariable
+		}
+	}
+
+	if kind == kindOperator && code == '-' {
+		code = 0x2212
+	}
+	return kind, code
+}
+
+//定界符类template的左右定界符，0表示没有
+func templateFences(tmpl *MtTmpl) (left uint16, right uint16) {
+	if SelectorType(tmpl.selector) == tmINTERVAL {
+		return intervalChars[tmpl.variation&0x3], intervalChars[(tmpl.variation>>4)&0x3]
+	}
+
+	chars := fenceChars[SelectorType(tmpl.selector)]
+	sides := tmpl.variation & (tvFENCE_L | tvFENCE_R)
+	if sides == 0 {
+		sides = tvFENCE_L | tvFENCE_R
+	}
+	if sides&tvFENCE_L != 0 {
+		left = chars[0]
+	}
+	if sides&tvFENCE_R != 0 {
+		right = chars[1]
+	}
+	return left, right
+}
+
+//大型运算符的符号，积分号按variation的个数和环路选择
+func bigOpChar(tmpl *MtTmpl, slots []*MtAST) uint16 {
+	selector := SelectorType(tmpl.selector)
+	if selector == tmINTEG {
+		count := int(tmpl.variation & tvINT_3)
+		if count == 0 {
+			count = 1
+		}
+		switch tmpl.variation & 0x000c {
+		case tvINT_LOOP:
+			return []uint16{0x222e, 0x222f, 0x2230}[count-1]
+		case 0x0008:
+			return 0x2232
+		case 0x000c:
+			return 0x2233
+		}
+		return []uint16{0x222b, 0x222c, 0x222d}[count-1]
+	}
+
+	//tmINTOP、tmSUMOP的符号是slot后面的CHAR，跳过MT Extra的扩展符号
+	if selector == tmINTOP || selector == tmSUMOP {
+		for i := len(slots) - 1; i >= 3; i-- {
+			if char, ok := slots[i].value.(*MtChar); ok && (char.mtcode < 0xe000 || char.mtcode > 0xf8ff) {
+				return char.mtcode
+			}
+		}
+	}
+	return bigOpChars[selector]
+}
+
+//template的第idx个slot，没有的时候是nil
+func slotAt(slots []*MtAST, idx int) *MtAST {
+	if idx < len(slots) {
+		return slots[idx]
+	}
+	return nil
+}
+
+//没有内容的slot（null line或者只有字号record）
+func emptySlot(ast *MtAST) bool {
+	if ast == nil {
+		return true
+	}
+	for _, child := range ast.children {
+		switch child.tag {
+		case CHAR, TMPL, PILE, MATRIX:
+			return false
+		}
+	}
+	return ast.tag == LINE
+}
+
+//把公式转换成presentation MathML，公式里有不认识的template时返回ErrNotImplemented
+func (m *MTEFv5) TranslateMathML() (string, error) {
+	display := ` display="block"`
+	if m.mInline&mtefOptInline != 0 {
+		display = ""
+	}
+
+	content := ""
+	if m.ast != nil {
+		row := &mathmlRow{renderNudges: m.RenderNudges}
+		for _, object := range m.ast.slots() {
+			if err := row.append(object); err != nil {
+				return "", err
+			}
+		}
+		content = row.content()
+	}
+	return fmt.Sprintf(`<math xmlns="%v"%v>%v</math>`, mathmlNamespace, display, content), nil
+}
+
+//LINE里面的元素，token还没输出的时候可以和后面的字符合并
+type mathmlRow struct {
+	items []string
+
+	//还没输出的token
+	tag, attrs, text string
+	function         bool
+
+	//前面是函数名，下一个元素前面加⁡
+	applyFunction bool
+
+	//是否用mpadded渲染nudge，和MTEFv5.RenderNudges一样
+	renderNudges bool
+}
+
+func mathmlElement(tag string, attrs string, children ...string) string {
+	if len(children) == 0 {
+		return fmt.Sprintf("<%v%v/>", tag, attrs)
+	}
+	return fmt.Sprintf("<%v%v>%v</%v>", tag, attrs, strings.Join(children, ""), tag)
+}
+
+func mathmlToken(tag string, attrs string, text string) string {
+	buf := new(strings.Builder)
+	_ = xml.EscapeText(buf, []byte(text))
+	return fmt.Sprintf("<%v%v>%v</%v>", tag, attrs, buf.String(), tag)
+}
+
+func mathmlOperator(code uint16, attrs string) string {
+	return mathmlToken("mo", attrs, string(rune(code)))
+}
+
+func (row *mathmlRow) flush() {
+	if row.tag == "" {
+		return
+	}
+	row.items = append(row.items, mathmlToken(row.tag, row.attrs, row.text))
+	row.applyFunction = row.function
+	row.tag = ""
+}
+
+//加上一个元素，operator为true的时候是不需要⁡的运算符
+func (row *mathmlRow) push(item string, operator bool) {
+	row.flush()
+	if row.applyFunction && !operator {
+		row.items = append(row.items, mathmlOperator(0x2061, ""))
+	}
+	row.applyFunction = false
+	row.items = append(row.items, item)
+}
+
+//取出最后一个元素作为上下标的底数，函数名的⁡放到上下标后面
+func (row *mathmlRow) pop() string {
+	row.flush()
+	if len(row.items) == 0 {
+		return "<mrow/>"
+	}
+	item := row.items[len(row.items)-1]
+	row.items = row.items[:len(row.items)-1]
+	return item
+}
+
+//一个元素的时候直接返回，否则用mrow包起来
+func (row *mathmlRow) content() string {
+	row.flush()
+	if len(row.items) == 1 {
+		return row.items[0]
+	}
+	return mathmlElement("mrow", "", row.items...)
+}
+
+func (row *mathmlRow) append(ast *MtAST) (err error) {
+	//nudge过的节点单独转换，用mpadded包起来，不和前后的字符合并
+	if nudgeX, nudgeY, ok := renderedNudge(ast, row.renderNudges); ok {
+		nudged := row.child()
+		if err = nudged.object(ast); err != nil {
+			return err
+		}
+		row.push(nudgeMathML(nudged.content(), nudgeX, nudgeY), false)
+		return nil
+	}
+	return row.object(ast)
+}
+
+func (row *mathmlRow) object(ast *MtAST) (err error) {
+	switch ast.tag {
+	case LINE:
+		//作者手动修改了字号的部分用mstyle包起来
+		size := ast.value.(*MtLine).size
+		for _, run := range lineRuns(ast) {
+			row.flush()
+			start := len(row.items)
+			for _, child := range run.nodes {
+				if err = row.append(child); err != nil {
+					return err
+				}
+			}
+
+			if attrs := mathmlSizeAttrs(size, run); attrs != "" {
+				row.flush()
+				item := mathmlElement("mstyle", attrs, row.items[start:]...)
+				row.items = append(row.items[:start], item)
+			}
+		}
+	case CHAR:
+		row.char(ast.value.(*MtChar))
+	case TMPL:
+		return row.template(ast)
+	case PILE:
+		pile := ast.value.(*MtPile)
+		var rows []string
+		for _, line := range ast.slots() {
+			cell, err := row.slot(line)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, mathmlElement("mtr", "", mathmlElement("mtd", "", cell)))
+		}
+		row.push(mathmlElement("mtable", mathmlColumnAlign(pile.halign), rows...), false)
+	case MATRIX:
+		return row.matrix(ast)
+	}
+	return nil
+}
+
+//新的row，渲染的设置和row一样
+func (row *mathmlRow) child() *mathmlRow {
+	return &mathmlRow{renderNudges: row.renderNudges}
+}
+
+//slot转换成一个元素
+func (row *mathmlRow) slot(ast *MtAST) (string, error) {
+	row = row.child()
+	if ast != nil {
+		if err := row.append(ast); err != nil {
+			return "", err
+		}
+	}
+	return row.content(), nil
+}
+
+func mathmlColumnAlign(halign uint8) string {
+	switch halign {
+	case 1:
+		return ` columnalign="left"`
+	case 3:
+		return ` columnalign="right"`
+	}
+	return ""
+}
+
+func (row *mathmlRow) char(char *MtChar) {
+	code := char.mtcode
+	if width, ok := spaceWidths[code]; ok {
+		row.push(mathmlElement("mspace", fmt.Sprintf(` width="%v"`, width)), true)
+		return
+	}
+	//0xef00是对齐的位置，0xef01是没有宽度的空格
+	if code == 0xef00 || code == 0xef01 {
+		return
+	}
+
+	kind, code := classifyChar(char)
+	tag, attrs, function := "mo", "", false
+	switch kind {
+	case kindText:
+		tag = "mtext"
+	case kindFunction:
+		tag, function = "mi", true
+	case kindVariable:
+		tag = "mi"
+	case kindUpright:
+		tag, attrs = "mi", ` mathvariant="normal"`
+	case kindBold:
+		tag, attrs = "mi", ` mathvariant="bold"`
+	case kindNumber:
+		tag = "mn"
+	}
+	//数字里的小数点
+	if code == '.' && row.tag == "mn" && char.embellishments == nil {
+		tag = "mn"
+	}
+	text := string(rune(code))
+
+	//相邻的数字、同一个函数名、文本合并
+	if char.embellishments == nil && row.tag == tag && row.attrs == attrs {
+		switch {
+		case tag == "mn", tag == "mtext",
+			tag == "mi" && function && row.function && OptionType(char.options)&MtefOptCharFuncStart == 0:
+			row.text += text
+			return
+		}
+	}
+
+	if char.embellishments == nil && tag != "mo" {
+		row.flush()
+		if row.applyFunction {
+			row.items = append(row.items, mathmlOperator(0x2061, ""))
+			row.applyFunction = false
+		}
+		row.tag, row.attrs, row.text, row.function = tag, attrs, text, function
+		return
+	}
+
+	item := mathmlToken(tag, attrs, text)
+	for _, embell := range orderedEmbells(char) {
+		mark, ok := embellMarks[EmbellType(embell.embell)]
+		symbol := mathmlToken("mo", "", mark.value)
+		if row.renderNudges {
+			symbol = nudgeMathML(symbol, embell.nudgeX, embell.nudgeY)
+		}
+
+		switch {
+		case !ok:
+		case mark.kind == "over":
+			item = mathmlElement("mover", ` accent="true"`, item, symbol)
+		case mark.kind == "under":
+			item = mathmlElement("munder", ` accentunder="true"`, item, symbol)
+		case mark.kind == "script":
+			item = mathmlElement("msup", "", item, symbol)
+		case mark.kind == "enclose" && row.renderNudges && significantNudges(embell.nudgeX, embell.nudgeY):
+			//删除线没有单独的符号，和LaTeX一样加在mphantom上，用宽度为0的mpadded叠在字符上
+			strike := mathmlElement("menclose", fmt.Sprintf(` notation="%v"`, mark.value), mathmlElement("mphantom", "", item))
+			strike = nudgeMathML(mathmlElement("mpadded", ` width="0"`, strike), embell.nudgeX, embell.nudgeY)
+			item = mathmlElement("mrow", "", strike, item)
+		case mark.kind == "enclose":
+			item = mathmlElement("menclose", fmt.Sprintf(` notation="%v"`, mark.value), item)
+		}
+	}
+	//开始的定界符前面也要加⁡，比如sin(x)
+	row.push(item, tag == "mo" && !strings.ContainsAny(text, "([{"))
+}
+
+func (row *mathmlRow) template(ast *MtAST) (err error) {
+	tmpl := ast.value.(*MtTmpl)
+	slots := ast.slots()
+
+	//按顺序转换slot，出错的时候后面的都是空的
+	slot := func(idx int) string {
+		if err != nil {
+			return ""
+		}
+		var s string
+		s, err = row.slot(slotAt(slots, idx))
+		return s
+	}
+
+	var item string
+	selector := SelectorType(tmpl.selector)
+	switch selector {
+	case tmANGLE, tmPAREN, tmBRACE, tmBRACK, tmBAR, tmDBAR, tmFLOOR, tmCEILING, tmOBRACK, tmINTERVAL:
+		left, right := templateFences(tmpl)
+		items := []string{slot(0)}
+		if left != 0 {
+			items = append([]string{mathmlOperator(left, ` fence="true" stretchy="true"`)}, items...)
+		}
+		if right != 0 {
+			items = append(items, mathmlOperator(right, ` fence="true" stretchy="true"`))
+		}
+		item = mathmlElement("mrow", "", items...)
+	case tmROOT:
+		if emptySlot(slotAt(slots, 1)) {
+			item = mathmlElement("msqrt", "", slot(0))
+		} else {
+			item = mathmlElement("mroot", "", slot(0), slot(1))
+		}
+	case tmFRACT:
+		attrs := ""
+		if tmpl.variation&tvFR_SLASH != 0 {
+			attrs = ` bevelled="true"`
+		}
+		item = mathmlElement("mfrac", attrs, slot(0), slot(1))
+	case tmUBAR, tmOBAR:
+		mark, tag, attrs := "_", "munder", ` accentunder="true"`
+		if selector == tmOBAR {
+			mark, tag, attrs = "¯", "mover", ` accent="true"`
+		}
+		if tmpl.variation&tvBAR_DOUBLE != 0 {
+			mark = "═"
+		}
+		item = mathmlElement(tag, attrs, slot(0), mathmlToken("mo", ` stretchy="true"`, mark))
+	case tmARROW:
+		arrow := mathmlOperator(arrowChar(tmpl.variation), ` stretchy="true"`)
+		top, bottom := slot(0), slot(1)
+		switch {
+		case !emptySlot(slotAt(slots, 0)) && !emptySlot(slotAt(slots, 1)):
+			item = mathmlElement("munderover", "", arrow, bottom, top)
+		case !emptySlot(slotAt(slots, 1)):
+			item = mathmlElement("munder", "", arrow, bottom)
+		default:
+			item = mathmlElement("mover", "", arrow, top)
+		}
+	case tmINTEG, tmSUM, tmPROD, tmCOPROD, tmUNION, tmINTER, tmINTOP, tmSUMOP:
+		op := mathmlOperator(bigOpChar(tmpl, slots), "")
+		both, under, over := "msubsup", "msub", "msup"
+		if tmpl.variation&tvBO_SUM != 0 {
+			both, under, over = "munderover", "munder", "mover"
+		}
+		main, lower, upper := slot(0), slot(1), slot(2)
+		switch {
+		case !emptySlot(slotAt(slots, 1)) && !emptySlot(slotAt(slots, 2)):
+			op = mathmlElement(both, "", op, lower, upper)
+		case !emptySlot(slotAt(slots, 1)):
+			op = mathmlElement(under, "", op, lower)
+		case !emptySlot(slotAt(slots, 2)):
+			op = mathmlElement(over, "", op, upper)
+		}
+		item = mathmlElement("mrow", "", op, main)
+	case tmLIM:
+		main, lower, upper := slot(0), slot(1), slot(2)
+		switch {
+		case !emptySlot(slotAt(slots, 1)) && !emptySlot(slotAt(slots, 2)):
+			item = mathmlElement("munderover", "", main, lower, upper)
+		case !emptySlot(slotAt(slots, 1)):
+			item = mathmlElement("munder", "", main, lower)
+		case !emptySlot(slotAt(slots, 2)):
+			item = mathmlElement("mover", "", main, upper)
+		default:
+			item = main
+		}
+	case tmHBRACE, tmHBRACK:
+		marks := map[SelectorType][2]uint16{tmHBRACE: {0x23de, 0x23df}, tmHBRACK: {0x23b4, 0x23b5}}[selector]
+		tag, mark := "munder", marks[1]
+		if tmpl.variation&tvHB_TOP != 0 {
+			tag, mark = "mover", marks[0]
+		}
+		item = mathmlElement(tag, "", slot(0), mathmlOperator(mark, ` stretchy="true"`))
+		if !emptySlot(slotAt(slots, 1)) {
+			item = mathmlElement(tag, "", item, slot(1))
+		}
+	case tmLDIV:
+		item = mathmlElement("menclose", ` notation="longdiv"`, slot(0))
+		if tmpl.variation&tvLD_UPPER != 0 {
+			item = mathmlElement("mover", "", item, slot(1))
+		}
+	case tmSUB, tmSUP, tmSUBSUP:
+		var scripts []string
+		if selector != tmSUP {
+			scripts = append(scripts, slot(0))
+		}
+		if selector != tmSUB {
+			scripts = append(scripts, slot(1))
+		}
+		if err != nil {
+			return err
+		}
+
+		//在前面的上下标（tvSU_PRECEDES）没有底数
+		if tmpl.variation&tvSU_PRECEDES != 0 {
+			if selector == tmSUB {
+				scripts = append(scripts, "<none/>")
+			} else if selector == tmSUP {
+				scripts = append([]string{"<none/>"}, scripts...)
+			}
+			row.push(mathmlElement("mmultiscripts", "", append([]string{"<mrow/>", "<mprescripts/>"}, scripts...)...), false)
+			return nil
+		}
+
+		tag := map[SelectorType]string{tmSUB: "msub", tmSUP: "msup", tmSUBSUP: "msubsup"}[selector]
+		base := row.pop()
+		row.items = append(row.items, mathmlElement(tag, "", append([]string{base}, scripts...)...))
+		return nil
+	case tmDIRAC:
+		//bra是⟨a|，ket是|b⟩
+		var items []string
+		idx := 0
+		if tmpl.variation&tvDI_LEFT != 0 {
+			items = append(items, mathmlOperator(0x27e8, ` fence="true"`), slot(idx))
+			idx++
+		}
+		items = append(items, mathmlOperator('|', ""))
+		if tmpl.variation&tvDI_RIGHT != 0 {
+			items = append(items, slot(idx), mathmlOperator(0x27e9, ` fence="true"`))
+		}
+		item = mathmlElement("mrow", "", items...)
+	case tmVEC:
+		tag := "mover"
+		if tmpl.variation&tvVE_UNDER != 0 {
+			tag = "munder"
+		}
+		item = mathmlElement(tag, "", slot(0), mathmlOperator(vectorChar(tmpl.variation), ` stretchy="true"`))
+	case tmTILDE, tmHAT, tmARC:
+		mark := map[SelectorType]uint16{tmTILDE: 0x02dc, tmHAT: 0x02c6, tmARC: 0x23dc}[selector]
+		item = mathmlElement("mover", ` accent="true"`, slot(0), mathmlOperator(mark, ` stretchy="true"`))
+	case tmJSTATUS:
+		item = mathmlElement("menclose", ` notation="actuarial"`, slot(0))
+	case tmSTRIKE:
+		item = mathmlElement("menclose", fmt.Sprintf(` notation="%v"`, strikeNotation(tmpl.variation)), slot(0))
+	case tmBOX:
+		item = mathmlElement("menclose", fmt.Sprintf(` notation="%v"`, boxNotation(tmpl.variation)), slot(0))
+	default:
+		return fmt.Errorf("mtef: mathml %v: %w", selector, ErrNotImplemented)
+	}
+	if err != nil {
+		return err
+	}
+
+	row.push(item, false)
+	return nil
+}
+
+//tmARROW的箭头：单箭头按左右方向，双箭头和鱼叉是一对
+func arrowChar(variation uint16) uint16 {
+	switch {
+	case variation&0x0001 != 0:
+		return 0x21c4
+	case variation&0x0002 != 0:
+		return 0x21cc
+	case variation&tvAR_LEFT != 0 && variation&tvAR_RIGHT != 0:
+		return 0x2194
+	case variation&tvAR_LEFT != 0:
+		return 0x2190
+	}
+	return 0x2192
+}
+
+//tmVEC的箭头
+func vectorChar(variation uint16) uint16 {
+	left, right := variation&tvVE_LEFT != 0, variation&tvVE_RIGHT != 0
+	switch {
+	case variation&tvVE_HARPOON != 0 && left && right:
+		return 0x21cc
+	case variation&tvVE_HARPOON != 0 && left:
+		return 0x21bc
+	case variation&tvVE_HARPOON != 0:
+		return 0x21c0
+	case left && right:
+		return 0x2194
+	case left:
+		return 0x2190
+	}
+	return 0x2192
+}
+
+//menclose的notation
+func strikeNotation(variation uint16) string {
+	var notations []string
+	if variation&tvST_HORIZ != 0 {
+		notations = append(notations, "horizontalstrike")
+	}
+	if variation&tvST_UP != 0 {
+		notations = append(notations, "updiagonalstrike")
+	}
+	if variation&tvST_DOWN != 0 {
+		notations = append(notations, "downdiagonalstrike")
+	}
+	return strings.Join(notations, " ")
+}
+
+func boxNotation(variation uint16) string {
+	sides := tvBX_LEFT | tvBX_RIGHT | tvBX_TOP | tvBX_BOTTOM
+	if variation&sides == sides || variation&sides == 0 {
+		if variation&tvBX_ROUND != 0 {
+			return "roundedbox"
+		}
+		return "box"
+	}
+
+	var notations []string
+	for _, side := range []struct {
+		bit  uint16
+		name string
+	}{{tvBX_LEFT, "left"}, {tvBX_RIGHT, "right"}, {tvBX_TOP, "top"}, {tvBX_BOTTOM, "bottom"}} {
+		if variation&side.bit != 0 {
+			notations = append(notations, side.name)
+		}
+	}
+	return strings.Join(notations, " ")
+}
+
+//MATRIX按行转成mtable，分隔线转成rowlines、columnlines，四周都有线的时候加上frame
+func (row *mathmlRow) matrix(ast *MtAST) error {
+	matrix := ast.value.(*MtMatrix)
+	slots := ast.slots()
+	rows, cols := int(matrix.rows), int(matrix.cols)
+
+	var trs []string
+	for r := 0; r < rows; r++ {
+		var tds []string
+		for c := 0; c < cols; c++ {
+			cell, err := row.slot(slotAt(slots, r*cols+c))
+			if err != nil {
+				return err
+			}
+			tds = append(tds, mathmlElement("mtd", "", cell))
+		}
+		trs = append(trs, mathmlElement("mtr", "", tds...))
+	}
+
+	attrs := mathmlColumnAlign(matrix.h_just)
+	rowParts := partitions(matrix.rowParts, rows+1)
+	colParts := partitions(matrix.colParts, cols+1)
+	if lines, ok := mathmlLineStyles(rowParts, rows); ok {
+		attrs += fmt.Sprintf(` rowlines="%v"`, lines)
+	}
+	if lines, ok := mathmlLineStyles(colParts, cols); ok {
+		attrs += fmt.Sprintf(` columnlines="%v"`, lines)
+	}
+	if len(rowParts) == rows+1 && len(colParts) == cols+1 &&
+		rowParts[0] != 0 && rowParts[rows] != 0 && colParts[0] != 0 && colParts[cols] != 0 {
+		attrs += ` frame="solid"`
+	}
+
+	row.push(mathmlElement("mtable", attrs, trs...), false)
+	return nil
+}
+
+//中间的分隔线，MathML没有点线，用虚线代替，都没有的时候ok为false
+func mathmlLineStyles(parts []uint8, count int) (lines string, ok bool) {
+	styles := []string{"none", "solid", "dashed", "dashed"}
+
+	var values []string
+	for i := 1; i < count; i++ {
+		value := "none"
+		if i < len(parts) {
+			value = styles[parts[i]]
+			ok = ok || parts[i] != 0
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, " "), ok
+}
@@ -0,0 +1,205 @@
+package eqn
+
+import (
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+)
+
+//分数、PILE、MATRIX的slot里手动修改的字号和nudge，LaTeX和MathML都要输出
+func nestedEquation() *MTEFv5 {
+	v := func(r rune) Node { return NewChar(r, int(fnVARIABLE)) }
+	raised := func(line *Line) *MtAST {
+		line.line().nudgeY = -32
+		return line.mtAST()
+	}
+	fraction := &MtAST{TMPL, &MtTmpl{selector: uint8(tmFRACT)}, []*MtAST{
+		raised(NewLine(v('a'), sizeNode(SUB), v('b'))),
+		NewLine(v('c')).mtAST(),
+	}}
+	pile := &MtAST{PILE, &MtPile{}, []*MtAST{raised(NewLine(v('d'))), NewLine(v('e')).mtAST()}}
+	matrix := &MtAST{MATRIX, &MtMatrix{rows: 1, cols: 1}, []*MtAST{NewLine(sizeNode(SUB2), v('f')).mtAST()}}
+	return New(NewLine(&Template{fraction}, &Pile{pile}, &Matrix{matrix}))
+}
+
+func TestMathMLNestedSlots(t *testing.T) {
+	m := nestedEquation()
+	m.RenderNudges = true
+
+	latex, err := m.Translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`\frac { \raisebox{1pt}{$ a \scriptstyle b $} } { c }`,
+		`\raisebox{1pt}{$ d $}`,
+		`\scriptscriptstyle f`,
+	} {
+		if !strings.Contains(latex, want) {
+			t.Errorf("latex %q does not contain %q", latex, want)
+		}
+	}
+
+	mathml, err := m.TranslateMathML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<mfrac><mpadded voffset="1pt"><mrow><mi>a</mi><mstyle scriptlevel="+1"><mi>b</mi></mstyle></mrow></mpadded><mi>c</mi></mfrac>`,
+		`<mtd><mpadded voffset="1pt"><mi>d</mi></mpadded></mtd>`,
+		`<mtd><mstyle scriptlevel="+2"><mi>f</mi></mstyle></mtd>`,
+	} {
+		if !strings.Contains(mathml, want) {
+			t.Errorf("mathml %q does not contain %q", mathml, want)
+		}
+	}
+}
+
+const (
+	mathmlInline = `<math xmlns="http://www.w3.org/1998/Math/MathML">`
+	mathmlBlock  = `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block">`
+)
+
+//OpenMathML建出来的公式，LaTeX输出和写同样公式的LaTeX一样
+func TestOpenMathML(t *testing.T) {
+	tests := []struct {
+		mathml string
+		latex  string
+	}{
+		{`<mfrac><mi>a</mi><mi>b</mi></mfrac>`, `$$ \frac { a } { b } $$`},
+		{`<msqrt><mi>x</mi></msqrt>`, `$$ \sqrt[] { x } $$`},
+		{`<mroot><mi>x</mi><mn>3</mn></mroot>`, `$$ \sqrt[3] { x } $$`},
+		{`<msubsup><mi>x</mi><mi>i</mi><mn>2</mn></msubsup>`, `$$ x_{ i }  ^{ 2 } $$`},
+		{`<munderover><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi>`, `$$ ∑ \limits_{ i=1 } ^ n { i } $$`},
+		{`<mtable><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr><mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr></mtable>`, `$$  \begin{array} {} a & b \\ c & d \\  \end{array}  $$`},
+		{`<mrow><mo>(</mo><mi>a</mi><mo>)</mo></mrow>`, `$$ \left ( { a } \right ) $$`},
+		{`<mfenced><mi>a</mi></mfenced>`, `$$ \left ( { a } \right ) $$`},
+		{`<mover accent="true"><mi>y</mi><mo>^</mo></mover>`, `$$ \hat{ y } $$`},
+		{`<mi>α</mi>`, `$$ α $$`},
+		{``, `$$  $$`},
+	}
+	for _, test := range tests {
+		eqn, err := OpenMathML(strings.NewReader(mathmlInline + test.mathml + `</math>`))
+		if err != nil {
+			t.Errorf("OpenMathML(%q): %v", test.mathml, err)
+			continue
+		}
+		if !eqn.Header().Inline() {
+			t.Errorf("OpenMathML(%q): <math> without display=\"block\" is not inline", test.mathml)
+		}
+		if latex, err := eqn.Translate(); err != nil || latex != test.latex {
+			t.Errorf("OpenMathML(%q).Translate() = %q, %v, want %q", test.mathml, latex, err, test.latex)
+		}
+	}
+}
+
+//OpenMathML的结果的第一个节点
+func firstMathMLNode(t *testing.T, mathml string) Node {
+	t.Helper()
+	eqn, err := OpenMathML(strings.NewReader(mathmlInline + mathml + `</math>`))
+	if err != nil {
+		t.Fatalf("OpenMathML(%q): %v", mathml, err)
+	}
+	objects := eqn.Objects()
+	children := objects[len(objects)-1].Children()
+	if len(children) == 0 {
+		t.Fatalf("OpenMathML(%q): empty line", mathml)
+	}
+	return children[0]
+}
+
+func TestOpenMathMLNodes(t *testing.T) {
+	root := firstMathMLNode(t, `<mroot><mi>x</mi><mn>3</mn></mroot>`).(*Template)
+	if root.Selector() != SelectorRoot || !root.Variation().Has(VariationRootNth) {
+		t.Errorf("<mroot>: TMPL %v variation %#x, want nth root", root.Selector(), uint16(root.Variation()))
+	}
+	if x := root.Radicand().Children()[0].(*Char); x.Rune() != 'x' || x.Typeface() != int(fnVARIABLE) {
+		t.Errorf("<mroot> radicand %q typeface %d, want variable x", x.Rune(), x.Typeface())
+	}
+
+	sum := firstMathMLNode(t, `<munderover><mo>∑</mo><mi>i</mi><mi>n</mi></munderover><mi>i</mi>`).(*Template)
+	if sum.Selector() != SelectorSum || !sum.Variation().Has(VariationLowerLimit|VariationUpperLimit) {
+		t.Errorf("<munderover>: TMPL %v variation %#x, want sum with both limits", sum.Selector(), uint16(sum.Variation()))
+	}
+	if i := sum.Main().Children()[0].(*Char); i.Rune() != 'i' {
+		t.Errorf("<munderover> main slot %q, want the following <mi>", i.Rune())
+	}
+
+	fence := firstMathMLNode(t, `<mrow><mo>(</mo><mi>a</mi><mo>)</mo></mrow>`).(*Template)
+	if fence.Selector() != SelectorParen || !fence.Variation().Has(VariationFenceLeft|VariationFenceRight) {
+		t.Errorf("<mo> fence: TMPL %v variation %#x, want parentheses", fence.Selector(), uint16(fence.Variation()))
+	}
+
+	matrix, ok := firstMathMLNode(t, `<mtable><mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr><mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr></mtable>`).(*Matrix)
+	if !ok || matrix.Rows() != 2 || matrix.Cols() != 2 {
+		t.Fatalf("<mtable>: %v, want 2x2 matrix", matrix)
+	}
+	if d := matrix.Cell(1, 1).Children()[0].(*Char); d.Rune() != 'd' {
+		t.Errorf("<mtable> Cell(1, 1) = %q, want d", d.Rune())
+	}
+
+	y := firstMathMLNode(t, `<mover accent="true"><mi>y</mi><mo>^</mo></mover>`).(*Char)
+	if embells := y.Embellishments(); y.Rune() != 'y' || len(embells) != 1 || embells[0].Type != embHAT {
+		t.Errorf("<mover>: CHAR %q embellishments %+v, want y with hat", y.Rune(), embells)
+	}
+}
+
+func TestOpenMathMLErrors(t *testing.T) {
+	tests := []struct {
+		mathml string
+		err    error
+	}{
+		{mathmlInline + `<mfrac><mi>a</mi></mfrac></math>`, ErrInvalidMathML},
+		{mathmlInline + `<apply/></math>`, ErrUnknownElement},
+		{mathmlInline + `<mtable><mi>a</mi></mtable></math>`, ErrUnknownElement},
+		{`<foo/>`, ErrUnknownElement},
+	}
+	for _, test := range tests {
+		if _, err := OpenMathML(strings.NewReader(test.mathml)); !errors.Is(err, test.err) {
+			t.Errorf("OpenMathML(%q): %v, want %v", test.mathml, err, test.err)
+		}
+	}
+
+	var syntaxErr *xml.SyntaxError
+	if _, err := OpenMathML(strings.NewReader(mathmlInline + `<mi>a</math>`)); !errors.As(err, &syntaxErr) {
+		t.Errorf("OpenMathML of broken XML: %v, want xml.SyntaxError", err)
+	}
+}
+
+//fixture的MathML输出再导入，转换出来的结果不变
+func TestOpenMathMLFixtures(t *testing.T) {
+	for _, file := range []string{"oleObject1.bin", "oleObject2.bin", "oleObject3.bin", "oleObject4.bin", "oleObject5.bin"} {
+		want, err := openFixture(t, file).TranslateMathML()
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		eqn, err := OpenMathML(strings.NewReader(want))
+		if err != nil {
+			t.Fatalf("%v: OpenMathML(%q): %v", file, want, err)
+		}
+		if mathml, err := eqn.TranslateMathML(); err != nil || mathml != want {
+			t.Errorf("%v: OpenMathML(%q).TranslateMathML() = %q, %v", file, want, mathml, err)
+		}
+	}
+}
+
+//test目录里的公式的MathML输出，oleObject2.bin是行内公式
+func TestMathMLFixtures(t *testing.T) {
+	tests := []struct {
+		file   string
+		mathml string
+	}{
+		{"oleObject1.bin", mathmlBlock + `<mfrac><mrow><mo>−</mo><mi>b</mi><mo>±</mo><msqrt><mrow><msup><mi>b</mi><mn>2</mn></msup><mo>−</mo><mn>4</mn><mi>a</mi><mi>c</mi></mrow></msqrt></mrow><mrow><mn>2</mn><mi>a</mi></mrow></mfrac></math>`},
+		{"oleObject2.bin", mathmlInline + `<mrow><msub><mo>∰</mo><mn>222</mn></msub><mn>11</mn></mrow></math>`},
+		{"oleObject3.bin", mathmlBlock + `<mfrac><mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mn>1</mn></mrow><mover accent="true"><mi>y</mi><mo>ˆ</mo></mover></mfrac></math>`},
+		{"oleObject4.bin", mathmlBlock + `<mrow><msqrt><msub><mi>a</mi><mi>i</mi></msub></msqrt><mo>=</mo><mn>0</mn></mrow></math>`},
+		{"oleObject5.bin", mathmlBlock + `<mrow><msup><mover accent="true"><mi>y</mi><mo>ˆ</mo></mover><mo>′</mo></msup><mo>=</mo><mi>x</mi></mrow></math>`},
+	}
+	for _, test := range tests {
+		eqn := openFixture(t, test.file)
+		if mathml, err := eqn.TranslateMathML(); err != nil || mathml != test.mathml {
+			t.Errorf("%v: TranslateMathML() = %q, %v, want %q", test.file, mathml, err, test.mathml)
+		}
+	}
+}
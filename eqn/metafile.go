@@ -0,0 +1,197 @@
+package eqn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+//MathType在Word的预览图(word/media下的WMF/EMF)里面也保存了一份MTEF数据，
+//放在comment record里，每个comment的结构：
+//	"AppsMFCC"(8) | version(2) | totalLen(4) | dataLen(4) | "Design Science, Inc.\0" | data(dataLen)
+//数据比较大的时候会拆成多个comment，按顺序拼起来，直到totalLen
+
+const (
+	wmfPlaceableKey = uint32(0x9AC6CDD7)
+	wmfPlaceableLen = 22
+	wmfEOF          = uint16(0x0000)
+	wmfEscape       = uint16(0x0626)
+	wmfMfComment    = uint16(0x000F)
+
+	emfHeader     = uint32(1)
+	emfEOF        = uint32(14)
+	emfGdiComment = uint32(70)
+)
+
+var (
+	mfccSignature = []byte("AppsMFCC")
+	mfccAppSig    = []byte("Design Science, Inc.")
+)
+
+var ErrNoMetafileMTEF = errors.New("no MathType data in metafile")
+
+//从WMF/EMF里面读取MTEF数据并解析
+func OpenMetafile(reader io.Reader) (eqn *MTEFv5, err error) {
+	data, err := ExtractMetafile(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenMTEF(bytes.NewReader(data))
+}
+
+//从WMF/EMF的comment record里面找到MTEF数据，拼接后返回
+func ExtractMetafile(reader io.Reader) ([]byte, error) {
+	data, length, err := metafilePayload(reader)
+	if err != nil {
+		return nil, err
+	}
+	return data[:length], nil
+}
+
+//返回comment里拼起来的所有数据和其中MTEF数据的长度，长度按totalLen，带EQNOLEFILEHDR的时候按CbObject，
+//后面多出来的是补齐的数据
+func metafilePayload(reader io.Reader) (data []byte, length int, err error) {
+	buffer, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var comments [][]byte
+	if isEMF(buffer) {
+		comments = emfComments(buffer)
+	} else {
+		comments = wmfComments(buffer)
+	}
+
+	var mtef bytes.Buffer
+	var total uint32
+	for _, comment := range comments {
+		chunk, totalLen, ok := readMFCC(comment)
+		if !ok {
+			continue
+		}
+
+		total = totalLen
+		mtef.Write(chunk)
+		if uint32(mtef.Len()) >= total {
+			break
+		}
+	}
+
+	if mtef.Len() == 0 {
+		return nil, 0, ErrNoMetafileMTEF
+	}
+
+	data = mtef.Bytes()
+	length = len(data)
+	if total > 0 && uint32(length) > total {
+		length = int(total)
+	}
+
+	//有的版本会带上EQNOLEFILEHDR，需要去掉
+	if length > int(oleCbHdr) && binary.LittleEndian.Uint16(data) == oleCbHdr {
+		if hdr, err := readOleHeader(data[:oleCbHdr]); err == nil && int(hdr.CbObject) < length-int(oleCbHdr) {
+			length = int(oleCbHdr) + int(hdr.CbObject)
+		}
+		data = data[oleCbHdr:]
+		length -= int(oleCbHdr)
+	}
+	return data, length, nil
+}
+
+func isEMF(buffer []byte) bool {
+	//EMR_HEADER的第40个字节开始是" EMF"签名
+	return len(buffer) >= 44 &&
+		binary.LittleEndian.Uint32(buffer) == emfHeader &&
+		bytes.Equal(buffer[40:44], []byte(" EMF"))
+}
+
+func wmfComments(buffer []byte) (comments [][]byte) {
+	pos := 0
+
+	//跳过Aldus placeable header
+	if len(buffer) >= 4 && binary.LittleEndian.Uint32(buffer) == wmfPlaceableKey {
+		pos = wmfPlaceableLen
+	}
+
+	//META_HEADER，HeaderSize的单位是WORD
+	if len(buffer) < pos+18 {
+		return nil
+	}
+	pos += int(binary.LittleEndian.Uint16(buffer[pos+2:])) * 2
+
+	for pos+6 <= len(buffer) {
+		//RecordSize的单位是WORD，包含RecordSize和RecordFunction
+		size := int(binary.LittleEndian.Uint32(buffer[pos:])) * 2
+		function := binary.LittleEndian.Uint16(buffer[pos+4:])
+		if function == wmfEOF || size < 6 || pos+size > len(buffer) {
+			break
+		}
+
+		//META_ESCAPE: EscapeFunction(2) | ByteCount(2) | data
+		if function == wmfEscape && size >= 10 {
+			params := buffer[pos+6 : pos+size]
+			if binary.LittleEndian.Uint16(params) == wmfMfComment {
+				count := int(binary.LittleEndian.Uint16(params[2:]))
+				if 4+count <= len(params) {
+					comments = append(comments, params[4:4+count])
+				}
+			}
+		}
+
+		pos += size
+	}
+
+	return comments
+}
+
+func emfComments(buffer []byte) (comments [][]byte) {
+	pos := 0
+	for pos+8 <= len(buffer) {
+		recordType := binary.LittleEndian.Uint32(buffer[pos:])
+		size := int(binary.LittleEndian.Uint32(buffer[pos+4:]))
+		if recordType == emfEOF || size < 8 || pos+size > len(buffer) {
+			break
+		}
+
+		//EMR_GDICOMMENT: Type(4) | Size(4) | DataSize(4) | data
+		if recordType == emfGdiComment && size >= 12 {
+			count := int(binary.LittleEndian.Uint32(buffer[pos+8:]))
+			if 12+count <= size {
+				comments = append(comments, buffer[pos+12:pos+12+count])
+			}
+		}
+
+		pos += size
+	}
+
+	return comments
+}
+
+func readMFCC(comment []byte) (chunk []byte, totalLen uint32, ok bool) {
+	//"AppsMFCC" | version | totalLen | dataLen
+	headerLen := len(mfccSignature) + 2 + 4 + 4
+	if len(comment) < headerLen || !bytes.HasPrefix(comment, mfccSignature) {
+		return nil, 0, false
+	}
+
+	pos := len(mfccSignature) + 2
+	totalLen = binary.LittleEndian.Uint32(comment[pos:])
+	dataLen := int(binary.LittleEndian.Uint32(comment[pos+4:]))
+	pos = headerLen
+
+	//只要Design Science写入的数据
+	end := bytes.IndexByte(comment[pos:], 0)
+	if end < 0 || !bytes.Equal(comment[pos:pos+end], mfccAppSig) {
+		return nil, 0, false
+	}
+	pos += end + 1
+
+	if pos+dataLen > len(comment) {
+		return nil, 0, false
+	}
+	return comment[pos : pos+dataLen], totalLen, true
+}
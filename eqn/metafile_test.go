@@ -0,0 +1,130 @@
+package eqn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+//按照[MS-WMF]和[MS-EMF]手工构造的预览图，MathType的数据放在comment里
+
+//MathType写的comment：AppsMFCC、version、totalLen、dataLen、"Design Science, Inc.\0"、数据
+func mfccComment(total int, chunk []byte) []byte {
+	comment := new(bytes.Buffer)
+	comment.WriteString("AppsMFCC")
+	_ = binary.Write(comment, binary.LittleEndian, uint16(1))
+	_ = binary.Write(comment, binary.LittleEndian, uint32(total))
+	_ = binary.Write(comment, binary.LittleEndian, uint32(len(chunk)))
+	comment.WriteString("Design Science, Inc.\x00")
+	comment.Write(chunk)
+	return comment.Bytes()
+}
+
+//Aldus placeable header + META_HEADER，每个comment是一个META_ESCAPE(MFCOMMENT)，最后是META_EOF
+func testWMF(comments ...[]byte) []byte {
+	wmf := new(bytes.Buffer)
+	le := func(data ...interface{}) {
+		for _, d := range data {
+			_ = binary.Write(wmf, binary.LittleEndian, d)
+		}
+	}
+
+	//key、hmf、bounding box、inch、reserved、checksum
+	le(uint32(0x9AC6CDD7), uint16(0), [4]int16{0, 0, 1000, 500}, uint16(1440), uint32(0), uint16(0))
+	//type、header size(WORD)、version、size、objects、max record、members
+	le(uint16(1), uint16(9), uint16(0x0300), uint32(0), uint16(0), uint32(0), uint16(0))
+	for _, comment := range comments {
+		data := comment
+		if len(data)%2 == 1 {
+			data = append(append([]byte{}, data...), 0)
+		}
+		//record size(WORD)、META_ESCAPE、MFCOMMENT、byte count
+		le(uint32(5+len(data)/2), uint16(0x0626), uint16(0x000F), uint16(len(comment)))
+		wmf.Write(data)
+	}
+	le(uint32(3), uint16(0))
+	return wmf.Bytes()
+}
+
+//EMR_HEADER，每个comment是一个EMR_GDICOMMENT，最后是EMR_EOF
+func testEMF(comments ...[]byte) []byte {
+	emf := new(bytes.Buffer)
+	le := func(data ...interface{}) {
+		for _, d := range data {
+			_ = binary.Write(emf, binary.LittleEndian, d)
+		}
+	}
+
+	//type、size、bounds、frame、" EMF"、version、bytes、records、handles、reserved、description、palette、device、millimeters
+	le(uint32(1), uint32(88), [4]int32{}, [4]int32{}, uint32(0x464D4520), uint32(0x10000),
+		uint32(0), uint32(0), uint16(0), uint16(0), uint32(0), uint32(0), uint32(0), [2]int32{}, [2]int32{})
+	for _, comment := range comments {
+		padded := append(append([]byte{}, comment...), make([]byte, (4-len(comment)%4)%4)...)
+		le(uint32(70), uint32(12+len(padded)), uint32(len(comment)))
+		emf.Write(padded)
+	}
+	le(uint32(14), uint32(20), uint32(0), uint32(16), uint32(20))
+	return emf.Bytes()
+}
+
+func testMTEF(t *testing.T) []byte {
+	t.Helper()
+	data, err := New(NewLine(NewChar('a', int(fnVARIABLE)), NewChar('+', int(fnSYMBOL)), NewChar('b', int(fnVARIABLE)))).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestExtractMetafile(t *testing.T) {
+	mtef := testMTEF(t)
+	half := len(mtef) / 2
+
+	//带EQNOLEFILEHDR的数据，CbObject后面还有补齐的0
+	hdr := new(bytes.Buffer)
+	_ = binary.Write(hdr, binary.LittleEndian, OleHeader{CbHdr: oleCbHdr, Version: eqnOleVersion, ClipboardFormat: eqnClipboardFormat, CbObject: uint32(len(mtef))})
+	withHeader := append(append(hdr.Bytes(), mtef...), 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"WMF", testWMF(mfccComment(len(mtef), mtef))},
+		//其他程序的comment跳过，拆开的数据按顺序拼起来
+		{"WMF in two comments", testWMF([]byte("not MathType"), mfccComment(len(mtef), mtef[:half]), mfccComment(len(mtef), mtef[half:]))},
+		{"WMF with EQNOLEFILEHDR", testWMF(mfccComment(len(withHeader), withHeader))},
+		{"EMF", testEMF(mfccComment(len(mtef), mtef))},
+		{"EMF in two comments", testEMF(mfccComment(len(mtef), mtef[:half]), mfccComment(len(mtef), mtef[half:]))},
+		//totalLen后面多出来的数据不是MTEF
+		{"EMF with trailing bytes", testEMF(mfccComment(len(mtef), append(append([]byte{}, mtef...), 0, 0)))},
+	}
+	for _, test := range tests {
+		data, err := ExtractMetafile(bytes.NewReader(test.data))
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(data, mtef) {
+			t.Errorf("%v: ExtractMetafile = %x, want %x", test.name, data, mtef)
+		}
+	}
+
+	//Design Science以外的程序写的AppsMFCC也不是MTEF
+	other := bytes.Replace(mfccComment(len(mtef), mtef), []byte("Design Science"), []byte("Other Company!"), 1)
+	for _, data := range [][]byte{testWMF(), testEMF([]byte("comment")), testWMF(other)} {
+		if _, err := ExtractMetafile(bytes.NewReader(data)); !errors.Is(err, ErrNoMetafileMTEF) {
+			t.Errorf("ExtractMetafile without MathType data: %v, want %v", err, ErrNoMetafileMTEF)
+		}
+	}
+}
+
+func TestOpenMetafile(t *testing.T) {
+	eqn, err := OpenMetafile(bytes.NewReader(testEMF(mfccComment(len(testMTEF(t)), testMTEF(t)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latex, err := eqn.Translate(); err != nil || latex != "$$ a+b $$" {
+		t.Errorf("Translate() = %q, %v", latex, err)
+	}
+}
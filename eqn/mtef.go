@@ -2,12 +2,12 @@ package eqn
 
 import (
 	"bytes"
-	"container/list"
 	"encoding/binary"
 	"fmt"
 	"github.com/extrame/ole2"
 	"io"
-	"log"
+	"io/ioutil"
+	"strconv"
 )
 
 const oleCbHdr = uint16(28)
@@ -22,187 +22,233 @@ type MTEFv5 struct {
 	mApplication string
 	mInline      uint8
 
+	//EQNOLEFILEHDR，不是从OLE对象读取的时候为nil
+	oleHeader *OleHeader
+
 	reader io.ReadSeeker
 
-	ast   *MtAST
-	nodes []*MtAST
+	ast *MtAST
+
+	//COLOR_DEF、FONT_STYLE_DEF、FONT_DEF、ENCODING_DEF，按出现的顺序保存
+	colorDefs     []*MtColorDef
+	fontStyleDefs []*MtfontStyleDef
+	fontDefs      []*MtfontDef
+	encodingDefs  []string
+	eqnPrefs      *MtEqnPrefs
 
 	//是否合法，顺利解析
 	Valid bool
+
+	//是否渲染nudge（手动微调的位置），默认忽略
+	RenderNudges bool
 }
 
-func (m *MTEFv5) readRecord() (err error) {
-	/**
-	读取body的每一行数据并保存到数组里
-	*/
-	//默认设置为合法的，除非遇到不可解析数据
-	m.Valid = true
-
-	//Header
-	_ = binary.Read(m.reader, binary.LittleEndian, &m.mMtefVer)
-	_ = binary.Read(m.reader, binary.LittleEndian, &m.mPlatform)
-	_ = binary.Read(m.reader, binary.LittleEndian, &m.mProduct)
-	_ = binary.Read(m.reader, binary.LittleEndian, &m.mVersion)
-	_ = binary.Read(m.reader, binary.LittleEndian, &m.mVersionSub)
-	m.mApplication, _ = m.readNullTerminatedString()
-	_ = binary.Read(m.reader, binary.LittleEndian, &m.mInline)
+func (m *MTEFv5) readHeader() (err error) {
+	if err = m.read(&m.mMtefVer, &m.mPlatform, &m.mProduct, &m.mVersion, &m.mVersionSub); err != nil {
+		return err
+	}
+
+	//MTEFv3和MTEFv4的header只有上面5个字节，没有application key和equation options
+	if m.mMtefVer < 5 {
+		return nil
+	}
+
+	if m.mApplication, err = m.readNullTerminatedString(); err != nil {
+		return err
+	}
 
 	//fmt.Println(m.mMtefVer, m.mPlatform, m.mProduct, m.mVersion, m.mVersionSub)
 	//fmt.Println(m.mInline)
-	//fmt.Println(m.reader)
+	return m.read(&m.mInline)
+}
+
+func (m *MTEFv5) nextRecord() (node *MtAST, offset int64, err error) {
+	/**
+	读取下一个record，数据结束的时候返回io.EOF
+	*/
+	//Equation Editor 3.0 保存的是MTEFv3数据，record结构和v5不同
+	if m.mMtefVer == 3 {
+		return m.nextRecordV3()
+	}
 
-	//Body
 	for {
+		//记录record的开始位置，出错的时候返回
+		offset = m.offset()
+
 		record := RecordType(0)
 		err = binary.Read(m.reader, binary.LittleEndian, &record)
+		if err != nil {
+			if err == io.EOF {
+				return nil, offset, err
+			}
+			return nil, offset, newParseError(offset, record, err)
+		}
 
 		// 根据future定义，>=100的后面会跟一个字节，这个字节代表需要跳过的长度
 		//For now, readers can assume that an unsigned integer follows the record type and is the number of bytes following it in the record
 		//This makes it easy for software that reads MTEF to skip these records.
 		if record >= FUTURE {
 			var skipFutureLength uint8
-			_ = binary.Read(m.reader, binary.LittleEndian, &skipFutureLength)
-
-			_, _ = m.reader.Seek(int64(skipFutureLength), io.SeekCurrent)
+			if err = m.read(&skipFutureLength); err == nil {
+				_, err = m.reader.Seek(int64(skipFutureLength), io.SeekCurrent)
+			}
+			if err != nil {
+				return nil, offset, newParseError(offset, record, err)
+			}
 			continue
 		}
 
 		//debug 使用
 		//fmt.Println(record)
 
-		if err != nil {
-			break
-		}
 		switch record {
-		case END:
-			m.nodes = append(m.nodes, &MtAST{END, nil, nil})
+		case END, FULL, SUB, SUB2, SYM, SUBSYM:
+			node = &MtAST{record, nil, nil}
 		case LINE:
 			line := new(MtLine)
-			_ = m.readLine(line)
+			err = m.readLine(line)
 
-			m.nodes = append(m.nodes, &MtAST{LINE, line, nil})
+			node = &MtAST{LINE, line, nil}
 		case CHAR:
 			char := new(MtChar)
-			_ = m.readChar(char)
+			if m.mMtefVer == 4 {
+				err = m.readCharV4(char)
+			} else {
+				err = m.readChar(char)
+			}
 
-			m.nodes = append(m.nodes, &MtAST{CHAR, char, nil})
+			node = &MtAST{CHAR, char, nil}
 		case TMPL:
 			tmpl := new(MtTmpl)
-			_ = m.readTMPL(tmpl)
+			err = m.readTMPL(tmpl)
 
-			m.nodes = append(m.nodes, &MtAST{TMPL, tmpl, nil})
+			node = &MtAST{TMPL, tmpl, nil}
 		case PILE:
 			pile := new(MtPile)
-			_ = m.readPile(pile)
+			err = m.readPile(pile)
 
-			m.nodes = append(m.nodes, &MtAST{PILE, pile, nil})
+			node = &MtAST{PILE, pile, nil}
 		case MATRIX:
 			matrix := new(MtMatrix)
-			_ = m.readMatrix(matrix)
-
-			m.nodes = append(m.nodes, &MtAST{MATRIX, matrix, nil})
+			err = m.readMatrix(matrix)
 
-			//匹配矩阵数据下面的2个nil
-			m.nodes = append(m.nodes, &MtAST{LINE, new(MtLine), nil})
-			m.nodes = append(m.nodes, &MtAST{LINE, new(MtLine), nil})
+			node = &MtAST{MATRIX, matrix, nil}
 		case EMBELL:
+			//MTEFv4的EMBELL和v5一样，见mtef4.go
 			embell := new(MtEmbellRd)
-			_ = m.readEmbell(embell)
+			err = m.readEmbell(embell)
 
-			m.nodes = append(m.nodes, &MtAST{tag: EMBELL, value: embell, children: nil})
+			node = &MtAST{tag: EMBELL, value: embell, children: nil}
 		case FONT_STYLE_DEF:
+			//MTEFv4同一个值是FONT record
+			if m.mMtefVer == 4 {
+				if err = m.readFont(); err != nil {
+					return nil, offset, newParseError(offset, FONT, err)
+				}
+				continue
+			}
+
 			fsDef := new(MtfontStyleDef)
-			_ = binary.Read(m.reader, binary.LittleEndian, &fsDef.fontDefIndex)
-			fsDef.name, _ = m.readNullTerminatedString()
+			err = m.read(&fsDef.fontDefIndex, &fsDef.style)
 
-			//读取字节，但是不关心数据，注释
-			//m.nodes = append(m.nodes, &MtAST{FONT_STYLE_DEF, fsDef, nil})
+			node = &MtAST{FONT_STYLE_DEF, fsDef, nil}
 		case SIZE:
 			mtSize := new(MtSize)
-			_ = binary.Read(m.reader, binary.LittleEndian, &mtSize.lsize)
-			_ = binary.Read(m.reader, binary.LittleEndian, &mtSize.dsize)
-		case SUB:
-			m.nodes = append(m.nodes, &MtAST{SUB, nil, nil})
-		case SUB2:
-			m.nodes = append(m.nodes, &MtAST{SUB2, nil, nil})
-		case SYM:
-			m.nodes = append(m.nodes, &MtAST{SYM, nil, nil})
-		case SUBSYM:
-			m.nodes = append(m.nodes, &MtAST{SUBSYM, nil, nil})
+			err = m.readSize(mtSize)
+
+			node = &MtAST{SIZE, mtSize, nil}
 		case FONT_DEF:
 			fdef := new(MtfontDef)
-			_ = binary.Read(m.reader, binary.LittleEndian, &fdef.encDefIndex)
-			fdef.name, _ = m.readNullTerminatedString()
+			if err = m.read(&fdef.encDefIndex); err == nil {
+				fdef.name, err = m.readNullTerminatedString()
+			}
 
-			m.nodes = append(m.nodes, &MtAST{FONT_DEF, fdef, nil})
+			node = &MtAST{FONT_DEF, fdef, nil}
 		case COLOR:
 			cIndex := new(MtColorDefIndex)
-			_ = binary.Read(m.reader, binary.LittleEndian, &cIndex.index)
+			err = m.read(&cIndex.index)
 
-			//读取字节，但是不关心数据，注释
-			//m.nodes = append(m.nodes, &MtAST{tag: COLOR, value: cIndex, children: nil})
+			node = &MtAST{tag: COLOR, value: cIndex, children: nil}
 		case COLOR_DEF:
 			cDef := new(MtColorDef)
-			_ = m.readColorDef(cDef)
+			err = m.readColorDef(cDef)
 
-			//读取字节，但是不关心数据，注释
-			//m.nodes = append(m.nodes, &MtAST{tag: COLOR_DEF, value: cDef, children: nil})
-		case FULL:
-			m.nodes = append(m.nodes, &MtAST{FULL, nil, nil})
+			node = &MtAST{tag: COLOR_DEF, value: cDef, children: nil}
 		case EQN_PREFS:
 			prefs := new(MtEqnPrefs)
-			_ = m.readEqnPrefs(prefs)
+			err = m.readEqnPrefs(prefs)
 
-			m.nodes = append(m.nodes, &MtAST{EQN_PREFS, prefs, nil})
+			node = &MtAST{EQN_PREFS, prefs, nil}
 		case ENCODING_DEF:
-			enc, _ := m.readNullTerminatedString()
+			//MTEFv4没有ENCODING_DEF
+			if m.mMtefVer < 5 {
+				return nil, offset, newParseError(offset, record, ErrUnknownRecord)
+			}
+
+			var enc string
+			enc, err = m.readNullTerminatedString()
 
-			m.nodes = append(m.nodes, &MtAST{ENCODING_DEF, enc, nil})
+			node = &MtAST{ENCODING_DEF, enc, nil}
 		default:
-			m.Valid = false
-			log.Println("FUTURE RECORD", record)
+			return nil, offset, newParseError(offset, record, ErrUnknownRecord)
 		}
+
+		if err != nil {
+			return nil, offset, newParseError(offset, record, err)
+		}
+		return node, offset, nil
 	}
+}
 
+func (m *MTEFv5) read(data ...interface{}) (err error) {
+	for _, d := range data {
+		if err = binary.Read(m.reader, binary.LittleEndian, d); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (m *MTEFv5) offset() int64 {
+	offset, _ := m.reader.Seek(0, io.SeekCurrent)
+	return offset
+}
+
 func (m *MTEFv5) readNullTerminatedString() (s string, err error) {
 	buf, p := bytes.Buffer{}, []byte{0}
 	for {
-		_, err = m.reader.Read(p)
+		if _, err = io.ReadFull(m.reader, p); err != nil {
+			return buf.String(), err
+		}
 		if p[0] == 0 {
 			break
 		}
 		buf.WriteByte(p[0])
 	}
-	return buf.String(), err
+	return buf.String(), nil
 }
 
 func (m *MTEFv5) readLine(line *MtLine) (err error) {
 	options := OptionType(0)
-	err = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&options); err != nil {
+		return err
+	}
 
 	if MtefOptNudge == MtefOptNudge&options {
-		line.nudgeX, line.nudgeY, _ = m.readNudge()
+		if line.nudgeX, line.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
 	}
 	if MtefOptLineLspace == MtefOptLineLspace&options {
-		_ = binary.Read(m.reader, binary.LittleEndian, &line.lineSpace)
+		if err = m.read(&line.lineSpace); err != nil {
+			return err
+		}
 	}
 
-	//RULER解析
+	//RULER是一个完整的record，包括RULER tag
 	if mtefOPT_LP_RULER == mtefOPT_LP_RULER&options {
-		var nStops uint8
-		_ = binary.Read(m.reader, binary.LittleEndian, &nStops)
-
-		var tabList []uint8
-		for i := uint8(0); i < nStops; i++ {
-			var stopVal uint8
-			_ = binary.Read(m.reader, binary.LittleEndian, &stopVal)
-			tabList = append(tabList, stopVal)
-
-			var tabOffset uint16
-			_ = binary.Read(m.reader, binary.LittleEndian, &tabOffset)
+		if line.ruler, err = m.readRulerRecord(); err != nil {
+			return err
 		}
 	}
 
@@ -210,82 +256,88 @@ func (m *MTEFv5) readLine(line *MtLine) (err error) {
 		line.null = true
 	}
 
-	return err
+	return nil
 }
 
-func (m *MTEFv5) readDimensionArrays(size int64) (array []string, err error) {
+func (m *MTEFv5) readRulerRecord() (ruler *MtRuler, err error) {
+	tag := RecordType(0)
+	if err = m.read(&tag); err != nil {
+		return nil, err
+	}
+	if tag != RULER {
+		return nil, fmt.Errorf("expect RULER record, got %v", tag)
+	}
+
+	ruler = new(MtRuler)
+	return ruler, m.readRuler(ruler)
+}
+
+func (m *MTEFv5) readRuler(ruler *MtRuler) (err error) {
+	var nStops uint8
+	if err = m.read(&nStops); err != nil {
+		return err
+	}
+
+	//按顺序串成链表
+	var last *MtTabStop
+	for i := uint8(0); i < nStops; i++ {
+		stop := new(MtTabStop)
+		if err = m.read(&stop._type, &stop.offset); err != nil {
+			return err
+		}
+
+		if last == nil {
+			ruler.tabStopList = stop
+		} else {
+			last.next = stop
+		}
+		last = stop
+		ruler.nStops++
+	}
+
+	return nil
+}
+
+func (m *MTEFv5) readDimensionArrays(size int64) (array []Dimension, err error) {
+	/**
+	每个值由半字节组成：第一个是单位，后面是数字、小数点或负号，0x0f结束
+	*/
 	var flag = true
+	var unit DimensionUnit
 	var tmpStr = new(bytes.Buffer)
 	var count = int64(0)
 
-	var fx = func(x uint8) {
+	var fx = func(x uint8) error {
 		if flag {
-			switch x {
-			case 0x00:
-				flag = false
-				tmpStr.WriteString("in")
-			case 0x01:
-				flag = false
-				tmpStr.WriteString("cm")
-			case 0x02:
-				flag = false
-				tmpStr.WriteString("pt")
-			case 0x03:
-				flag = false
-				tmpStr.WriteString("pc")
-			case 0x04:
-				flag = false
-				tmpStr.WriteString("%")
-			default:
-				fmt.Println("invalid bytes")
+			if DimensionUnit(x) > UnitPercent {
+				return fmt.Errorf("invalid dimension unit %#x", x)
 			}
-		} else {
-			switch x {
-			case 0x00:
-				flag = false
-				tmpStr.WriteByte('0')
-			case 0x01:
-				flag = false
-				tmpStr.WriteByte('1')
-			case 0x02:
-				flag = false
-				tmpStr.WriteByte('2')
-			case 0x03:
-				flag = false
-				tmpStr.WriteByte('3')
-			case 0x04:
-				flag = false
-				tmpStr.WriteByte('4')
-			case 0x05:
-				flag = false
-				tmpStr.WriteByte('5')
-			case 0x06:
-				flag = false
-				tmpStr.WriteByte('6')
-			case 0x07:
-				flag = false
-				tmpStr.WriteByte('7')
-			case 0x08:
-				flag = false
-				tmpStr.WriteByte('8')
-			case 0x09:
-				flag = false
-				tmpStr.WriteByte('9')
-			case 0x0a:
-				flag = false
-				tmpStr.WriteByte('.')
-			case 0x0b:
-				flag = false
-				tmpStr.WriteByte('-')
-			case 0x0f:
-				flag = true
-				count += 1
-				array = append(array, tmpStr.String())
-				tmpStr.Reset()
-			default:
-				fmt.Println("invalid bytes")
+			flag = false
+			unit = DimensionUnit(x)
+			return nil
+		}
+
+		switch {
+		case x <= 0x09:
+			tmpStr.WriteByte('0' + x)
+		case x == 0x0a:
+			tmpStr.WriteByte('.')
+		case x == 0x0b:
+			tmpStr.WriteByte('-')
+		case x == 0x0f:
+			value, err := strconv.ParseFloat(tmpStr.String(), 64)
+			if err != nil {
+				return err
 			}
+
+			flag = true
+			count += 1
+			array = append(array, Dimension{Value: value, Unit: unit})
+			tmpStr.Reset()
+		default:
+			return fmt.Errorf("invalid dimension nibble %#x", x)
 		}
+		return nil
 	}
 
 	for {
@@ -294,45 +346,69 @@ func (m *MTEFv5) readDimensionArrays(size int64) (array []string, err error) {
 			break
 		}
 		ch := uint8(0)
-		_ = binary.Read(m.reader, binary.LittleEndian, &ch)
+		if err = m.read(&ch); err != nil {
+			return array, err
+		}
 
 		//fmt.Println("ch=", ch)
 
 		hi := (ch & 0xf0) / 16
 		lo := ch & 0x0f
-		fx(hi)
-		fx(lo)
+		if err = fx(hi); err != nil {
+			return array, err
+		}
+
+		//最后一个值在高4位结束的时候，低4位是填充数据
+		if count >= size {
+			break
+		}
+		if err = fx(lo); err != nil {
+			return array, err
+		}
 	}
 	return array, nil
 }
 
 func (m *MTEFv5) readEqnPrefs(eqnPrefs *MtEqnPrefs) (err error) {
-	options := uint8(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&eqnPrefs.options); err != nil {
+		return err
+	}
 
 	//sizes
 	size := uint8(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &size)
-	eqnPrefs.sizes, _ = m.readDimensionArrays(int64(size))
+	if err = m.read(&size); err != nil {
+		return err
+	}
+	if eqnPrefs.sizes, err = m.readDimensionArrays(int64(size)); err != nil {
+		return err
+	}
 
 	//spaces
 	size = 0
-	_ = binary.Read(m.reader, binary.LittleEndian, &size)
-	eqnPrefs.spaces, _ = m.readDimensionArrays(int64(size))
+	if err = m.read(&size); err != nil {
+		return err
+	}
+	if eqnPrefs.spaces, err = m.readDimensionArrays(int64(size)); err != nil {
+		return err
+	}
 
-	//styles
+	//styles，每个是[font_def index][style]，index为0的时候没有style
 	size = 0
-	_ = binary.Read(m.reader, binary.LittleEndian, &size)
-	styles := make([]byte, size)
+	if err = m.read(&size); err != nil {
+		return err
+	}
+	styles := make([]MtfontStyleDef, 0, size)
 	for i := uint8(0); i < size; i++ {
-		c := uint8(0)
-		_ = binary.Read(m.reader, binary.LittleEndian, &c)
-		if c == 0 {
-			styles = append(styles, 0)
-		} else {
-			_ = binary.Read(m.reader, binary.LittleEndian, &c)
-			styles = append(styles, c)
+		style := MtfontStyleDef{}
+		if err = m.read(&style.fontDefIndex); err != nil {
+			return err
+		}
+		if style.fontDefIndex != 0 {
+			if err = m.read(&style.style); err != nil {
+				return err
+			}
 		}
+		styles = append(styles, style)
 	}
 	eqnPrefs.styles = styles
 	return nil
@@ -340,27 +416,40 @@ func (m *MTEFv5) readEqnPrefs(eqnPrefs *MtEqnPrefs) (err error) {
 
 func (m *MTEFv5) readChar(char *MtChar) (err error) {
 	options := OptionType(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&options); err != nil {
+		return err
+	}
+	char.options = uint8(options)
 
 	if MtefOptNudge == MtefOptNudge&options {
-		char.nudgeX, char.nudgeY, _ = m.readNudge()
+		if char.nudgeX, char.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
 	}
 
-	_ = binary.Read(m.reader, binary.LittleEndian, &char.typeface)
+	if err = m.read(&char.typeface); err != nil {
+		return err
+	}
 
 	if MtefOptCharEncNoMtcode != MtefOptCharEncNoMtcode&options {
-		_ = binary.Read(m.reader, binary.LittleEndian, &char.mtcode)
+		if err = m.read(&char.mtcode); err != nil {
+			return err
+		}
 	}
 	if MtefOptCharEncChar8 == MtefOptCharEncChar8&options {
 		//todo 强行设置值，有BUG。。。。。
 		//if char.mtcode >= 34528 {
 		//	_ = binary.Read(m.reader, binary.LittleEndian, &char.bits16)
 		//}else {
-		_ = binary.Read(m.reader, binary.LittleEndian, &char.bits8)
+		if err = m.read(&char.bits8); err != nil {
+			return err
+		}
 		//}
 	}
 	if MtefOptCharEncChar16 == MtefOptCharEncChar16&options {
-		_ = binary.Read(m.reader, binary.LittleEndian, &char.bits16)
+		if err = m.read(&char.bits16); err != nil {
+			return err
+		}
 	}
 
 	//fmt.Println(char)
@@ -369,308 +458,230 @@ func (m *MTEFv5) readChar(char *MtChar) (err error) {
 }
 
 func (m *MTEFv5) readNudge() (nudgeX int16, nudgeY int16, err error) {
-	b1 := 0
-	b2 := 0
-	_ = binary.Read(m.reader, binary.LittleEndian, &b1)
-	_ = binary.Read(m.reader, binary.LittleEndian, &b2)
-
-	if b1 == 128 || b2 == 128 {
-		_ = binary.Read(m.reader, binary.LittleEndian, &nudgeX)
-		_ = binary.Read(m.reader, binary.LittleEndian, &nudgeY)
-		return nudgeX, nudgeY, err
-	} else {
-		nudgeX = int16(b1)
-		nudgeY = int16(b2)
+	/**
+	-128 < dx, dy < 128 的时候是2个字节，每个字节加了128偏移
+	否则2个字节都是128，后面跟着2个int16，只有一个字节是128的时候是0
+	*/
+	var b1, b2 uint8
+	if err = m.read(&b1, &b2); err != nil {
+		return 0, 0, err
+	}
+
+	if b1 == 128 && b2 == 128 {
+		err = m.read(&nudgeX, &nudgeY)
 		return nudgeX, nudgeY, err
 	}
+
+	return int16(b1) - 128, int16(b2) - 128, nil
 }
 
 func (m *MTEFv5) readTMPL(tmpl *MtTmpl) (err error) {
 	options := OptionType(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&options); err != nil {
+		return err
+	}
 
 	if MtefOptNudge == MtefOptNudge&options {
-		tmpl.nudgeX, tmpl.nudgeY, _ = m.readNudge()
+		if tmpl.nudgeX, tmpl.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+	if err = m.read(&tmpl.selector); err != nil {
+		return err
 	}
-	_ = binary.Read(m.reader, binary.LittleEndian, &tmpl.selector)
 
 	// variation, 1 or 2 bytes
 	byte1 := uint8(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &byte1)
+	if err = m.read(&byte1); err != nil {
+		return err
+	}
 	if 0x80 == byte1&0x80 {
 		byte2 := uint8(0)
-		_ = binary.Read(m.reader, binary.LittleEndian, &byte2)
+		if err = m.read(&byte2); err != nil {
+			return err
+		}
 		tmpl.variation = (uint16(byte1) & 0x7F) | (uint16(byte2) << 8)
 	} else {
 		tmpl.variation = uint16(byte1)
 	}
-	_ = binary.Read(m.reader, binary.LittleEndian, &tmpl.options)
-	return nil
+	return m.read(&tmpl.options)
 }
 
 func (m *MTEFv5) readPile(pile *MtPile) (err error) {
 	options := OptionType(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&options); err != nil {
+		return err
+	}
 
 	if MtefOptNudge == MtefOptNudge&options {
-		pile.nudgeX, pile.nudgeY, _ = m.readNudge()
+		if pile.nudgeX, pile.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
 	}
 
 	//读取halign和valign
-	_ = binary.Read(m.reader, binary.LittleEndian, &pile.halign)
-	_ = binary.Read(m.reader, binary.LittleEndian, &pile.valign)
+	if err = m.read(&pile.halign, &pile.valign); err != nil {
+		return err
+	}
 
-	return nil
+	//RULER是一个完整的record，包括RULER tag
+	if mtefOPT_LP_RULER == mtefOPT_LP_RULER&options {
+		pile.ruler, err = m.readRulerRecord()
+	}
+	return err
 }
 
 func (m *MTEFv5) readMatrix(matrix *MtMatrix) (err error) {
 	options := OptionType(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&options); err != nil {
+		return err
+	}
 
 	if MtefOptNudge == MtefOptNudge&options {
-		matrix.nudgeX, matrix.nudgeY, _ = m.readNudge()
+		if matrix.nudgeX, matrix.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
 	}
 
-	//读取valign和h_just、v_just
-	_ = binary.Read(m.reader, binary.LittleEndian, &matrix.valign)
-	_ = binary.Read(m.reader, binary.LittleEndian, &matrix.h_just)
-	_ = binary.Read(m.reader, binary.LittleEndian, &matrix.v_just)
+	//读取valign和h_just、v_just，rows和cols
+	//fmt.Printf("%v", matrix)
+	if err = m.read(&matrix.valign, &matrix.h_just, &matrix.v_just, &matrix.rows, &matrix.cols); err != nil {
+		return err
+	}
 
-	//读取rows和cols
-	_ = binary.Read(m.reader, binary.LittleEndian, &matrix.rows)
-	_ = binary.Read(m.reader, binary.LittleEndian, &matrix.cols)
+	return m.readMatrixParts(matrix)
+}
 
-	//fmt.Printf("%v", matrix)
-	return nil
+func (m *MTEFv5) readMatrixParts(matrix *MtMatrix) (err error) {
+	//row_parts和col_parts：每条分隔线2个bit，共rows+1和cols+1条
+	matrix.rowParts = make([]byte, (2*(int(matrix.rows)+1)+7)/8)
+	matrix.colParts = make([]byte, (2*(int(matrix.cols)+1)+7)/8)
+	if _, err = io.ReadFull(m.reader, matrix.rowParts); err != nil {
+		return err
+	}
+	_, err = io.ReadFull(m.reader, matrix.colParts)
+	return err
 }
 
 func (m *MTEFv5) readEmbell(embell *MtEmbellRd) (err error) {
 	options := OptionType(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&options); err != nil {
+		return err
+	}
 
 	if MtefOptNudge == MtefOptNudge&options {
-		embell.nudgeX, embell.nudgeY, _ = m.readNudge()
+		if embell.nudgeX, embell.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
 	}
 
 	//读取embellishment type
-	_ = binary.Read(m.reader, binary.LittleEndian, &embell.embellType)
-	return nil
+	return m.read(&embell.embellType)
+}
+
+func (m *MTEFv5) readSize(mtSize *MtSize) (err error) {
+	var lsize uint8
+	if err = m.read(&lsize); err != nil {
+		return err
+	}
+
+	switch lsize {
+	case 101:
+		//101后面是2个字节的字号，单位1/32 point
+		mtSize.lsize = lsize
+		err = m.read(&mtSize.dsize)
+	case 100:
+		//100后面是1个字节的lsize和2个字节的dsize
+		err = m.read(&mtSize.lsize, &mtSize.dsize)
+	default:
+		//dsize加了128偏移
+		var dsize uint8
+		mtSize.lsize = lsize
+		err = m.read(&dsize)
+		mtSize.dsize = int16(dsize) - 128
+	}
+
+	return err
 }
 
 func (m *MTEFv5) readColorDef(colorDef *MtColorDef) (err error) {
-	options := OptionType(0)
-	_ = binary.Read(m.reader, binary.LittleEndian, &options)
+	if err = m.read(&colorDef.options); err != nil {
+		return err
+	}
+	options := colorDef.options
 
-	var color uint16
+	//CMYK读4个值，RGB读3个值
+	count := 3
 	if mtefCOLOR_CMYK == mtefCOLOR_CMYK&options {
-		//CMYK，读4个值
-		for i := 0; i < 4; i++ {
-			_ = binary.Read(m.reader, binary.LittleEndian, &color)
-			colorDef.values = append(colorDef.values, uint8(color))
-		}
-	} else {
-		//	RGB，读3个值
-		for i := 0; i < 3; i++ {
-			_ = binary.Read(m.reader, binary.LittleEndian, &color)
-			colorDef.values = append(colorDef.values, uint8(color))
+		count = 4
+	}
+
+	var color uint16
+	for i := 0; i < count; i++ {
+		if err = m.read(&color); err != nil {
+			return err
 		}
+		colorDef.values = append(colorDef.values, color)
 	}
 
 	if mtefCOLOR_NAME == mtefCOLOR_NAME&options {
-		colorDef.name, _ = m.readNullTerminatedString()
+		colorDef.name, err = m.readNullTerminatedString()
 	}
 
-	return nil
+	return err
 }
 
-func (m *MTEFv5) Translate() string {
+//把公式转换成LaTeX，公式里有还没实现的TMPL时返回*LatexError，还没实现的EMBELL时返回ErrNotImplemented
+func (m *MTEFv5) Translate() (string, error) {
 	latexStr, err := m.makeLatex(m.ast)
 	if err != nil {
-		fmt.Println(err)
+		return "", err
 	}
 
-	if m.Valid {
-		return latexStr
-	} else {
-		return ""
+	if !m.Valid {
+		return "", ErrNotImplemented
 	}
-
+	return latexStr, nil
 }
 
-func (m *MTEFv5) makeAST() (err error) {
-	/**
-	根据数组生成出栈入栈结构
-	*/
-	ast := new(MtAST)
-	ast.tag = 0xff
-	ast.value = nil
-	m.ast = ast
-
-	stack := list.New()
-	stack.PushBack(ast)
-
-	for _, node := range m.nodes {
-		//debug 可用
-		//fmt.Printf("%+v %+v \n", node.tag, node.value)
-
-		switch node.tag {
-		case LINE:
-			if stack.Len() > 0 {
-				ele := stack.Back()
-
-				//将对象强制转为MtAST类型
-				parent := ele.Value.(*MtAST)
-
-				parent.children = append(parent.children, node)
-			}
-			if !node.value.(*MtLine).null {
-				//如果与0 <nil> 匹配，则需要入栈
-				stack.PushBack(node)
-			}
-		case TMPL:
-			if stack.Len() > 0 {
-				ele := stack.Back()
-
-				//将对象强制转为MtAST类型
-				parent := ele.Value.(*MtAST)
-
-				parent.children = append(parent.children, node)
-			}
-
-			//如果与0 <nil> 匹配，则需要入栈
-			stack.PushBack(node)
-		case PILE:
-			if stack.Len() > 0 {
-				ele := stack.Back()
-
-				//将对象强制转为MtAST类型
-				parent := ele.Value.(*MtAST)
-
-				parent.children = append(parent.children, node)
-			}
-
-			//如果与0 <nil> 匹配，则需要入栈
-			stack.PushBack(node)
-		case MATRIX:
-			if stack.Len() > 0 {
-				ele := stack.Back()
-
-				//将对象强制转为MtAST类型
-				parent := ele.Value.(*MtAST)
-
-				parent.children = append(parent.children, node)
-			}
-
-			//如果与0 <nil> 匹配，则需要入栈
-			stack.PushBack(node)
-		case END:
-			if stack.Len() > 0 {
-				ele := stack.Back()
-				stack.Remove(ele)
-			}
-		case CHAR:
-			if stack.Len() > 0 {
-				ele := stack.Back()
-
-				//将对象强制转为MtAST类型
-				parent := ele.Value.(*MtAST)
-
-				parent.children = append(parent.children, node)
-			} else if stack.Len() == 0 {
-				//never go there
-				ast.children = append(ast.children, node)
-			}
-		case EMBELL:
-			if stack.Len() > 0 {
-				//读取父节点
-				ele := stack.Back()
-
-				//并将对象强制转为MtAST类型
-				parent := ele.Value.(*MtAST)
-				parent.children = append(parent.children, node)
-
-				switch EmbellType(node.value.(*MtEmbellRd).embellType) {
-				//数据结构中，这些数据是在字符后面，但是在latex展示中某些字符需要在字符前面
-				//比如： $$ \hat y $$
-				//所以我们需要交换最后2位
-				case emb1DOT, embHAT, embOBAR:
-					if len(parent.children) >= 2 {
-						embellData := parent.children[len(parent.children)-1]
-						charData := parent.children[len(parent.children)-2]
-						parent.children = parent.children[:len(parent.children)-2]
-
-						parent.children = append(parent.children, embellData, charData)
-					}
-				}
-			}
-
-			//如果与0 <nil> 匹配，则需要入栈
-			stack.PushBack(node)
-
-			//case COLOR_DEF:
-			//	/*
-			//	这个数据结构有3或4个（RGB或者CMYK）对应的nil，所以需要循环把每个值都push到栈里面
-			//
-			//	16 &{values:[0 0 0] name:}
-			//	0 <nil>
-			//	0 <nil>
-			//	0 <nil>
-			//	 */
-			//
-			//	colorList := node.value.(*MtColorDef).values
-			//	if len(colorList) > 0 {
-			//		//读取每个color的值，然后入栈
-			//		for _, val := range colorList {
-			//			//如果与0 <nil> 匹配，则需要入栈
-			//			stack.PushBack(val)
-			//		}
-			//	}
-			//case FONT_STYLE_DEF:
-			//	/*
-			//	这个数据结构如下，所以需要配对6个入栈
-			//	8 &{fontDefIndex:1 name:}
-			//	0 <nil>
-			//	0 <nil>
-			//	0 <nil>
-			//	0 <nil>
-			//	0 <nil>
-			//	0 <nil>
-			//	*/
-			//
-			//	fontIndex := node.value.(*MtfontStyleDef).fontDefIndex
-			//	if fontIndex == 1 {
-			//		for i := 0; i < 6; i++ {
-			//			//如果与0 <nil> 匹配，则需要入栈
-			//			stack.PushBack(0)
-			//		}
-			//	}
-		}
+func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
+	latex, err = m.makeObjectLatex(ast)
+	nudgeX, nudgeY, ok := renderedNudge(ast, m.RenderNudges)
+	if err != nil || !ok {
+		return latex, err
 	}
-
-	//m.ast.debug(0)
-	return nil
+	return nudgeLatex(latex, nudgeX, nudgeY), nil
 }
 
-func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
+func (m *MTEFv5) makeObjectLatex(ast *MtAST) (latex string, err error) {
 	/**
 	根据出栈入栈结构生成latex字符串
 	*/
 
 	buf := new(bytes.Buffer)
 
+	//子节点的latex，出错的时候记住第一个错误，最后和结果一起返回
+	slotLatex := func(ast *MtAST) string {
+		latex, _err := m.makeLatex(ast)
+		if err == nil {
+			err = _err
+		}
+		return latex
+	}
+
 	switch ast.tag {
 	case ROOT:
 		buf.WriteString("$$ ")
 		for _, _ast := range ast.children {
-			_latex, _ := m.makeLatex(_ast)
+			_latex := slotLatex(_ast)
 			buf.WriteString(_latex)
 		}
 		buf.WriteString(" $$")
-		return buf.String(), nil
+		return buf.String(), err
 	case CHAR:
 		mtcode := ast.value.(*MtChar).mtcode
 		typeface := ast.value.(*MtChar).typeface
-		char := string(mtcode)
+		char := string(rune(mtcode))
 
 		//生成char的一些特殊集
 		hexExtend := ""
@@ -707,21 +718,34 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			char = fmt.Sprintf(typefaceFmt, char)
 		}
 
+		//embellishment按顺序从里到外包在字符上，比如 \dot{ \bar{ x } }，prime放在最外面
+		for _, embell := range orderedEmbells(ast.value.(*MtChar)) {
+			if char, err = m.embellLatex(embell, char); err != nil {
+				return "", err
+			}
+		}
+
 		buf.WriteString(char)
-		return buf.String(), nil
+		return buf.String(), err
 	case TMPL:
 		//强制类型转换为MtTmpl
 		tmpl := ast.value.(*MtTmpl)
+		slots := ast.slots()
+
+		//解析的时候定界符的CHAR可以省略，下面按下标读取slot，个数不够的时候不能转换
+		if need := latexSlots[SelectorType(tmpl.selector)]; len(slots) < need {
+			return "", &LatexError{Template: &Template{ast}, Err: fmt.Errorf("%w: %d slots, latex needs %d", ErrObjectCount, len(slots), need)}
+		}
 
 		switch SelectorType(tmpl.selector) {
 		case tmANGLE:
-			mainAST := ast.children[0]
-			leftAST := ast.children[1]
-			rightAST := ast.children[2]
+			mainAST := slots[0]
+			leftAST := slots[1]
+			rightAST := slots[2]
 
-			mainSlot, _ := m.makeLatex(mainAST)
-			leftSlot, _ := m.makeLatex(leftAST)
-			rightSlot, _ := m.makeLatex(rightAST)
+			mainSlot := slotLatex(mainAST)
+			leftSlot := slotLatex(leftAST)
+			rightSlot := slotLatex(rightAST)
 
 			//转成latex代码
 			var mainStr, leftStr, rightStr string
@@ -736,16 +760,16 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			}
 
 			buf.WriteString(fmt.Sprintf("%v %v %v", leftStr, mainStr, rightStr))
-			return buf.String(), nil
+			return buf.String(), err
 
 		case tmPAREN:
-			mainAST := ast.children[0]
-			leftAST := ast.children[1]
-			rightAST := ast.children[2]
+			mainAST := slots[0]
+			leftAST := slots[1]
+			rightAST := slots[2]
 
-			mainSlot, _ := m.makeLatex(mainAST)
-			leftSlot, _ := m.makeLatex(leftAST)
-			rightSlot, _ := m.makeLatex(rightAST)
+			mainSlot := slotLatex(mainAST)
+			leftSlot := slotLatex(leftAST)
+			rightSlot := slotLatex(rightAST)
 
 			//转成latex代码
 			var mainStr, leftStr, rightStr string
@@ -760,16 +784,16 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			}
 
 			buf.WriteString(fmt.Sprintf("%v %v %v", leftStr, mainStr, rightStr))
-			return buf.String(), nil
+			return buf.String(), err
 		case tmBRACE:
 			var mainSlot, leftSlot, rightSlot string
-			for idx, astData := range ast.children {
+			for idx, astData := range slots {
 				if idx == 0 {
-					mainSlot, _ = m.makeLatex(astData)
+					mainSlot = slotLatex(astData)
 				} else if idx == 1 {
-					leftSlot, _ = m.makeLatex(astData)
+					leftSlot = slotLatex(astData)
 				} else {
-					rightSlot, _ = m.makeLatex(astData)
+					rightSlot = slotLatex(astData)
 				}
 			}
 
@@ -784,29 +808,29 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 				"\\left %v \\begin{array}{l} %v \\end{array} \\right%v",
 				leftSlot, mainSlot, rightSlot))
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmBRACK:
-			mainAST := ast.children[0]
-			leftAST := ast.children[1]
-			rightAST := ast.children[2]
-			mainSlot, _ := m.makeLatex(mainAST)
+			mainAST := slots[0]
+			leftAST := slots[1]
+			rightAST := slots[2]
+			mainSlot := slotLatex(mainAST)
 			if mainSlot == "" {
 				mainSlot = "\\space"
 			}
-			leftSlot, _ := m.makeLatex(leftAST)
-			rightSlot, _ := m.makeLatex(rightAST)
+			leftSlot := slotLatex(leftAST)
+			rightSlot := slotLatex(rightAST)
 			buf.WriteString(fmt.Sprintf("\\left%v %v \\right%v", leftSlot, mainSlot, rightSlot))
-			return buf.String(), nil
+			return buf.String(), err
 		case tmBAR:
 			//读取数据 ParBoxClass
 			var mainSlot, leftSlot, rightSlot string
-			for idx, astData := range ast.children {
+			for idx, astData := range slots {
 				if idx == 0 {
-					mainSlot, _ = m.makeLatex(astData)
+					mainSlot = slotLatex(astData)
 				} else if idx == 1 {
-					leftSlot, _ = m.makeLatex(astData)
+					leftSlot = slotLatex(astData)
 				} else {
-					rightSlot, _ = m.makeLatex(astData)
+					rightSlot = slotLatex(astData)
 				}
 			}
 
@@ -832,17 +856,17 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v %v", leftStr, mainStr, rightStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmINTERVAL:
 			//读取数据 ParBoxClass
-			mainAST := ast.children[0]
-			leftAST := ast.children[1]
-			rightAST := ast.children[2]
+			mainAST := slots[0]
+			leftAST := slots[1]
+			rightAST := slots[2]
 
 			//读取latex数据
-			mainSlot, _ := m.makeLatex(mainAST)
-			leftSlot, _ := m.makeLatex(leftAST)
-			rightSlot, _ := m.makeLatex(rightAST)
+			mainSlot := slotLatex(mainAST)
+			leftSlot := slotLatex(leftAST)
+			rightSlot := slotLatex(rightAST)
 
 			//转成latex代码
 			var mainStr, leftStr, rightStr string
@@ -860,21 +884,21 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v %v", leftStr, mainStr, rightStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmROOT:
-			mainAST := ast.children[0]
-			radiAST := ast.children[1]
-			mainSlot, _ := m.makeLatex(mainAST)
-			radiSlot, _ := m.makeLatex(radiAST)
+			mainAST := slots[0]
+			radiAST := slots[1]
+			mainSlot := slotLatex(mainAST)
+			radiSlot := slotLatex(radiAST)
 			buf.WriteString(fmt.Sprintf("\\sqrt[%v] { %v }", radiSlot, mainSlot))
-			return buf.String(), nil
+			return buf.String(), err
 		case tmFRACT:
-			numAST := ast.children[0]
-			denAST := ast.children[1]
-			numSlot, _ := m.makeLatex(numAST)
-			denSlot, _ := m.makeLatex(denAST)
+			numAST := slots[0]
+			denAST := slots[1]
+			numSlot := slotLatex(numAST)
+			denSlot := slotLatex(denAST)
 			buf.WriteString(fmt.Sprintf("\\frac { %v } { %v }", numSlot, denSlot))
-			return buf.String(), nil
+			return buf.String(), err
 		case tmARROW:
 			/*
 				variation	symbol	description
@@ -888,12 +912,12 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 				0×0010	tvAR_LOS	if double or harpoon, large over small
 				0×0020	tvAR_SOL	if double or harpoon, small over large
 			*/
-			topAST := ast.children[0]
-			bottomAST := ast.children[1]
+			topAST := slots[0]
+			bottomAST := slots[1]
 
 			//读取latex数据
-			topSlot, _ := m.makeLatex(topAST)
-			bottomSlot, _ := m.makeLatex(bottomAST)
+			topSlot := slotLatex(topAST)
+			bottomSlot := slotLatex(bottomAST)
 
 			//转成latex代码
 			var topStr, bottomStr string
@@ -934,17 +958,17 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 					if arrowStyle == "single" && variationsMap[vCode] == "pointLeft" {
 						latexFmt = latexFmt + "leftarrow"
 					} else if arrowStyle == "double" && variationsMap[vCode] == "pointLeft" {
-						fmt.Println("not implement double , large over small")
+						return "", newTemplateLatexError(ast)
 					} else if arrowStyle == "harpoon" && variationsMap[vCode] == "pointLeft" {
-						fmt.Println("not implement harpoon, large over small")
+						return "", newTemplateLatexError(ast)
 					}
 
 					if arrowStyle == "single" && variationsMap[vCode] == "pointRight" {
 						latexFmt = latexFmt + "rightarrow"
 					} else if arrowStyle == "double" && variationsMap[vCode] == "pointRight" {
-						fmt.Println("not implement double , small over large")
+						return "", newTemplateLatexError(ast)
 					} else if arrowStyle == "harpoon" && variationsMap[vCode] == "pointRight" {
-						fmt.Println("not implement harpoon, small over large")
+						return "", newTemplateLatexError(ast)
 					}
 				}
 			}
@@ -956,13 +980,13 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v %v", latexFmt, bottomStr, topStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmUBAR:
 			//读取数据
-			mainAST := ast.children[0]
+			mainAST := slots[0]
 
 			//读取latex数据
-			mainSlot, _ := m.makeLatex(mainAST)
+			mainSlot := slotLatex(mainAST)
 
 			//转成latex代码
 			var mainStr string
@@ -975,19 +999,19 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			buf.WriteString(tmplStr)
 
 			//返回数据
-			return buf.String(), nil
+			return buf.String(), err
 		case tmSUM:
 			//读取数据 BigOpBoxClass
 			var mainSlot, upperSlot, lowerSlot, operatorSlot string
-			for idx, astData := range ast.children {
+			for idx, astData := range slots {
 				if idx == 0 {
-					mainSlot, _ = m.makeLatex(astData)
+					mainSlot = slotLatex(astData)
 				} else if idx == 1 {
-					lowerSlot, _ = m.makeLatex(astData)
+					lowerSlot = slotLatex(astData)
 				} else if idx == 2 {
-					upperSlot, _ = m.makeLatex(astData)
+					upperSlot = slotLatex(astData)
 				} else {
-					operatorSlot, _ = m.makeLatex(astData)
+					operatorSlot = slotLatex(astData)
 				}
 			}
 
@@ -1007,17 +1031,17 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v %v %v", operatorSlot, lowerStr, upperStr, mainStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmLIM:
 			//读取数据 LimBoxClass
 			var mainSlot, lowerSlot, upperSlot string
-			for idx, astData := range ast.children {
+			for idx, astData := range slots {
 				if idx == 0 {
-					mainSlot, _ = m.makeLatex(astData)
+					mainSlot = slotLatex(astData)
 				} else if idx == 1 {
-					lowerSlot, _ = m.makeLatex(astData)
+					lowerSlot = slotLatex(astData)
 				} else {
-					upperSlot, _ = m.makeLatex(astData)
+					upperSlot = slotLatex(astData)
 				}
 			}
 
@@ -1037,12 +1061,12 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v %v", mainStr, lowerStr, upperStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmSUP:
-			subAST := ast.children[0]
-			supAST := ast.children[1]
-			subSlot, _ := m.makeLatex(subAST)
-			supSlot, _ := m.makeLatex(supAST)
+			subAST := slots[0]
+			supAST := slots[1]
+			subSlot := slotLatex(subAST)
+			supSlot := slotLatex(supAST)
 
 			buf.WriteString(" ^ { ")
 			buf.WriteString(supSlot)
@@ -1052,15 +1076,15 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 				buf.WriteString(subSlot)
 				buf.WriteString(" } ")
 			}
-			return buf.String(), nil
+			return buf.String(), err
 		case tmSUB:
 			//读取下标和上标
-			subAST := ast.children[0]
-			supAST := ast.children[1]
+			subAST := slots[0]
+			supAST := slots[1]
 
 			//读取latex数据
-			subSlot, _ := m.makeLatex(subAST)
-			supSlot, _ := m.makeLatex(supAST)
+			subSlot := slotLatex(subAST)
+			supSlot := slotLatex(supAST)
 
 			//转成latex代码
 			var subFmt, supFmt string
@@ -1076,15 +1100,15 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			buf.WriteString(tmplStr)
 
 			//返回数据
-			return buf.String(), nil
+			return buf.String(), err
 		case tmSUBSUP:
 			//读取下标和上标
-			subAST := ast.children[0]
-			supAST := ast.children[1]
+			subAST := slots[0]
+			supAST := slots[1]
 
 			//读取latex数据
-			subSlot, _ := m.makeLatex(subAST)
-			supSlot, _ := m.makeLatex(supAST)
+			subSlot := slotLatex(subAST)
+			supSlot := slotLatex(supAST)
 
 			//转成latex代码
 			var subFmt, supFmt string
@@ -1100,7 +1124,7 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			buf.WriteString(tmplStr)
 
 			//返回数据
-			return buf.String(), nil
+			return buf.String(), err
 		case tmVEC:
 			/*
 				variations：
@@ -1119,10 +1143,10 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			*/
 
 			//读取数据 HatBoxClass
-			mainAST := ast.children[0]
+			mainAST := slots[0]
 
 			//读取latex数据
-			mainSlot, _ := m.makeLatex(mainAST)
+			mainSlot := slotLatex(mainAST)
 
 			//转成latex代码
 			var mainStr string
@@ -1161,15 +1185,15 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v", topStr, mainStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmHAT:
 			//读取数据 HatBoxClass
-			mainAST := ast.children[0]
-			topAST := ast.children[1]
+			mainAST := slots[0]
+			topAST := slots[1]
 
 			//读取latex数据
-			mainSlot, _ := m.makeLatex(mainAST)
-			topSlot, _ := m.makeLatex(topAST)
+			mainSlot := slotLatex(mainAST)
+			topSlot := slotLatex(topAST)
 
 			//转成latex代码
 			var mainStr, topStr string
@@ -1184,15 +1208,15 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v", topStr, mainStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
+			return buf.String(), err
 		case tmARC:
 			//读取数据 HatBoxClass
-			mainAST := ast.children[0]
-			topAST := ast.children[1]
+			mainAST := slots[0]
+			topAST := slots[1]
 
 			//读取latex数据
-			mainSlot, _ := m.makeLatex(mainAST)
-			topSlot, _ := m.makeLatex(topAST)
+			mainSlot := slotLatex(mainAST)
+			topSlot := slotLatex(topAST)
 
 			//转成latex代码
 			var mainStr, topStr string
@@ -1207,19 +1231,13 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 			tmplStr := fmt.Sprintf("%v %v", topStr, mainStr)
 			buf.WriteString(tmplStr)
 
-			return buf.String(), nil
-		default:
-			m.Valid = false
-			log.Println("TMPL NOT IMPLEMENT", tmpl.selector, tmpl.variation)
-		}
-		for _, _ast := range ast.children {
-			_latex, _ := m.makeLatex(_ast)
-			buf.WriteString(_latex)
+			return buf.String(), err
 		}
-		return buf.String(), nil
+		return "", newTemplateLatexError(ast)
 	case PILE:
-		for idx, _ast := range ast.children {
-			_latex, _ := m.makeLatex(_ast)
+		slots := ast.slots()
+		for idx, _ast := range slots {
+			_latex := slotLatex(_ast)
 
 			//多个line字符串数据以 \\ 分割
 			if idx > 0 {
@@ -1228,20 +1246,17 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 
 			buf.WriteString(_latex)
 		}
-		return buf.String(), nil
+		return buf.String(), err
 	case MATRIX:
+		slots := ast.slots()
 		matrixCol := int(ast.value.(*MtMatrix).cols)
-		for idx, _ast := range ast.children {
-			_latex, _ := m.makeLatex(_ast)
-
-			if idx == 0 {
-				buf.WriteString(" \\begin{array} {} ")
-				continue
-			}
-
+		buf.WriteString(" \\begin{array} {} ")
+		for idx, _ast := range slots {
+			_latex := slotLatex(_ast)
 			buf.WriteString(_latex)
 
-			if idx%matrixCol == 0 {
+			//每行最后一个元素后面换行
+			if matrixCol > 0 && (idx+1)%matrixCol == 0 {
 				buf.WriteString(" \\\\ ")
 			} else {
 				buf.WriteString(" & ")
@@ -1249,52 +1264,131 @@ func (m *MTEFv5) makeLatex(ast *MtAST) (latex string, err error) {
 		}
 
 		buf.WriteString(" \\end{array} ")
-		return buf.String(), nil
+		return buf.String(), err
 	case LINE:
-		for _, _ast := range ast.children {
-			_latex, _ := m.makeLatex(_ast)
-			buf.WriteString(_latex)
-		}
-		return buf.String(), nil
-	case EMBELL:
-		embellType := EmbellType(ast.value.(*MtEmbellRd).embellType)
-		var embellStr string
-
-		switch embellType {
-		case emb1DOT:
-			embellStr = " \\dot "
-		case emb1PRIME:
-			embellStr = "'"
-		case emb2PRIME:
-			embellStr = "''"
-		case emb3PRIME:
-			embellStr = "'''"
-		case embHAT:
-			embellStr = " \\hat "
-		case embOBAR:
-			embellStr = " \\bar "
-		default:
-			log.Println("not implement embell:", embellType)
+		//line开始时的字号是template决定的，latex的上下标已经会自动缩小，只输出作者手动修改的字号
+		size := ast.value.(*MtLine).size
+		for _, run := range lineRuns(ast) {
+			if run.size != size {
+				buf.WriteString(sizeLatex[run.size])
+				size = run.size
+			}
+			for _, _ast := range run.nodes {
+				buf.WriteString(slotLatex(_ast))
+			}
 		}
-
-		buf.WriteString(embellStr)
-		return buf.String(), nil
+		return buf.String(), err
 	}
 
 	return "", nil
 }
 
+//makeObjectLatex按下标读取的slot个数，没有列出的template按实际的slot个数转换
+var latexSlots = map[SelectorType]int{
+	tmANGLE: 3, tmPAREN: 3, tmBRACK: 3, tmINTERVAL: 3,
+	tmROOT: 2, tmFRACT: 2, tmARROW: 2, tmUBAR: 1,
+	tmSUP: 2, tmSUB: 2, tmSUBSUP: 2,
+	tmVEC: 1, tmHAT: 2, tmARC: 2,
+}
+
+//字号对应的latex style，SUBSYM是上下标里的大型运算符，和上下标一样是\scriptstyle
+var sizeLatex = map[RecordType]string{
+	FULL:   " \\textstyle ",
+	SUB:    " \\scriptstyle ",
+	SUB2:   " \\scriptscriptstyle ",
+	SYM:    " \\displaystyle ",
+	SUBSYM: " \\scriptstyle ",
+}
+
+//embellishment对应的latex格式，%v是字符
+var embellFormats = map[EmbellType]string{
+	emb1DOT:      "\\dot{ %v }",
+	emb2DOT:      "\\ddot{ %v }",
+	emb3DOT:      "\\dddot{ %v }",
+	emb4DOT:      "\\ddddot{ %v }",
+	emb1PRIME:    "%v'",
+	emb2PRIME:    "%v''",
+	emb3PRIME:    "%v'''",
+	embBPRIME:    "{ %v }^{ \\backprime }",
+	embTILDE:     "\\tilde{ %v }",
+	embHAT:       "\\hat{ %v }",
+	embNOT:       "\\not{ %v }",
+	embRARROW:    "\\overrightarrow{ %v }",
+	embLARROW:    "\\overleftarrow{ %v }",
+	embBARROW:    "\\overleftrightarrow{ %v }",
+	embR1ARROW:   "\\overset{ \\rightharpoonup }{ %v }",
+	embL1ARROW:   "\\overset{ \\leftharpoonup }{ %v }",
+	embMBAR:      "\\rlap{ - }{ %v }",
+	embOBAR:      "\\bar{ %v }",
+	embFROWN:     "\\overset{ \\frown }{ %v }",
+	embSMILE:     "\\overset{ \\smile }{ %v }",
+	embX_BARS:    "\\xcancel{ %v }",
+	embUP_BAR:    "\\cancel{ %v }",
+	embDOWN_BAR:  "\\bcancel{ %v }",
+	embU_1DOT:    "\\underset{ \\cdot }{ %v }",
+	embU_2DOT:    "\\underset{ \\cdot\\cdot }{ %v }",
+	embU_3DOT:    "\\underset{ \\cdot\\cdot\\cdot }{ %v }",
+	embU_4DOT:    "\\underset{ \\cdot\\cdot\\cdot\\cdot }{ %v }",
+	embU_BAR:     "\\underline{ %v }",
+	embU_TILDE:   "\\underset{ \\sim }{ %v }",
+	embU_FROWN:   "\\underset{ \\frown }{ %v }",
+	embU_SMILE:   "\\underset{ \\smile }{ %v }",
+	embU_RARROW:  "\\underrightarrow{ %v }",
+	embU_LARROW:  "\\underleftarrow{ %v }",
+	embU_BARROW:  "\\underleftrightarrow{ %v }",
+	embU_R1ARROW: "\\underset{ \\rightharpoonup }{ %v }",
+	embU_L1ARROW: "\\underset{ \\leftharpoonup }{ %v }",
+}
+
+func (m *MTEFv5) embellLatex(embell *MtEmbell, char string) (string, error) {
+	embellType := EmbellType(embell.embell)
+	format, ok := embellFormats[embellType]
+	if !ok {
+		return "", fmt.Errorf("mtef: latex %v: %w", embellType, ErrNotImplemented)
+	}
+
+	if m.RenderNudges && significantNudges(embell.nudgeX, embell.nudgeY) {
+		postfix := embellMarks[embellType].kind == "script"
+		return nudgeEmbellLatex(format, postfix, char, embell.nudgeX, embell.nudgeY), nil
+	}
+	return fmt.Sprintf(format, char), nil
+}
+
 //[MTEF Storage](https://docs.wiris.com/en/mathtype/mathtype_desktop/mathtype-sdk/mtefstorage)
 func Open(reader io.ReadSeeker) (eqn *MTEFv5, err error) {
+	hdr, stream, err := readEquationNative(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	eqn, err = OpenMTEF(bytes.NewReader(stream[:hdr.CbObject]))
+	if err != nil {
+		return nil, err
+	}
+	eqn.oleHeader = &hdr
+	return eqn, nil
+}
+
+//返回OLE对象里面的MTEF数据，不包括EQNOLEFILEHDR
+func ExtractOLE(reader io.ReadSeeker) ([]byte, error) {
+	hdr, stream, err := readEquationNative(reader)
+	if err != nil {
+		return nil, err
+	}
+	return stream[:hdr.CbObject], nil
+}
+
+//返回EQNOLEFILEHDR和它后面stream里的所有数据，前面CbObject个字节是MTEF数据，后面的是补齐的数据
+func readEquationNative(reader io.ReadSeeker) (hdr OleHeader, stream []byte, err error) {
 	//parse `mtef` stream from `ole` object
 	ole, err := ole2.Open(reader, "")
 	if err != nil {
-		fmt.Println(err)
+		return hdr, nil, err
 	}
 
 	dir, err := ole.ListDir()
 	if err != nil {
-		fmt.Println(err)
+		return hdr, nil, err
 	}
 
 	for _, file := range dir {
@@ -1303,34 +1397,55 @@ func Open(reader io.ReadSeeker) (eqn *MTEFv5, err error) {
 			reader := ole.OpenFile(file, root)
 
 			hdrBuffer := make([]byte, oleCbHdr)
-			if _, err := reader.Read(hdrBuffer); err == nil {
-				hdrReader := bytes.NewReader(hdrBuffer)
-				var cbHdr = uint16(0)
-				var cbSize = uint32(0)
-
-				_ = binary.Read(hdrReader, binary.LittleEndian, &cbHdr)
-				if cbHdr != oleCbHdr {
-					return nil, err
-				}
-
-				//ignore `version: u32` and `cf: u16`
-				_, _ = hdrReader.Seek(4+2, io.SeekCurrent)
-				_ = binary.Read(hdrReader, binary.LittleEndian, &cbSize)
-
-				//body from `cbHdr` to `cbHdr + cbSize`
-				eqnBody := make([]byte, cbSize)
-				_, _ = reader.Seek(int64(cbHdr), io.SeekStart)
-				_, _ = reader.Read(eqnBody)
+			if _, err = io.ReadFull(reader, hdrBuffer); err != nil {
+				return hdr, nil, newParseError(0, ROOT, err)
+			}
 
-				eqn = new(MTEFv5)
-				eqn.reader = bytes.NewReader(eqnBody)
-				_ = eqn.readRecord()
-				_ = eqn.makeAST()
-				return eqn, nil
+			hdr, err = readOleHeader(hdrBuffer)
+			if err != nil {
+				return hdr, nil, newParseError(0, ROOT, err)
 			}
 
-			return nil, err
+			//body from `cbHdr` to `cbHdr + cbObject`，去掉EQNOLEFILEHDR后就是MTEF数据
+			if _, err = reader.Seek(int64(hdr.CbHdr), io.SeekStart); err != nil {
+				return hdr, nil, err
+			}
+			if stream, err = ioutil.ReadAll(reader); err != nil {
+				return hdr, nil, err
+			}
+			if uint32(len(stream)) < hdr.CbObject {
+				return hdr, nil, newParseError(int64(len(stream)), ROOT, io.ErrUnexpectedEOF)
+			}
+			return hdr, stream, nil
 		}
 	}
-	return nil, err
+	return hdr, nil, ErrNoEquationNative
+}
+
+//解析不带OLE包装的MTEF数据（header + body），比如剪贴板或者其他工具导出的数据
+//数据不完整或者有无法识别的record时返回*ParseError
+func OpenMTEF(reader io.Reader) (eqn *MTEFv5, err error) {
+	eqnBody, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	eqn = new(MTEFv5)
+	eqn.reader = bytes.NewReader(eqnBody)
+	if err = eqn.readHeader(); err != nil {
+		return nil, newParseError(0, ROOT, err)
+	}
+
+	//Equation Editor 3.0 保存的是MTEFv3数据，record结构和v5不同
+	//MathType 4 保存的是MTEFv4数据，和v5基本相同，CHAR和FONT record不一样
+	switch eqn.mMtefVer {
+	case 3, 4, 5:
+	default:
+		return nil, newParseError(0, ROOT, ErrUnsupportedVersion)
+	}
+
+	if err = eqn.parse(); err != nil {
+		return nil, err
+	}
+	return eqn, nil
 }
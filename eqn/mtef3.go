@@ -0,0 +1,417 @@
+package eqn
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+//[MTEFv3](https://docs.wiris.com/en/mathtype/mathtype_desktop/mathtype-sdk/mtef3)
+//Equation Editor 3.0 (Equation.3) 保存的是MTEFv3数据：
+//每个record只有一个tag字节，低4位是record类型，高4位是options，没有FONT_DEF/ENCODING_DEF
+
+//MTEFv3的FONT record，在v5中同一个值是FONT_STYLE_DEF
+const FONT RecordType = 8
+
+//MTEFv3 tag高4位的options
+const (
+	xfLMOVE  OptionType = 0x08
+	xfAUTO   OptionType = 0x01
+	xfEMBELL OptionType = 0x02
+	xfNULL   OptionType = 0x01
+	xfLSPACE OptionType = 0x04
+	xfRULER  OptionType = 0x02
+)
+
+//MTEFv3 template selectors，和v5的编号不一样，读取后需要转换成v5的selector和variation
+const (
+	tm3ANGLE   uint8 = 0
+	tm3PAREN   uint8 = 1
+	tm3BRACE   uint8 = 2
+	tm3BRACK   uint8 = 3
+	tm3BAR     uint8 = 4
+	tm3DBAR    uint8 = 5
+	tm3FLOOR   uint8 = 6
+	tm3CEILING uint8 = 7
+	tm3LBLB    uint8 = 8
+	tm3RBRB    uint8 = 9
+	tm3RBLB    uint8 = 10
+	tm3LBRP    uint8 = 11
+	tm3LPRB    uint8 = 12
+	tm3ROOT    uint8 = 13
+	tm3FRACT   uint8 = 14
+	tm3SCRIPT  uint8 = 15
+	tm3UBAR    uint8 = 16
+	tm3OBAR    uint8 = 17
+	tm3LARROW  uint8 = 18
+	tm3RARROW  uint8 = 19
+	tm3BARROW  uint8 = 20
+	tm3SINT    uint8 = 21
+	tm3DINT    uint8 = 22
+	tm3TINT    uint8 = 23
+	tm3SSINT   uint8 = 24
+	tm3DSINT   uint8 = 25
+	tm3TSINT   uint8 = 26
+	tm3UHBRACE uint8 = 27
+	tm3LHBRACE uint8 = 28
+	tm3SUM     uint8 = 29
+	tm3ISUM    uint8 = 30
+	tm3PROD    uint8 = 31
+	tm3IPROD   uint8 = 32
+	tm3COPROD  uint8 = 33
+	tm3ICOPROD uint8 = 34
+	tm3UNION   uint8 = 35
+	tm3IUNION  uint8 = 36
+	tm3INTER   uint8 = 37
+	tm3IINTER  uint8 = 38
+	tm3LIM     uint8 = 39
+	tm3LDIV    uint8 = 40
+	tm3SLFRACT uint8 = 41
+	tm3INTOP   uint8 = 42
+	tm3SUMOP   uint8 = 43
+	tm3LSCRIPT uint8 = 44
+	tm3DIRAC   uint8 = 45
+)
+
+func (m *MTEFv5) nextRecordV3() (node *MtAST, offset int64, err error) {
+	/**
+	读取MTEFv3的下一个record，生成和v5一样的节点
+	*/
+	for {
+		//记录record的开始位置，出错的时候返回
+		offset = m.offset()
+
+		tag := uint8(0)
+		err = binary.Read(m.reader, binary.LittleEndian, &tag)
+		if err != nil {
+			if err == io.EOF {
+				return nil, offset, err
+			}
+			return nil, offset, newParseError(offset, RecordType(tag&0x0f), err)
+		}
+
+		//低4位是record类型，高4位是options
+		record := RecordType(tag & 0x0f)
+		options := OptionType(tag >> 4)
+
+		switch record {
+		case END, FULL, SUB, SUB2, SYM, SUBSYM:
+			node = &MtAST{record, nil, nil}
+		case LINE:
+			line := new(MtLine)
+			err = m.readLineV3(options, line)
+
+			node = &MtAST{LINE, line, nil}
+		case CHAR:
+			char := new(MtChar)
+			err = m.readCharV3(options, char)
+
+			node = &MtAST{CHAR, char, nil}
+		case TMPL:
+			tmpl := new(MtTmpl)
+			err = m.readTmplV3(options, tmpl)
+
+			node = &MtAST{TMPL, tmpl, nil}
+		case PILE:
+			pile := new(MtPile)
+			err = m.readPileV3(options, pile)
+
+			node = &MtAST{PILE, pile, nil}
+		case MATRIX:
+			matrix := new(MtMatrix)
+			err = m.readMatrixV3(options, matrix)
+
+			node = &MtAST{MATRIX, matrix, nil}
+		case EMBELL:
+			embell := new(MtEmbellRd)
+			err = m.readEmbellV3(options, embell)
+
+			node = &MtAST{tag: EMBELL, value: embell, children: nil}
+		case RULER:
+			//单独出现的RULER没有对应的LINE/PILE，读取字节，但是不关心数据
+			if err = m.readRuler(new(MtRuler)); err == nil {
+				continue
+			}
+		case FONT:
+			if err = m.readFont(); err == nil {
+				continue
+			}
+		case SIZE:
+			//和v5的SIZE一样
+			mtSize := new(MtSize)
+			err = m.readSize(mtSize)
+
+			node = &MtAST{SIZE, mtSize, nil}
+		default:
+			return nil, offset, newParseError(offset, record, ErrUnknownRecord)
+		}
+
+		if err != nil {
+			return nil, offset, newParseError(offset, record, err)
+		}
+		return node, offset, nil
+	}
+}
+
+func (m *MTEFv5) readLineV3(options OptionType, line *MtLine) (err error) {
+	if xfLMOVE == xfLMOVE&options {
+		if line.nudgeX, line.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+	if xfLSPACE == xfLSPACE&options {
+		if err = m.read(&line.lineSpace); err != nil {
+			return err
+		}
+	}
+
+	//v3的RULER是一个完整的record，跟在LINE后面
+	if xfRULER == xfRULER&options {
+		var tag uint8
+		if err = m.read(&tag); err != nil {
+			return err
+		}
+		line.ruler = new(MtRuler)
+		if err = m.readRuler(line.ruler); err != nil {
+			return err
+		}
+	}
+
+	if xfNULL == xfNULL&options {
+		line.null = true
+	}
+
+	return nil
+}
+
+func (m *MTEFv5) readCharV3(options OptionType, char *MtChar) (err error) {
+	if xfLMOVE == xfLMOVE&options {
+		if char.nudgeX, char.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+
+	//v3只有16位的字符值，没有v5的8位/16位字体位置
+	if err = m.read(&char.typeface, &char.mtcode); err != nil {
+		return err
+	}
+
+	//转换成v5的options，后面跟着的embellishment list和v5一样以END结束
+	if xfAUTO == xfAUTO&options {
+		char.options |= uint8(MtefOptCharFuncStart)
+	}
+	if xfEMBELL == xfEMBELL&options {
+		char.options |= uint8(MtefOptCharEmbell)
+	}
+
+	return nil
+}
+
+func (m *MTEFv5) readTmplV3(options OptionType, tmpl *MtTmpl) (err error) {
+	if xfLMOVE == xfLMOVE&options {
+		if tmpl.nudgeX, tmpl.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+
+	//v3的variation只有1个字节
+	var selector, variation uint8
+	if err = m.read(&selector, &variation, &tmpl.options); err != nil {
+		return err
+	}
+
+	tmpl.selector, tmpl.variation = convertTmplV3(selector, variation)
+	return nil
+}
+
+func (m *MTEFv5) readPileV3(options OptionType, pile *MtPile) (err error) {
+	if xfLMOVE == xfLMOVE&options {
+		if pile.nudgeX, pile.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+
+	if err = m.read(&pile.halign, &pile.valign); err != nil {
+		return err
+	}
+
+	if xfRULER == xfRULER&options {
+		var tag uint8
+		if err = m.read(&tag); err != nil {
+			return err
+		}
+		pile.ruler = new(MtRuler)
+		return m.readRuler(pile.ruler)
+	}
+
+	return nil
+}
+
+func (m *MTEFv5) readMatrixV3(options OptionType, matrix *MtMatrix) (err error) {
+	if xfLMOVE == xfLMOVE&options {
+		if matrix.nudgeX, matrix.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+
+	if err = m.read(&matrix.valign, &matrix.h_just, &matrix.v_just, &matrix.rows, &matrix.cols); err != nil {
+		return err
+	}
+
+	return m.readMatrixParts(matrix)
+}
+
+//MTEFv3/v4的FONT record：typeface、style、字体名，typeface对应的字体，读取字节，但是不关心数据
+func (m *MTEFv5) readFont() (err error) {
+	var typeface int8
+	var style uint8
+	if err = m.read(&typeface, &style); err != nil {
+		return err
+	}
+	_, err = m.readNullTerminatedString()
+	return err
+}
+
+func (m *MTEFv5) readEmbellV3(options OptionType, embell *MtEmbellRd) (err error) {
+	if xfLMOVE == xfLMOVE&options {
+		if embell.nudgeX, embell.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+
+	return m.read(&embell.embellType)
+}
+
+func convertTmplV3(selector uint8, variation uint8) (uint8, uint16) {
+	/**
+	v3的selector和variation转换成v5的，这样makeLatex不用区分版本
+	*/
+
+	//v3的上下限：0 没有，1 只有下限，2 上下限都有
+	limits := func(v uint8) uint16 {
+		switch v {
+		case 1:
+			return tvBO_LOWER
+		case 2:
+			return tvBO_LOWER | tvBO_UPPER
+		}
+		return 0
+	}
+
+	//v3的上下标：0 上标，1 下标，2 上下标都有
+	script := func(v uint8) SelectorType {
+		switch v {
+		case 1:
+			return tmSUB
+		case 2:
+			return tmSUBSUP
+		}
+		return tmSUP
+	}
+
+	switch selector {
+	case tm3ANGLE, tm3PAREN, tm3BRACE, tm3BRACK, tm3BAR, tm3DBAR, tm3FLOOR, tm3CEILING:
+		//v3的括号：0 左右都有，1 只有左边，2 只有右边
+		fence := tvFENCE_L | tvFENCE_R
+		if variation == 1 {
+			fence = tvFENCE_L
+		} else if variation == 2 {
+			fence = tvFENCE_R
+		}
+		return selector, fence
+	case tm3LBLB:
+		return uint8(tmINTERVAL), tvINTV_LEFT_LB | tvINTV_RIGHT_LB
+	case tm3RBRB:
+		return uint8(tmINTERVAL), tvINTV_LEFT_RB | tvINTV_RIGHT_RB
+	case tm3RBLB:
+		return uint8(tmINTERVAL), tvINTV_LEFT_RB | tvINTV_RIGHT_LB
+	case tm3LBRP:
+		return uint8(tmINTERVAL), tvINTV_LEFT_LB | tvINTV_RIGHT_RP
+	case tm3LPRB:
+		return uint8(tmINTERVAL), tvINTV_LEFT_LP | tvINTV_RIGHT_RB
+	case tm3ROOT:
+		if variation == 1 {
+			return uint8(tmROOT), tvROOT_NTH
+		}
+		return uint8(tmROOT), tvROOT_SQ
+	case tm3FRACT:
+		if variation == 1 {
+			return uint8(tmFRACT), tvFR_SMALL
+		}
+		return uint8(tmFRACT), 0
+	case tm3SLFRACT:
+		switch variation {
+		case 1:
+			return uint8(tmFRACT), tvFR_SLASH | tvFR_BASE
+		case 2:
+			return uint8(tmFRACT), tvFR_SLASH | tvFR_SMALL
+		}
+		return uint8(tmFRACT), tvFR_SLASH
+	case tm3SCRIPT:
+		return uint8(script(variation)), 0
+	case tm3LSCRIPT:
+		return uint8(script(variation)), tvSU_PRECEDES
+	case tm3UBAR, tm3OBAR:
+		bar := tmUBAR
+		if selector == tm3OBAR {
+			bar = tmOBAR
+		}
+		if variation == 1 {
+			return uint8(bar), tvBAR_DOUBLE
+		}
+		return uint8(bar), 0
+	case tm3LARROW, tm3RARROW, tm3BARROW:
+		//v3的箭头：0 文字在上面，1 文字在下面
+		arrow := tvAR_TOP
+		if variation == 1 {
+			arrow = tvAR_BOTTOM
+		}
+		switch selector {
+		case tm3LARROW:
+			arrow |= tvAR_LEFT
+		case tm3RARROW:
+			arrow |= tvAR_RIGHT
+		default:
+			arrow |= tvAR_LEFT | tvAR_RIGHT
+		}
+		return uint8(tmARROW), arrow
+	case tm3SINT, tm3DINT, tm3TINT:
+		return uint8(tmINTEG), tvINT_1 + uint16(selector-tm3SINT) | limits(variation)
+	case tm3SSINT, tm3DSINT, tm3TSINT:
+		return uint8(tmINTEG), tvINT_1 + uint16(selector-tm3SSINT) | tvINT_LOOP | limits(variation)
+	case tm3UHBRACE:
+		return uint8(tmHBRACE), tvHB_TOP
+	case tm3LHBRACE:
+		return uint8(tmHBRACE), 0
+	case tm3SUM, tm3ISUM, tm3PROD, tm3IPROD, tm3COPROD, tm3ICOPROD, tm3UNION, tm3IUNION, tm3INTER, tm3IINTER:
+		//v3每种大型运算符有2个selector，前一个上下限在上下方，后一个在右侧(integral style)
+		bigOps := []SelectorType{tmSUM, tmPROD, tmCOPROD, tmUNION, tmINTER}
+		idx := selector - tm3SUM
+		v := limits(variation)
+		if idx%2 == 0 {
+			v |= tvBO_SUM
+		}
+		return uint8(bigOps[idx/2]), v
+	case tm3LIM:
+		return uint8(tmLIM), limits(variation)
+	case tm3LDIV:
+		if variation == 1 {
+			return uint8(tmLDIV), tvLD_UPPER
+		}
+		return uint8(tmLDIV), 0
+	case tm3INTOP:
+		return uint8(tmINTOP), limits(variation)
+	case tm3SUMOP:
+		return uint8(tmSUMOP), limits(variation) | tvBO_SUM
+	case tm3DIRAC:
+		switch variation {
+		case 1:
+			return uint8(tmDIRAC), tvDI_LEFT
+		case 2:
+			return uint8(tmDIRAC), tvDI_RIGHT
+		}
+		return uint8(tmDIRAC), tvDI_LEFT | tvDI_RIGHT
+	}
+
+	//不认识的selector原样返回，makeLatex会标记为不合法
+	return selector, uint16(variation)
+}
@@ -0,0 +1,101 @@
+package eqn
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+//读取test目录里的文件
+func openFixture(t *testing.T, file string) *MTEFv5 {
+	t.Helper()
+	eqn, err := OpenFile(path.Join("../test", file))
+	if err != nil {
+		t.Fatalf("OpenFile(%v): %v", file, err)
+	}
+	return eqn
+}
+
+//oleObject3.bin是Equation Editor 3.0保存的MTEFv3
+func TestReadV3(t *testing.T) {
+	eqn := openFixture(t, "oleObject3.bin")
+	if version := eqn.Header().MtefVersion; version != 3 {
+		t.Errorf("MTEF version = %v, want 3", version)
+	}
+	latex, err := eqn.Translate()
+	if want := `$$ \frac { x ^ { 2 } +1 } { \hat{ y } } $$`; err != nil || latex != want {
+		t.Errorf("Translate() = %q, %v, want %q", latex, err, want)
+	}
+}
+
+//tag的低4位是record类型，高4位是options
+func TestReadV3Records(t *testing.T) {
+	data := []byte{3, 1, 1, 3, 0,
+		//LINE，xfLMOVE，nudge (5, 0)
+		0x81, 133, 128,
+		//CHAR y，xfEMBELL，后面是hat和END
+		0x22, 0x83, 'y', 0,
+		0x06, 9,
+		0x00,
+		//单重积分，上下限都有：main、下限、上限（null line）
+		0x03, tm3SINT, 2, 0,
+		0x01, 0x02, 0x83, 'x', 0, 0x00,
+		0x11,
+		0x11,
+		0x00,
+		0x00,
+		0x00,
+	}
+	eqn, err := OpenMTEF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := eqn.Objects()[0].(*Line)
+	if x, y := line.Nudge(); x != 5 || y != 0 {
+		t.Errorf("LINE nudge = (%d, %d), want (5, 0)", x, y)
+	}
+	children := line.Children()
+	if len(children) != 2 {
+		t.Fatalf("LINE has %d children, want 2", len(children))
+	}
+	if char := children[0].(*Char); char.Rune() != 'y' || len(char.Embellishments()) != 1 || char.Embellishments()[0].Type != embHAT {
+		t.Errorf("CHAR %q embellishments %+v, want y with hat", char.Rune(), char.Embellishments())
+	}
+	tmpl := children[1].(*Template)
+	if tmpl.Selector() != tmINTEG || uint16(tmpl.Variation()) != tvINT_1|tvBO_LOWER|tvBO_UPPER {
+		t.Errorf("TMPL = %v %#x, want integral %#x", tmpl.Selector(), uint16(tmpl.Variation()), tvINT_1|tvBO_LOWER|tvBO_UPPER)
+	}
+	if slots := tmpl.Slots(); len(slots) != 3 || !slots[1].(*Line).Null() || !slots[2].(*Line).Null() {
+		t.Errorf("integral slots = %v, want main and two null limits", slots)
+	}
+}
+
+var convertTmplV3Tests = []struct {
+	selector, variation uint8
+	v5                  SelectorType
+	v5Variation         uint16
+}{
+	{tm3PAREN, 0, tmPAREN, tvFENCE_L | tvFENCE_R},
+	{tm3BRACK, 1, tmBRACK, tvFENCE_L},
+	{tm3LBRP, 0, tmINTERVAL, tvINTV_LEFT_LB | tvINTV_RIGHT_RP},
+	{tm3ROOT, 1, tmROOT, tvROOT_NTH},
+	{tm3SLFRACT, 2, tmFRACT, tvFR_SLASH | tvFR_SMALL},
+	{tm3SCRIPT, 1, tmSUB, 0},
+	{tm3LSCRIPT, 2, tmSUBSUP, tvSU_PRECEDES},
+	{tm3OBAR, 1, tmOBAR, tvBAR_DOUBLE},
+	{tm3BARROW, 1, tmARROW, tvAR_BOTTOM | tvAR_LEFT | tvAR_RIGHT},
+	{tm3DSINT, 1, tmINTEG, (tvINT_1 + 1) | tvINT_LOOP | tvBO_LOWER},
+	{tm3IPROD, 2, tmPROD, tvBO_LOWER | tvBO_UPPER},
+	{tm3SUM, 0, tmSUM, tvBO_SUM},
+	{tm3UHBRACE, 0, tmHBRACE, tvHB_TOP},
+}
+
+func TestConvertTmplV3(t *testing.T) {
+	for _, test := range convertTmplV3Tests {
+		selector, variation := convertTmplV3(test.selector, test.variation)
+		if SelectorType(selector) != test.v5 || variation != test.v5Variation {
+			t.Errorf("convertTmplV3(%d, %d) = %v %#x, want %v %#x", test.selector, test.variation, SelectorType(selector), variation, test.v5, test.v5Variation)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package eqn
+
+//[MTEFv4](https://docs.wiris.com/en/mathtype/mathtype_desktop/mathtype-sdk/mtef4)
+//MathType 4 保存的是MTEFv4数据，record结构和v5基本一样，不同的地方：
+//1. header没有application key和equation options（见readHeader）
+//2. 没有ENCODING_DEF
+//3. CHAR没有mtefOPT_CHAR_ENC_*选项，MTCode后面不跟字体位置
+//4. 8是FONT record（typeface、style、字体名），和v3的FONT一样（见readFont），v5里同一个值是FONT_STYLE_DEF
+//EMBELL的结构v4和v5一样：options、[nudge]、embell，options只用到mtefOPT_NUDGE，所以直接用readEmbell读取，
+//CHAR后面的embellishment list也一样以END结束
+
+func (m *MTEFv5) readCharV4(char *MtChar) (err error) {
+	options := OptionType(0)
+	if err = m.read(&options); err != nil {
+		return err
+	}
+
+	if MtefOptNudge == MtefOptNudge&options {
+		if char.nudgeX, char.nudgeY, err = m.readNudge(); err != nil {
+			return err
+		}
+	}
+
+	if err = m.read(&char.typeface, &char.mtcode); err != nil {
+		return err
+	}
+
+	//只保留v4有的选项，embellishment list和v5一样以END结束
+	char.options = uint8(options & (MtefOptNudge | MtefOptCharEmbell | MtefOptCharFuncStart))
+	return nil
+}
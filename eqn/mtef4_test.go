@@ -0,0 +1,80 @@
+package eqn
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+//oleObject4.bin是MathType 4保存的MTEFv4
+func TestReadV4Fixture(t *testing.T) {
+	eqn := openFixture(t, "oleObject4.bin")
+	if version := eqn.Header().MtefVersion; version != 4 {
+		t.Errorf("MTEF version = %v, want 4", version)
+	}
+	latex, err := eqn.Translate()
+	if want := `$$ \sqrt[] { a_{ i }   }=0 $$`; err != nil || latex != want {
+		t.Errorf("Translate() = %q, %v, want %q", latex, err, want)
+	}
+}
+
+//v4的CHAR没有字体位置，v5的mtefOPT_CHAR_ENC_*选项不起作用，也不会保留
+func TestReadCharV4(t *testing.T) {
+	data := []byte{4, 1, 0, 4, 0,
+		1, 0,
+		2, byte(MtefOptCharFuncStart | MtefOptCharEncChar8 | MtefOptCharEncChar16), 0x84, 's', 0,
+		2, 0, 0x84, 'i', 0,
+		0,
+		0,
+	}
+	eqn, err := OpenMTEF(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chars := eqn.Objects()[0].Children()
+	if len(chars) != 2 {
+		t.Fatalf("LINE has %d children, want 2", len(chars))
+	}
+	s := chars[0].(*Char)
+	if s.Rune() != 's' || !s.FunctionStart() {
+		t.Errorf("first CHAR = %q, function start %v", s.Rune(), s.FunctionStart())
+	}
+	if _, ok := s.FontPosition(); ok {
+		t.Errorf("v4 CHAR has a font position")
+	}
+}
+
+//oleObject5.bin：FONT record（v5里是FONT_STYLE_DEF）、y带hat和nudge过的prime、x带nudge
+func TestReadV4(t *testing.T) {
+	eqn := openFixture(t, "oleObject5.bin")
+	if version := eqn.Header().MtefVersion; version != 4 {
+		t.Errorf("MTEF version = %v, want 4", version)
+	}
+	for _, node := range eqn.Objects() {
+		if node.Record() == FONT_STYLE_DEF {
+			t.Errorf("FONT record read as FONT_STYLE_DEF")
+		}
+	}
+
+	var chars []*Char
+	Inspect(eqn.Root(), func(node Node) bool {
+		if char, ok := node.(*Char); ok {
+			chars = append(chars, char)
+		}
+		return true
+	})
+	if len(chars) != 3 {
+		t.Fatalf("read %d chars, want 3", len(chars))
+	}
+
+	want := []Embellishment{{Type: embHAT}, {Type: emb1PRIME, NudgeY: -7}}
+	if embells := chars[0].Embellishments(); !reflect.DeepEqual(embells, want) {
+		t.Errorf("embellishments = %+v, want %+v", embells, want)
+	}
+	if x, y := chars[2].Nudge(); x != 5 || y != 0 {
+		t.Errorf("nudge = (%d, %d), want (5, 0)", x, y)
+	}
+	if latex, err := eqn.Translate(); err != nil || latex != `$$ \hat{ y }'=x $$` {
+		t.Errorf("Translate() = %q, %v", latex, err)
+	}
+}
@@ -0,0 +1,79 @@
+package eqn
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+//OLE对象里的MTEF数据去掉28字节的EQNOLEFILEHDR后，OpenMTEF和Open读出来的一样
+func TestOpenMTEF(t *testing.T) {
+	for _, file := range []string{"oleObject1.bin", "oleObject3.bin", "oleObject4.bin"} {
+		buffer, err := ioutil.ReadFile("../test/" + file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ole, err := Open(bytes.NewReader(buffer))
+		if err != nil {
+			t.Fatalf("Open(%v): %v", file, err)
+		}
+		data, err := ExtractOLE(bytes.NewReader(buffer))
+		if err != nil {
+			t.Fatalf("ExtractOLE(%v): %v", file, err)
+		}
+		if hdr, ok := ole.OleHeader(); !ok || hdr.CbHdr != 28 || int(hdr.CbObject) != len(data) {
+			t.Errorf("%v: EQNOLEFILEHDR %+v, MTEF data %d bytes", file, hdr, len(data))
+		}
+
+		raw, err := OpenMTEF(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("OpenMTEF(%v): %v", file, err)
+		}
+		if _, ok := raw.OleHeader(); ok {
+			t.Errorf("%v: OpenMTEF has an EQNOLEFILEHDR", file)
+		}
+		want, _ := ole.Translate()
+		if latex, _ := raw.Translate(); latex != want {
+			t.Errorf("%v: OpenMTEF Translate() = %q, Open Translate() = %q", file, latex, want)
+		}
+	}
+}
+
+//oleObject1.bin是MathType 6的公式；oleObject2.bin里三重积分的variation LaTeX还不支持，返回LatexError
+func TestTranslate(t *testing.T) {
+	latex, err := openFixture(t, "oleObject1.bin").Translate()
+	if want := `$$ \frac { -b±\sqrt[] { b ^ { 2 } -4ac } } { 2a } $$`; err != nil || latex != want {
+		t.Errorf("oleObject1.bin: Translate() = %q, %v, want %q", latex, err, want)
+	}
+
+	var latexErr *LatexError
+	if latex, err = openFixture(t, "oleObject2.bin").Translate(); !errors.As(err, &latexErr) {
+		t.Errorf("oleObject2.bin: Translate() = %q, %v, want LatexError", latex, err)
+	}
+}
+
+func TestOpenMTEFErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		offset int64
+		err    error
+	}{
+		{"empty", nil, 0, nil},
+		{"MTEF v2", []byte{2, 1, 0, 2, 0}, 0, ErrUnsupportedVersion},
+		{"truncated CHAR", mtefData([]byte{1, 0, 2, 0, 0x83}), 14, nil},
+		{"unknown record", mtefData([]byte{1, 0, 42}), 14, ErrUnknownRecord},
+	}
+	for _, test := range tests {
+		_, err := OpenMTEF(bytes.NewReader(test.data))
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%v: error %v, want ParseError", test.name, err)
+			continue
+		}
+		if parseErr.Offset != test.offset || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("%v: error %v at offset %d, want %v at %d", test.name, err, parseErr.Offset, test.err, test.offset)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package eqn
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//nudge的单位是1/32 point，x向右为正，y向下为正
+const nudgeUnitsPerPoint = 32
+
+//小于1/4 point的nudge看不出来，渲染的时候忽略
+const nudgeThreshold = nudgeUnitsPerPoint / 4
+
+//LINE、CHAR、TMPL、PILE、MATRIX、EMBELL的nudge，其他节点返回0
+func (ast *MtAST) nudge() (nudgeX int16, nudgeY int16) {
+	switch value := ast.value.(type) {
+	case *MtEmbellRd:
+		return value.nudgeX, value.nudgeY
+	case *MtLine:
+		return value.nudgeX, value.nudgeY
+	case *MtChar:
+		return value.nudgeX, value.nudgeY
+	case *MtTmpl:
+		return value.nudgeX, value.nudgeY
+	case *MtPile:
+		return value.nudgeX, value.nudgeY
+	case *MtMatrix:
+		return value.nudgeX, value.nudgeY
+	}
+	return 0, 0
+}
+
+func significantNudge(nudge int16) bool {
+	return nudge >= nudgeThreshold || nudge <= -nudgeThreshold
+}
+
+func significantNudges(nudgeX int16, nudgeY int16) bool {
+	return significantNudge(nudgeX) || significantNudge(nudgeY)
+}
+
+//渲染时需要移动的节点的nudge，LaTeX和MathML都用它判断，不需要移动的时候ok为false
+func renderedNudge(ast *MtAST, render bool) (nudgeX int16, nudgeY int16, ok bool) {
+	nudgeX, nudgeY = ast.nudge()
+	return nudgeX, nudgeY, render && significantNudges(nudgeX, nudgeY)
+}
+
+//nudge转换成point，去掉多余的0
+func nudgePoints(nudge int16) string {
+	return strconv.FormatFloat(float64(nudge)/nudgeUnitsPerPoint, 'f', -1, 64)
+}
+
+func nudgeLatex(latex string, nudgeX int16, nudgeY int16) string {
+	if latex == "" {
+		return latex
+	}
+
+	//nudge只移动自己，不影响后面的节点，所以水平方向移动后要移回来
+	if significantNudge(nudgeY) {
+		latex = fmt.Sprintf("\\raisebox{%vpt}{$ %v $}", nudgePoints(-nudgeY), latex)
+	}
+	if significantNudge(nudgeX) {
+		latex = fmt.Sprintf("\\kern %vpt %v \\kern %vpt ", nudgePoints(nudgeX), latex, nudgePoints(-nudgeX))
+	}
+	return latex
+}
+
+//embellishment的nudge只移动符号：符号加在\phantom上，用\rlap叠在字符上，prime这样跟在后面的符号直接移动，
+//format是embellFormats里的格式
+func nudgeEmbellLatex(format string, postfix bool, char string, nudgeX int16, nudgeY int16) string {
+	if postfix {
+		return char + nudgeLatex(fmt.Sprintf(format, "{}"), nudgeX, nudgeY)
+	}
+	mark := nudgeLatex(fmt.Sprintf(format, fmt.Sprintf("\\phantom{ %v }", char)), nudgeX, nudgeY)
+	return fmt.Sprintf("\\rlap{$ %v $} %v", mark, char)
+}
+
+//用mpadded移动元素，lspace向右，voffset向上，宽度不变，不影响后面的元素
+func nudgeMathML(item string, nudgeX int16, nudgeY int16) string {
+	attrs := ""
+	if significantNudge(nudgeX) {
+		attrs += fmt.Sprintf(` lspace="%vpt"`, nudgePoints(nudgeX))
+	}
+	if significantNudge(nudgeY) {
+		attrs += fmt.Sprintf(` voffset="%vpt"`, nudgePoints(-nudgeY))
+	}
+	if attrs == "" {
+		return item
+	}
+	return mathmlElement("mpadded", attrs, item)
+}
@@ -0,0 +1,86 @@
+package eqn
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var readNudgeTests = []struct {
+	data           []byte
+	nudgeX, nudgeY int16
+}{
+	{[]byte{133, 128}, 5, 0},
+	{[]byte{128, 121}, 0, -7},
+	{[]byte{129, 127}, 1, -1},
+	{[]byte{255, 1}, 127, -127},
+	{[]byte{1, 255}, -127, 127},
+	{[]byte{0, 0}, -128, -128},
+
+	//2个128后面跟着2个int16
+	{[]byte{128, 128, 0, 0, 0, 0}, 0, 0},
+	{[]byte{128, 128, 5, 0, 0, 0}, 5, 0},
+	{[]byte{128, 128, 0x80, 0, 0x7f, 0xff}, 128, -129},
+	{[]byte{128, 128, 0x80, 0xff, 0x7f, 0}, -128, 127},
+	{[]byte{128, 128, 0xe8, 0x03, 0x18, 0xfc}, 1000, -1000},
+	{[]byte{128, 128, 0xff, 0x7f, 0x00, 0x80}, 32767, -32768},
+}
+
+func TestReadNudge(t *testing.T) {
+	for _, test := range readNudgeTests {
+		m := &MTEFv5{reader: bytes.NewReader(test.data)}
+		nudgeX, nudgeY, err := m.readNudge()
+		if err != nil {
+			t.Errorf("readNudge(%v): %v", test.data, err)
+			continue
+		}
+		if nudgeX != test.nudgeX || nudgeY != test.nudgeY {
+			t.Errorf("readNudge(%v) = (%v, %v), want (%v, %v)", test.data, nudgeX, nudgeY, test.nudgeX, test.nudgeY)
+		}
+		if offset := m.offset(); offset != int64(len(test.data)) {
+			t.Errorf("readNudge(%v) read %v bytes, want %v", test.data, offset, len(test.data))
+		}
+	}
+}
+
+func TestRenderNudges(t *testing.T) {
+	//x向右2pt、向上1pt，b的hat向上1pt
+	x := NewChar('x', int(fnVARIABLE))
+	x.char().nudgeX, x.char().nudgeY = 64, -32
+	b := embellishedChar(embHAT)
+	b.char().mtcode = 'b'
+	b.char().embellishments.nudgeY = -32
+	m := New(NewLine(x, NewChar('+', int(fnSYMBOL)), b))
+
+	//默认不渲染
+	for _, render := range []func() (string, error){m.Translate, m.TranslateMathML} {
+		output, err := render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(output, "raisebox") || strings.Contains(output, "mpadded") {
+			t.Errorf("nudges rendered by default: %v", output)
+		}
+	}
+
+	m.RenderNudges = true
+	latex, err := m.Translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`\kern 2pt \raisebox{1pt}{$ x $} \kern -2pt`, `\rlap{$ \raisebox{1pt}{$ \hat{ \phantom{ b } } $} $} b`} {
+		if !strings.Contains(latex, want) {
+			t.Errorf("latex %q does not contain %q", latex, want)
+		}
+	}
+
+	mathml, err := m.TranslateMathML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`<mpadded lspace="2pt" voffset="1pt"><mi>x</mi></mpadded>`, `<mover accent="true"><mi>b</mi><mpadded voffset="1pt"><mo>ˆ</mo></mpadded></mover>`} {
+		if !strings.Contains(mathml, want) {
+			t.Errorf("mathml %q does not contain %q", mathml, want)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package eqn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+//[MS-CFB](https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-cfb)
+//MathType的OLE对象（docx里的word/embeddings/oleObject*.bin）是一个compound file，包含：
+//	\x01Ole          OLE嵌入对象的标记
+//	\x01CompObj      class id、user type "MathType 6.0 Equation"、ProgID "Equation.DSMT4"
+//	\x03ObjInfo      Word使用的对象信息
+//	Equation Native  EQNOLEFILEHDR + MTEF数据
+//这里按MathType 6保存的格式写，version 3（512字节的sector），小于4096字节的stream放在mini stream里
+
+const (
+	cfbSectorSize     = 512
+	cfbMiniSectorSize = 64
+	cfbMiniCutoff     = 4096
+	cfbDirEntrySize   = 128
+
+	cfbFreeSect   = uint32(0xFFFFFFFF)
+	cfbEndOfChain = uint32(0xFFFFFFFE)
+	cfbFatSect    = uint32(0xFFFFFFFD)
+	cfbNoStream   = uint32(0xFFFFFFFF)
+
+	//directory树是红黑树
+	cfbRed   = uint8(0)
+	cfbBlack = uint8(1)
+
+	//header里最多直接记录109个FAT sector，再多需要DIFAT
+	cfbHeaderDifat = 109
+
+	//MathType注册的clipboard format "MathType EF"
+	eqnClipboardFormat = uint16(0xC378)
+	eqnOleVersion      = uint32(0x00020000)
+)
+
+var (
+	cfbSignature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+
+	//Equation.DSMT4的CLSID {0002CE03-0000-0000-C000-000000000046}
+	dsmt4ClassID = []byte{0x03, 0xCE, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+
+	ErrOleTooLarge = errors.New("equation too large for OLE object")
+)
+
+type cfbStream struct {
+	name string
+	data []byte
+}
+
+//生成MathType的OLE对象，可以放到docx的word/embeddings里，也可以用Open读取
+func (m *MTEFv5) MarshalOLE() ([]byte, error) {
+	mtef, err := m.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	//从OLE对象读取的公式保留原来的EQNOLEFILEHDR，只更新长度
+	hdr := OleHeader{CbHdr: oleCbHdr, Version: eqnOleVersion, ClipboardFormat: eqnClipboardFormat}
+	if m.oleHeader != nil {
+		hdr = *m.oleHeader
+	}
+	hdr.CbObject = uint32(len(mtef))
+
+	native := new(bytes.Buffer)
+	_ = binary.Write(native, binary.LittleEndian, hdr)
+	native.Write(mtef)
+
+	return writeCompoundFile(dsmt4ClassID, []cfbStream{
+		{"\x01Ole", oleStream()},
+		{"\x01CompObj", compObjStream()},
+		{"\x03ObjInfo", []byte{0x00, 0x00, 0x03, 0x00, 0x01, 0x00}},
+		{"Equation Native", native.Bytes()},
+	})
+}
+
+//把MarshalOLE的结果写到w
+func (m *MTEFv5) WriteOLE(w io.Writer) error {
+	data, err := m.MarshalOLE()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+func oleStream() []byte {
+	//version 0x02000001，flags 8，其他都是0
+	buffer := make([]byte, 20)
+	binary.LittleEndian.PutUint32(buffer, 0x02000001)
+	binary.LittleEndian.PutUint32(buffer[4:], 0x00000008)
+	return buffer
+}
+
+func compObjStream() []byte {
+	buffer := new(bytes.Buffer)
+
+	//header: reserved(4) version(4) reserved(4) + CLSID
+	buffer.Write([]byte{0x01, 0x00, 0xFE, 0xFF, 0x03, 0x0A, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF})
+	buffer.Write(dsmt4ClassID)
+
+	//user type、clipboard format、ProgID，都是带长度（包括\0）的ANSI字符串
+	for _, s := range []string{"MathType 6.0 Equation", "MathType EF", "Equation.DSMT4"} {
+		_ = binary.Write(buffer, binary.LittleEndian, uint32(len(s)+1))
+		buffer.WriteString(s)
+		buffer.WriteByte(0)
+	}
+
+	//unicode marker，后面3个unicode字符串都是空的
+	_ = binary.Write(buffer, binary.LittleEndian, []uint32{0x71B239F4, 0, 0, 0})
+	return buffer.Bytes()
+}
+
+func writeCompoundFile(classID []byte, streams []cfbStream) ([]byte, error) {
+	/**
+	sector的顺序：FAT、directory、mini FAT、mini stream、其他stream
+	*/
+	var miniStream []byte
+	var miniFat []uint32
+	miniStart := make([]uint32, len(streams))
+	for idx, stream := range streams {
+		if len(stream.data) >= cfbMiniCutoff {
+			continue
+		}
+
+		count := (len(stream.data) + cfbMiniSectorSize - 1) / cfbMiniSectorSize
+		miniStart[idx] = cfbEndOfChain
+		if count > 0 {
+			miniStart[idx] = uint32(len(miniFat))
+		}
+		for i := 0; i < count; i++ {
+			next := uint32(len(miniFat) + 1)
+			if i == count-1 {
+				next = cfbEndOfChain
+			}
+			miniFat = append(miniFat, next)
+		}
+		miniStream = append(miniStream, padding(stream.data, cfbMiniSectorSize)...)
+	}
+
+	sectors := func(size int) int {
+		return (size + cfbSectorSize - 1) / cfbSectorSize
+	}
+
+	dirSectors := sectors((len(streams) + 1) * cfbDirEntrySize)
+	miniFatSectors := sectors(len(miniFat) * 4)
+	miniStreamSectors := sectors(len(miniStream))
+	streamSectors := 0
+	for _, stream := range streams {
+		if len(stream.data) >= cfbMiniCutoff {
+			streamSectors += sectors(len(stream.data))
+		}
+	}
+
+	//每个FAT sector记录128个sector，包括FAT sector自己
+	used := dirSectors + miniFatSectors + miniStreamSectors + streamSectors
+	fatSectors := (used + cfbSectorSize/4 - 2) / (cfbSectorSize/4 - 1)
+	if fatSectors > cfbHeaderDifat {
+		return nil, ErrOleTooLarge
+	}
+
+	fat := make([]uint32, 0, fatSectors*cfbSectorSize/4)
+	chain := func(count int) uint32 {
+		if count == 0 {
+			return cfbEndOfChain
+		}
+		start := uint32(len(fat))
+		for i := 0; i < count; i++ {
+			next := uint32(len(fat) + 1)
+			if i == count-1 {
+				next = cfbEndOfChain
+			}
+			fat = append(fat, next)
+		}
+		return start
+	}
+
+	for i := 0; i < fatSectors; i++ {
+		fat = append(fat, cfbFatSect)
+	}
+	dirStart := chain(dirSectors)
+	miniFatStart := chain(miniFatSectors)
+	miniStreamStart := chain(miniStreamSectors)
+	streamStart := make([]uint32, len(streams))
+	for idx, stream := range streams {
+		if len(stream.data) >= cfbMiniCutoff {
+			streamStart[idx] = chain(sectors(len(stream.data)))
+		} else {
+			streamStart[idx] = miniStart[idx]
+		}
+	}
+	for len(fat) < fatSectors*cfbSectorSize/4 {
+		fat = append(fat, cfbFreeSect)
+	}
+
+	out := new(bytes.Buffer)
+	write := func(data ...interface{}) {
+		for _, d := range data {
+			_ = binary.Write(out, binary.LittleEndian, d)
+		}
+	}
+
+	//header
+	difat := make([]uint32, cfbHeaderDifat)
+	for i := range difat {
+		difat[i] = cfbFreeSect
+		if i < fatSectors {
+			difat[i] = uint32(i)
+		}
+	}
+	out.Write(cfbSignature)
+	out.Write(make([]byte, 16))
+	write(uint16(0x003E), uint16(0x0003), uint16(0xFFFE), uint16(9), uint16(6))
+	out.Write(make([]byte, 6))
+	write(uint32(0), uint32(fatSectors), dirStart, uint32(0), uint32(cfbMiniCutoff))
+	write(miniFatStart, uint32(miniFatSectors), cfbEndOfChain, uint32(0), difat)
+
+	//FAT
+	write(fat)
+
+	//directory，第0个是Root Entry，stream按名字排成二叉树挂在Root Entry下面
+	entries := new(bytes.Buffer)
+	left, right, colors, child := cfbTree(streams)
+	writeDirEntry(entries, "Root Entry", 5, cfbBlack, cfbNoStream, cfbNoStream, child, classID, miniStreamStart, uint32(len(miniStream)))
+	for idx, stream := range streams {
+		writeDirEntry(entries, stream.name, 2, colors[idx], left[idx], right[idx], cfbNoStream, nil, streamStart[idx], uint32(len(stream.data)))
+	}
+	for entries.Len() < dirSectors*cfbSectorSize {
+		writeDirEntry(entries, "", 0, cfbRed, cfbNoStream, cfbNoStream, cfbNoStream, nil, 0, 0)
+	}
+	out.Write(entries.Bytes())
+
+	//mini FAT和mini stream
+	if miniFatSectors > 0 {
+		for len(miniFat) < miniFatSectors*cfbSectorSize/4 {
+			miniFat = append(miniFat, cfbFreeSect)
+		}
+		write(miniFat)
+	}
+	out.Write(padding(miniStream, cfbSectorSize))
+
+	for _, stream := range streams {
+		if len(stream.data) >= cfbMiniCutoff {
+			out.Write(padding(stream.data, cfbSectorSize))
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+//directory里的stream按名字组成红黑树，先比较长度，再比较大写后的名字，
+//返回每个stream的左右子节点（directory编号，Root Entry是0）、颜色和树根
+func cfbTree(streams []cfbStream) (left []uint32, right []uint32, colors []uint8, root uint32) {
+	left = make([]uint32, len(streams))
+	right = make([]uint32, len(streams))
+	colors = make([]uint8, len(streams))
+
+	order := make([]int, len(streams))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a := utf16.Encode([]rune(strings.ToUpper(streams[order[i]].name)))
+		b := utf16.Encode([]rune(strings.ToUpper(streams[order[j]].name)))
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+
+	//取中间的作为树根，两边分别递归，得到平衡的树：叶子的深度最多差1，
+	//前面填满的full层都是黑色，最后没有填满的一层是红色，每条路径上黑色节点的个数一样
+	full := 0
+	for 1<<uint(full+1)-1 <= len(order) {
+		full++
+	}
+	var build func(lo int, hi int, depth int) uint32
+	build = func(lo int, hi int, depth int) uint32 {
+		if lo >= hi {
+			return cfbNoStream
+		}
+		mid := (lo + hi) / 2
+		idx := order[mid]
+		left[idx] = build(lo, mid, depth+1)
+		right[idx] = build(mid+1, hi, depth+1)
+		colors[idx] = cfbBlack
+		if depth >= full {
+			colors[idx] = cfbRed
+		}
+		return uint32(idx + 1)
+	}
+	return left, right, colors, build(0, len(order), 0)
+}
+
+func writeDirEntry(out *bytes.Buffer, name string, _type uint8, color uint8, left uint32, right uint32, child uint32, classID []byte, start uint32, size uint32) {
+	nameBuffer := make([]uint16, 32)
+	encoded := utf16.Encode([]rune(name))
+	copy(nameBuffer, encoded)
+	nameLength := uint16(0)
+	if name != "" {
+		nameLength = uint16(len(encoded)+1) * 2
+	}
+
+	clsid := make([]byte, 16)
+	copy(clsid, classID)
+
+	//时间都是0
+	_ = binary.Write(out, binary.LittleEndian, nameBuffer)
+	_ = binary.Write(out, binary.LittleEndian, nameLength)
+	out.WriteByte(_type)
+	out.WriteByte(color)
+	_ = binary.Write(out, binary.LittleEndian, []uint32{left, right, child})
+	out.Write(clsid)
+	_ = binary.Write(out, binary.LittleEndian, []uint32{0, 0, 0, 0, 0})
+	_ = binary.Write(out, binary.LittleEndian, []uint32{start, size, 0})
+}
+
+//补0到size的整数倍
+func padding(data []byte, size int) []byte {
+	if len(data)%size == 0 {
+		return data
+	}
+	return append(append([]byte{}, data...), make([]byte, size-len(data)%size)...)
+}
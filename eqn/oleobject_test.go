@@ -0,0 +1,215 @@
+package eqn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/richardlehane/mscfb"
+)
+
+//用另外一个CFB reader读取MarshalOLE的结果，返回每个stream的数据
+func readCompoundFile(t *testing.T, data []byte) (classID string, streams map[string][]byte) {
+	t.Helper()
+	reader, err := mscfb.New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	streams = make(map[string][]byte)
+	for file, err := reader.Next(); err != io.EOF; file, err = reader.Next() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer, err := ioutil.ReadAll(file)
+		if err != nil {
+			t.Fatalf("%q: %v", file.Name, err)
+		}
+		//mscfb把\x01、\x03这样的开头放在Initial里
+		name := file.Name
+		if file.Initial < 0x20 {
+			name = string(rune(file.Initial)) + name
+		}
+		streams[name] = buffer
+	}
+	return reader.ID(), streams
+}
+
+//directory entry的颜色和左右子节点，按FAT里directory的chain读取
+type dirEntry struct {
+	color       uint8
+	left, right uint32
+	child       uint32
+}
+
+func readDirEntries(t *testing.T, data []byte) []dirEntry {
+	t.Helper()
+	sector := func(sn uint32) []byte {
+		return data[(sn+1)*cfbSectorSize : (sn+2)*cfbSectorSize]
+	}
+
+	var fat []uint32
+	for i := uint32(0); i < binary.LittleEndian.Uint32(data[44:]); i++ {
+		fatSector := sector(binary.LittleEndian.Uint32(data[76+4*i:]))
+		for j := 0; j < cfbSectorSize; j += 4 {
+			fat = append(fat, binary.LittleEndian.Uint32(fatSector[j:]))
+		}
+	}
+
+	var entries []dirEntry
+	for sn := binary.LittleEndian.Uint32(data[48:]); sn != cfbEndOfChain; sn = fat[sn] {
+		buffer := sector(sn)
+		for i := 0; i < cfbSectorSize; i += cfbDirEntrySize {
+			entry := buffer[i : i+cfbDirEntrySize]
+			entries = append(entries, dirEntry{
+				color: entry[67],
+				left:  binary.LittleEndian.Uint32(entry[68:]),
+				right: binary.LittleEndian.Uint32(entry[72:]),
+				child: binary.LittleEndian.Uint32(entry[76:]),
+			})
+		}
+	}
+	return entries
+}
+
+//检查Root Entry下面的树：根是黑色，红色节点的子节点是黑色，每条路径上黑色节点的个数一样
+func checkRedBlack(entries []dirEntry, root uint32) error {
+	if root != cfbNoStream && entries[root].color != cfbBlack {
+		return fmt.Errorf("root entry %d is red", root)
+	}
+
+	var blacks func(idx uint32, parentRed bool) (int, error)
+	blacks = func(idx uint32, parentRed bool) (int, error) {
+		if idx == cfbNoStream {
+			return 1, nil
+		}
+		entry := entries[idx]
+		red := entry.color == cfbRed
+		if red && parentRed {
+			return 0, fmt.Errorf("red entry %d has a red parent", idx)
+		}
+		left, err := blacks(entry.left, red)
+		if err != nil {
+			return 0, err
+		}
+		right, err := blacks(entry.right, red)
+		if err != nil {
+			return 0, err
+		}
+		if left != right {
+			return 0, fmt.Errorf("entry %d: %d black entries on the left, %d on the right", idx, left, right)
+		}
+		if red {
+			return left, nil
+		}
+		return left + 1, nil
+	}
+	_, err := blacks(root, false)
+	return err
+}
+
+func TestMarshalOLE(t *testing.T) {
+	//Equation Native超过4096字节时不放在mini stream里
+	var chars []Node
+	for i := 0; i < 1000; i++ {
+		chars = append(chars, NewChar('x', int(fnVARIABLE)))
+	}
+	equations := map[string]*MTEFv5{"large": New(NewLine(chars...))}
+	for _, file := range []string{"oleObject1.bin", "oleObject2.bin", "oleObject3.bin", "oleObject4.bin", "oleObject5.bin"} {
+		equations[file] = openFixture(t, file)
+	}
+
+	for name, eqn := range equations {
+		mtef, err := eqn.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ole, err := eqn.MarshalOLE()
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+
+		classID, streams := readCompoundFile(t, ole)
+		if classID != "{0002CE03-0000-0000-C000-000000000046}" {
+			t.Errorf("%v: root CLSID %v, want Equation.DSMT4", name, classID)
+		}
+		for _, stream := range []string{"\x01Ole", "\x01CompObj", "\x03ObjInfo", "Equation Native"} {
+			if _, ok := streams[stream]; !ok {
+				t.Errorf("%v: no %q stream", name, stream)
+			}
+		}
+		if compObj := string(streams["\x01CompObj"]); !strings.Contains(compObj, "Equation.DSMT4\x00") {
+			t.Errorf("%v: CompObj %q has no Equation.DSMT4 ProgID", name, compObj)
+		}
+
+		native := streams["Equation Native"]
+		hdr, err := readOleHeader(native)
+		if err != nil || int(hdr.CbObject) != len(mtef) || hdr.Version != eqnOleVersion {
+			t.Errorf("%v: EQNOLEFILEHDR %+v, %v, want CbObject %d", name, hdr, err, len(mtef))
+		}
+		if !bytes.Equal(native[oleCbHdr:], mtef) {
+			t.Errorf("%v: Equation Native does not hold the MTEF data", name)
+		}
+
+		entries := readDirEntries(t, ole)
+		if err := checkRedBlack(entries, entries[0].child); err != nil {
+			t.Errorf("%v: directory is not a red-black tree: %v", name, err)
+		}
+
+		//Open读回来的公式一样
+		written, err := Open(bytes.NewReader(ole))
+		if err != nil {
+			t.Fatalf("%v: %v", name, err)
+		}
+		if again, err := written.MarshalBinary(); err != nil || !bytes.Equal(again, mtef) {
+			t.Errorf("%v: MTEF data changed after Open: %v", name, err)
+		}
+		if got, want := translations(written), translations(eqn); got != want {
+			t.Errorf("%v: equation read back translates to %q, want %q", name, got, want)
+		}
+	}
+}
+
+//不同个数的stream，树都是红黑树，而且是按名字排序的二叉搜索树
+func TestCfbTree(t *testing.T) {
+	for n := 1; n <= 20; n++ {
+		streams := make([]cfbStream, n)
+		for i := range streams {
+			streams[i].name = fmt.Sprintf("stream%02d", n-i)
+		}
+		left, right, colors, root := cfbTree(streams)
+
+		entries := make([]dirEntry, n+1)
+		for i := range streams {
+			entries[i+1] = dirEntry{color: colors[i], left: left[i], right: right[i]}
+		}
+		if err := checkRedBlack(entries, root); err != nil {
+			t.Errorf("%d streams: %v", n, err)
+		}
+
+		var names []string
+		var inorder func(idx uint32)
+		inorder = func(idx uint32) {
+			if idx == cfbNoStream {
+				return
+			}
+			inorder(entries[idx].left)
+			names = append(names, streams[idx-1].name)
+			inorder(entries[idx].right)
+		}
+		inorder(root)
+		for i := 1; i < len(names); i++ {
+			if names[i-1] >= names[i] {
+				t.Errorf("%d streams: tree order %v", n, names)
+				break
+			}
+		}
+		if len(names) != n {
+			t.Errorf("%d streams: %d in the tree", n, len(names))
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package eqn
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+//公式树转换成Office Math Markup（Word的公式）：
+//	CHAR转成m:r，样式（正体、粗体、文本）放在m:rPr里，相邻的数字、函数名、文本合并成一个m:r
+//	上下标template的底数是LINE里前面的一个元素（m:sSub、m:sSup、m:sSubSup）
+//	定界符类template转成m:d，大型运算符转成m:nary，重音转成m:acc、m:bar、m:groupChr，删除线和方框转成m:borderBox
+//	PILE转成m:eqArr，MATRIX转成m:m，OMML没有矩阵的分隔线，忽略
+//	作者手动修改了字号的字符在m:r里加上w:rPr（w:sz）
+//header里不是行内公式的时候外面加上m:oMathPara
+
+const ommlNamespace = "http://schemas.openxmlformats.org/officeDocument/2006/math"
+
+//m:r里面的w:rPr（字号）使用
+const wordNamespace = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+
+//MathType的空格对应的unicode空格
+var ommlSpaces = map[uint16]string{
+	0xef02: " ",
+	0xef03: " ",
+	0xef04: " ",
+	0xef05: " ",
+	0xef06: "  ",
+	0xef08: " ",
+}
+
+//在字符上面的embellishment用m:acc，Word使用组合字符
+var ommlAccents = map[EmbellType]string{
+	emb1DOT:    "̇",
+	emb2DOT:    "̈",
+	emb3DOT:    "⃛",
+	emb4DOT:    "⃜",
+	embTILDE:   "̃",
+	embHAT:     "̂",
+	embRARROW:  "⃗",
+	embLARROW:  "⃖",
+	embBARROW:  "⃡",
+	embR1ARROW: "⃑",
+	embL1ARROW: "⃐",
+	embOBAR:    "̅",
+	embFROWN:   "̑",
+	embSMILE:   "̆",
+}
+
+//删除线对应的m:borderBoxPr
+var ommlStrikes = map[EmbellType][]string{
+	embNOT:      {"strikeBLTR"},
+	embMBAR:     {"strikeH"},
+	embX_BARS:   {"strikeBLTR", "strikeTLBR"},
+	embUP_BAR:   {"strikeBLTR"},
+	embDOWN_BAR: {"strikeTLBR"},
+}
+
+//把公式转换成OMML，公式里有不认识的template时返回ErrNotImplemented
+func (m *MTEFv5) TranslateOMML() (string, error) {
+	content := ""
+	if m.ast != nil {
+		prefs, _ := m.Preferences()
+		row := &ommlRow{prefs: prefs}
+		for _, object := range m.ast.slots() {
+			if err := row.append(object); err != nil {
+				return "", err
+			}
+		}
+		content = row.content()
+	}
+
+	namespace := fmt.Sprintf(` xmlns:m="%v" xmlns:w="%v"`, ommlNamespace, wordNamespace)
+	if m.mInline&mtefOptInline != 0 {
+		return ommlElement("m:oMath"+namespace, content), nil
+	}
+	return ommlElement("m:oMathPara"+namespace, ommlElement("m:oMath", content)), nil
+}
+
+//LINE里面的元素，m:r还没输出的时候可以和后面的字符合并
+type ommlRow struct {
+	items []string
+
+	//还没输出的m:r
+	pending bool
+	kind    charKind
+	text    string
+
+	//EQN_PREFS，计算手动修改的字号
+	prefs EquationPreferences
+	//当前的字号（w:rPr），和LINE开始时一样的时候为空
+	size string
+}
+
+//tag可以带属性，没有子节点的时候是空元素
+func ommlElement(tag string, children ...string) string {
+	name := strings.Fields(tag)[0]
+	content := strings.Join(children, "")
+	if content == "" {
+		return fmt.Sprintf("<%v/>", tag)
+	}
+	return fmt.Sprintf("<%v>%v</%v>", tag, content, name)
+}
+
+//m:val属性
+func ommlVal(tag string, value string) string {
+	buf := new(strings.Builder)
+	_ = xml.EscapeText(buf, []byte(value))
+	return fmt.Sprintf(`<%v m:val="%v"/>`, tag, buf.String())
+}
+
+//m:e、m:num这样的参数，空的时候也要保留
+func ommlArg(tag string, content string) string {
+	if content == "" {
+		return fmt.Sprintf("<%v/>", tag)
+	}
+	return fmt.Sprintf("<%v>%v</%v>", tag, content, tag)
+}
+
+//*Pr属性，没有属性的时候省略
+func ommlProps(tag string, props ...string) string {
+	if len(props) == 0 {
+		return ""
+	}
+	return ommlElement(tag, props...)
+}
+
+func ommlRun(kind charKind, text string) string {
+	return ommlSizedRun(kind, "", text)
+}
+
+//size是w:rPr，手动修改了字号的字符使用
+func ommlSizedRun(kind charKind, size string, text string) string {
+	var props string
+	switch kind {
+	case kindText:
+		props = ommlElement("m:rPr", "<m:nor/>")
+	case kindFunction, kindUpright:
+		props = ommlElement("m:rPr", ommlVal("m:sty", "p"))
+	case kindBold:
+		props = ommlElement("m:rPr", ommlVal("m:sty", "b"))
+	}
+
+	buf := new(strings.Builder)
+	_ = xml.EscapeText(buf, []byte(text))
+	space := ""
+	if strings.TrimSpace(text) != text {
+		space = ` xml:space="preserve"`
+	}
+	return fmt.Sprintf("<m:r>%v%v<m:t%v>%v</m:t></m:r>", props, size, space, buf.String())
+}
+
+func ommlOperator(code uint16) string {
+	return ommlRun(kindOperator, string(rune(code)))
+}
+
+func (row *ommlRow) flush() {
+	if !row.pending {
+		return
+	}
+	row.items = append(row.items, ommlSizedRun(row.kind, row.size, row.text))
+	row.pending = false
+}
+
+func (row *ommlRow) push(item string) {
+	row.flush()
+	row.items = append(row.items, item)
+}
+
+//取出最后一个元素作为上下标的底数
+func (row *ommlRow) pop() string {
+	row.flush()
+	if len(row.items) == 0 {
+		return ""
+	}
+	item := row.items[len(row.items)-1]
+	row.items = row.items[:len(row.items)-1]
+	return item
+}
+
+func (row *ommlRow) content() string {
+	row.flush()
+	return strings.Join(row.items, "")
+}
+
+func (row *ommlRow) append(ast *MtAST) (err error) {
+	switch ast.tag {
+	case LINE:
+		//手动修改了字号的字符加上w:sz，template里面的slot按template的字号
+		size, lineSize := row.size, ast.value.(*MtLine).size
+		for _, run := range lineRuns(ast) {
+			row.flush()
+			row.size = ommlSizeProps(row.prefs, lineSize, run)
+			for _, child := range run.nodes {
+				if err = row.append(child); err != nil {
+					return err
+				}
+			}
+		}
+		row.flush()
+		row.size = size
+	case CHAR:
+		row.char(ast.value.(*MtChar))
+	case TMPL:
+		return row.template(ast)
+	case PILE:
+		var lines []string
+		for _, line := range ast.slots() {
+			content, err := row.slot(line)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, ommlArg("m:e", content))
+		}
+		row.push(ommlElement("m:eqArr", lines...))
+	case MATRIX:
+		return row.matrix(ast)
+	}
+	return nil
+}
+
+//新的row，字号设置和row一样
+func (row *ommlRow) child() *ommlRow {
+	return &ommlRow{prefs: row.prefs}
+}
+
+func (row *ommlRow) slot(ast *MtAST) (string, error) {
+	row = row.child()
+	if ast != nil {
+		if err := row.append(ast); err != nil {
+			return "", err
+		}
+	}
+	return row.content(), nil
+}
+
+func (row *ommlRow) char(char *MtChar) {
+	if space, ok := ommlSpaces[char.mtcode]; ok {
+		row.push(ommlSizedRun(kindText, row.size, space))
+		return
+	}
+	//0xef00是对齐的位置，0xef01是没有宽度的空格
+	if char.mtcode == 0xef00 || char.mtcode == 0xef01 {
+		return
+	}
+
+	kind, code := classifyChar(char)
+	//数字里的小数点
+	if code == '.' && row.pending && row.kind == kindNumber && char.embellishments == nil {
+		kind = kindNumber
+	}
+	text := string(rune(code))
+
+	//相邻的数字、同一个函数名、文本合并
+	if char.embellishments == nil && row.pending && row.kind == kind {
+		switch {
+		case kind == kindNumber, kind == kindText,
+			kind == kindFunction && OptionType(char.options)&MtefOptCharFuncStart == 0:
+			row.text += text
+			return
+		}
+	}
+
+	if char.embellishments == nil && kind != kindOperator {
+		row.flush()
+		row.pending, row.kind, row.text = true, kind, text
+		return
+	}
+
+	item := ommlSizedRun(kind, row.size, text)
+	for _, embell := range orderedEmbells(char) {
+		embellType := EmbellType(embell.embell)
+		mark, ok := embellMarks[embellType]
+		switch {
+		case !ok:
+		case embellType == embU_BAR:
+			item = ommlBar("bot", item)
+		case mark.kind == "over":
+			item = ommlAccent(ommlAccents[embellType], item)
+		case mark.kind == "under":
+			item = ommlGroupChr(mark.value, "bot", item)
+		case mark.kind == "script":
+			item = ommlElement("m:sSup", ommlArg("m:e", item), ommlArg("m:sup", ommlSizedRun(kindOperator, row.size, mark.value)))
+		case mark.kind == "enclose":
+			item = ommlBorderBox(append([]string{"hideTop", "hideBot", "hideLeft", "hideRight"}, ommlStrikes[embellType]...), item)
+		}
+	}
+	row.push(item)
+}
+
+func ommlAccent(chr string, content string) string {
+	return ommlElement("m:acc", ommlProps("m:accPr", ommlVal("m:chr", chr)), ommlArg("m:e", content))
+}
+
+func ommlBar(pos string, content string) string {
+	return ommlElement("m:bar", ommlProps("m:barPr", ommlVal("m:pos", pos)), ommlArg("m:e", content))
+}
+
+//pos是字符的位置，bot在下面，top在上面
+func ommlGroupChr(chr string, pos string, content string) string {
+	vertJc := "top"
+	if pos == "top" {
+		vertJc = "bot"
+	}
+	return ommlElement("m:groupChr",
+		ommlProps("m:groupChrPr", ommlVal("m:chr", chr), ommlVal("m:pos", pos), ommlVal("m:vertJc", vertJc)),
+		ommlArg("m:e", content))
+}
+
+//flags是m:borderBoxPr里的hideTop、strikeH这些开关
+func ommlBorderBox(flags []string, content string) string {
+	var props []string
+	for _, flag := range flags {
+		props = append(props, ommlVal("m:"+flag, "1"))
+	}
+	return ommlElement("m:borderBox", ommlProps("m:borderBoxPr", props...), ommlArg("m:e", content))
+}
+
+//m:d，定界符为0表示没有
+func ommlDelimiter(left uint16, right uint16, separator uint16, contents ...string) string {
+	char := func(code uint16) string {
+		if code == 0 {
+			return ""
+		}
+		return string(rune(code))
+	}
+
+	props := []string{ommlVal("m:begChr", char(left))}
+	if separator != 0 {
+		props = append(props, ommlVal("m:sepChr", char(separator)))
+	}
+	props = append(props, ommlVal("m:endChr", char(right)))
+
+	children := []string{ommlProps("m:dPr", props...)}
+	for _, content := range contents {
+		children = append(children, ommlArg("m:e", content))
+	}
+	return ommlElement("m:d", children...)
+}
+
+//m:limLow、m:limUpp，lim为空的时候直接返回content
+func ommlLimits(content string, lower string, upper string) string {
+	if lower != "" {
+		content = ommlElement("m:limLow", ommlArg("m:e", content), ommlArg("m:lim", lower))
+	}
+	if upper != "" {
+		content = ommlElement("m:limUpp", ommlArg("m:e", content), ommlArg("m:lim", upper))
+	}
+	return content
+}
+
+func (row *ommlRow) template(ast *MtAST) (err error) {
+	tmpl := ast.value.(*MtTmpl)
+	slots := ast.slots()
+
+	//按顺序转换slot，出错的时候后面的都是空的
+	slot := func(idx int) string {
+		if err != nil {
+			return ""
+		}
+		var s string
+		s, err = row.slot(slotAt(slots, idx))
+		return s
+	}
+
+	var item string
+	selector := SelectorType(tmpl.selector)
+	switch selector {
+	case tmANGLE, tmPAREN, tmBRACE, tmBRACK, tmBAR, tmDBAR, tmFLOOR, tmCEILING, tmOBRACK, tmINTERVAL:
+		left, right := templateFences(tmpl)
+		item = ommlDelimiter(left, right, 0, slot(0))
+	case tmROOT:
+		if emptySlot(slotAt(slots, 1)) {
+			item = ommlElement("m:rad", ommlProps("m:radPr", ommlVal("m:degHide", "1")), "<m:deg/>", ommlArg("m:e", slot(0)))
+		} else {
+			radicand, index := slot(0), slot(1)
+			item = ommlElement("m:rad", ommlArg("m:deg", index), ommlArg("m:e", radicand))
+		}
+	case tmFRACT:
+		var props []string
+		switch {
+		case tmpl.variation&tvFR_SLASH != 0:
+			props = append(props, ommlVal("m:type", "skw"))
+		case tmpl.variation&tvFR_SMALL != 0:
+			props = append(props, ommlVal("m:type", "lin"))
+		}
+		item = ommlElement("m:f", ommlProps("m:fPr", props...), ommlArg("m:num", slot(0)), ommlArg("m:den", slot(1)))
+	case tmUBAR, tmOBAR:
+		pos := "bot"
+		if selector == tmOBAR {
+			pos = "top"
+		}
+		item = ommlBar(pos, slot(0))
+		if tmpl.variation&tvBAR_DOUBLE != 0 {
+			item = ommlBar(pos, item)
+		}
+	case tmARROW:
+		//箭头上面的文字是m:e，下面的文字用m:limLow
+		top, bottom := slot(0), slot(1)
+		arrow := string(rune(arrowChar(tmpl.variation)))
+		if top != "" || bottom == "" {
+			item = ommlGroupChr(arrow, "bot", top)
+			item = ommlLimits(item, bottom, "")
+		} else {
+			item = ommlGroupChr(arrow, "top", bottom)
+		}
+	case tmINTEG, tmSUM, tmPROD, tmCOPROD, tmUNION, tmINTER, tmINTOP, tmSUMOP:
+		props := []string{ommlVal("m:chr", string(rune(bigOpChar(tmpl, slots))))}
+		if tmpl.variation&tvBO_SUM != 0 {
+			props = append(props, ommlVal("m:limLoc", "undOvr"))
+		} else {
+			props = append(props, ommlVal("m:limLoc", "subSup"))
+		}
+		main, lower, upper := slot(0), slot(1), slot(2)
+		if lower == "" {
+			props = append(props, ommlVal("m:subHide", "1"))
+		}
+		if upper == "" {
+			props = append(props, ommlVal("m:supHide", "1"))
+		}
+		item = ommlElement("m:nary", ommlProps("m:naryPr", props...), ommlArg("m:sub", lower), ommlArg("m:sup", upper), ommlArg("m:e", main))
+	case tmLIM:
+		main, lower, upper := slot(0), slot(1), slot(2)
+		item = ommlLimits(main, lower, upper)
+	case tmHBRACE, tmHBRACK:
+		marks := map[SelectorType][2]uint16{tmHBRACE: {0x23de, 0x23df}, tmHBRACK: {0x23b4, 0x23b5}}[selector]
+		main, label := slot(0), slot(1)
+		if tmpl.variation&tvHB_TOP != 0 {
+			item = ommlLimits(ommlGroupChr(string(rune(marks[0])), "top", main), "", label)
+		} else {
+			item = ommlLimits(ommlGroupChr(string(rune(marks[1])), "bot", main), label, "")
+		}
+	case tmLDIV:
+		//OMML没有长除法，用)和上划线表示，商放在上面
+		item = ommlOperator(')') + ommlBar("top", slot(0))
+		if tmpl.variation&tvLD_UPPER != 0 {
+			item = ommlLimits(item, "", slot(1))
+		}
+	case tmSUB, tmSUP, tmSUBSUP:
+		var sub, sup string
+		if selector != tmSUP {
+			sub = slot(0)
+		}
+		if selector != tmSUB {
+			sup = slot(1)
+		}
+		if err != nil {
+			return err
+		}
+
+		//在前面的上下标（tvSU_PRECEDES）没有底数
+		if tmpl.variation&tvSU_PRECEDES != 0 {
+			row.push(ommlElement("m:sPre", ommlArg("m:sub", sub), ommlArg("m:sup", sup), "<m:e/>"))
+			return nil
+		}
+
+		base := ommlArg("m:e", row.pop())
+		switch selector {
+		case tmSUB:
+			item = ommlElement("m:sSub", base, ommlArg("m:sub", sub))
+		case tmSUP:
+			item = ommlElement("m:sSup", base, ommlArg("m:sup", sup))
+		default:
+			item = ommlElement("m:sSubSup", base, ommlArg("m:sub", sub), ommlArg("m:sup", sup))
+		}
+	case tmDIRAC:
+		left, right := tmpl.variation&tvDI_LEFT != 0, tmpl.variation&tvDI_RIGHT != 0
+		switch {
+		case left && right:
+			item = ommlDelimiter(0x27e8, 0x27e9, '|', slot(0), slot(1))
+		case right:
+			item = ommlDelimiter('|', 0x27e9, 0, slot(0))
+		default:
+			item = ommlDelimiter(0x27e8, '|', 0, slot(0))
+		}
+	case tmVEC:
+		arrow := string(rune(vectorChar(tmpl.variation)))
+		if tmpl.variation&tvVE_UNDER != 0 {
+			item = ommlGroupChr(arrow, "bot", slot(0))
+		} else {
+			item = ommlGroupChr(arrow, "top", slot(0))
+		}
+	case tmTILDE:
+		item = ommlAccent("̃", slot(0))
+	case tmHAT:
+		item = ommlAccent("̂", slot(0))
+	case tmARC:
+		item = ommlGroupChr("⏜", "top", slot(0))
+	case tmJSTATUS:
+		item = ommlBorderBox([]string{"hideLeft", "hideBot"}, slot(0))
+	case tmSTRIKE:
+		flags := []string{"hideTop", "hideBot", "hideLeft", "hideRight"}
+		for _, strike := range []struct {
+			bit  uint16
+			flag string
+		}{{tvST_HORIZ, "strikeH"}, {tvST_UP, "strikeBLTR"}, {tvST_DOWN, "strikeTLBR"}} {
+			if tmpl.variation&strike.bit != 0 {
+				flags = append(flags, strike.flag)
+			}
+		}
+		item = ommlBorderBox(flags, slot(0))
+	case tmBOX:
+		//OMML的方框没有圆角
+		var flags []string
+		sides := tmpl.variation & (tvBX_LEFT | tvBX_RIGHT | tvBX_TOP | tvBX_BOTTOM)
+		for _, side := range []struct {
+			bit  uint16
+			flag string
+		}{{tvBX_TOP, "hideTop"}, {tvBX_BOTTOM, "hideBot"}, {tvBX_LEFT, "hideLeft"}, {tvBX_RIGHT, "hideRight"}} {
+			if sides != 0 && tmpl.variation&side.bit == 0 {
+				flags = append(flags, side.flag)
+			}
+		}
+		item = ommlBorderBox(flags, slot(0))
+	default:
+		return fmt.Errorf("mtef: omml %v: %w", selector, ErrNotImplemented)
+	}
+	if err != nil {
+		return err
+	}
+
+	row.push(item)
+	return nil
+}
+
+//MATRIX转成m:m，每列的对齐方式都一样
+func (row *ommlRow) matrix(ast *MtAST) error {
+	matrix := ast.value.(*MtMatrix)
+	slots := ast.slots()
+	rows, cols := int(matrix.rows), int(matrix.cols)
+
+	var mrs []string
+	for r := 0; r < rows; r++ {
+		var cells []string
+		for c := 0; c < cols; c++ {
+			cell, err := row.slot(slotAt(slots, r*cols+c))
+			if err != nil {
+				return err
+			}
+			cells = append(cells, ommlArg("m:e", cell))
+		}
+		mrs = append(mrs, ommlElement("m:mr", cells...))
+	}
+
+	jc := "center"
+	switch matrix.h_just {
+	case 1:
+		jc = "left"
+	case 3:
+		jc = "right"
+	}
+	props := ommlElement("m:mPr", ommlElement("m:mcs", ommlElement("m:mc",
+		ommlElement("m:mcPr", ommlVal("m:count", fmt.Sprint(cols)), ommlVal("m:mcJc", jc)))))
+
+	row.push(ommlElement("m:m", append([]string{props}, mrs...)...))
+	return nil
+}
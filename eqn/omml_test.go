@@ -0,0 +1,28 @@
+package eqn
+
+import "testing"
+
+const (
+	ommlMath = `<m:oMath xmlns:m="http://schemas.openxmlformats.org/officeDocument/2006/math" xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`
+	ommlPara = `<m:oMathPara xmlns:m="http://schemas.openxmlformats.org/officeDocument/2006/math" xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><m:oMath>`
+)
+
+//test目录里的公式的OMML输出，行内公式没有<m:oMathPara>
+func TestOMMLFixtures(t *testing.T) {
+	tests := []struct {
+		file string
+		omml string
+	}{
+		{"oleObject1.bin", ommlPara + `<m:f><m:num><m:r><m:t>−</m:t></m:r><m:r><m:t>b</m:t></m:r><m:r><m:t>±</m:t></m:r><m:rad><m:radPr><m:degHide m:val="1"/></m:radPr><m:deg/><m:e><m:sSup><m:e><m:r><m:t>b</m:t></m:r></m:e><m:sup><m:r><m:t>2</m:t></m:r></m:sup></m:sSup><m:r><m:t>−</m:t></m:r><m:r><m:t>4</m:t></m:r><m:r><m:t>a</m:t></m:r><m:r><m:t>c</m:t></m:r></m:e></m:rad></m:num><m:den><m:r><m:t>2</m:t></m:r><m:r><m:t>a</m:t></m:r></m:den></m:f></m:oMath></m:oMathPara>`},
+		{"oleObject2.bin", ommlMath + `<m:nary><m:naryPr><m:chr m:val="∰"/><m:limLoc m:val="subSup"/><m:supHide m:val="1"/></m:naryPr><m:sub><m:r><m:t>222</m:t></m:r></m:sub><m:sup/><m:e><m:r><m:t>11</m:t></m:r></m:e></m:nary></m:oMath>`},
+		{"oleObject3.bin", ommlPara + "<m:f><m:num><m:sSup><m:e><m:r><m:t>x</m:t></m:r></m:e><m:sup><m:r><m:t>2</m:t></m:r></m:sup></m:sSup><m:r><m:t>+</m:t></m:r><m:r><m:t>1</m:t></m:r></m:num><m:den><m:acc><m:accPr><m:chr m:val=\"̂\"/></m:accPr><m:e><m:r><m:t>y</m:t></m:r></m:e></m:acc></m:den></m:f></m:oMath></m:oMathPara>"},
+		{"oleObject4.bin", ommlPara + `<m:rad><m:radPr><m:degHide m:val="1"/></m:radPr><m:deg/><m:e><m:sSub><m:e><m:r><m:t>a</m:t></m:r></m:e><m:sub><m:r><m:t>i</m:t></m:r></m:sub></m:sSub></m:e></m:rad><m:r><m:t>=</m:t></m:r><m:r><m:t>0</m:t></m:r></m:oMath></m:oMathPara>`},
+		{"oleObject5.bin", ommlPara + "<m:sSup><m:e><m:acc><m:accPr><m:chr m:val=\"̂\"/></m:accPr><m:e><m:r><m:t>y</m:t></m:r></m:e></m:acc></m:e><m:sup><m:r><m:t>′</m:t></m:r></m:sup></m:sSup><m:r><m:t>=</m:t></m:r><m:r><m:t>x</m:t></m:r></m:oMath></m:oMathPara>"},
+	}
+	for _, test := range tests {
+		eqn := openFixture(t, test.file)
+		if omml, err := eqn.TranslateOMML(); err != nil || omml != test.omml {
+			t.Errorf("%v: TranslateOMML() = %q, %v, want %q", test.file, omml, err, test.omml)
+		}
+	}
+}
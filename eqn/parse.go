@@ -0,0 +1,255 @@
+package eqn
+
+import (
+	"fmt"
+	"io"
+)
+
+//[MTEF object list](https://docs.wiris.com/en/mathtype/mathtype_desktop/mathtype-sdk/mtef5#object_lists)
+//LINE、TMPL、PILE、MATRIX后面跟着以END结束的object list，CHAR的embellishment list也以END结束，
+//按照这个结构递归读取，一次生成整个树，每种容器检查自己的子节点：
+//	ROOT:   定义record + 公式（LINE或PILE），END或者数据结束为止，END后面不能再有record
+//	LINE:   CHAR、TMPL、PILE、MATRIX，以及字号、颜色、定义record，不能直接包含LINE
+//	TMPL:   slot（LINE、PILE，括号类template的CHAR），个数由selector决定
+//	PILE:   至少一个LINE
+//	MATRIX: rows*cols个LINE
+func (m *MTEFv5) parse() (err error) {
+	//默认设置为合法的，除非遇到不可解析数据
+	m.Valid = true
+
+	m.ast = &MtAST{tag: ROOT}
+	end, err := m.parseObjectList(m.ast, FULL)
+	if err != nil || end < 0 {
+		return err
+	}
+
+	//最外层的END后面是数据的结束
+	node, offset, err := m.nextRecord()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return newParseError(offset, node.tag, fmt.Errorf("%w after the END of the equation", ErrUnexpectedRecord))
+}
+
+//template的slot个数的范围，包括LINE、PILE和定界符、运算符的CHAR，定界符和运算符的CHAR可以省略
+var templateSlots = map[SelectorType][2]int{
+	tmANGLE: {1, 3}, tmPAREN: {1, 3}, tmBRACE: {1, 3}, tmBRACK: {1, 3}, tmBAR: {1, 3},
+	tmDBAR: {1, 3}, tmFLOOR: {1, 3}, tmCEILING: {1, 3}, tmOBRACK: {1, 3}, tmINTERVAL: {1, 3},
+	tmROOT: {2, 2}, tmFRACT: {2, 2}, tmUBAR: {1, 1}, tmOBAR: {1, 1}, tmARROW: {2, 2},
+	//main、下限、上限和运算符，多重积分有3个积分号，环路积分还有MTExtra的环
+	tmINTEG: {3, 7}, tmSUM: {3, 7}, tmPROD: {3, 7}, tmCOPROD: {3, 7},
+	tmUNION: {3, 7}, tmINTER: {3, 7}, tmINTOP: {3, 7}, tmSUMOP: {3, 7},
+	tmLIM: {3, 3}, tmHBRACE: {2, 3}, tmHBRACK: {2, 3}, tmLDIV: {1, 3},
+	tmSUB: {2, 2}, tmSUP: {2, 2}, tmSUBSUP: {2, 2}, tmDIRAC: {1, 2},
+	tmVEC: {1, 2}, tmTILDE: {1, 2}, tmHAT: {1, 2}, tmARC: {1, 2}, tmJSTATUS: {1, 2},
+	tmSTRIKE: {1, 1}, tmBOX: {1, 1},
+}
+
+//字号、颜色和定义record，可以出现在任何object list里
+func attributeRecord(tag RecordType) bool {
+	switch tag {
+	case SIZE, FULL, SUB, SUB2, SYM, SUBSYM, COLOR, COLOR_DEF, FONT_STYLE_DEF, FONT_DEF, ENCODING_DEF, EQN_PREFS:
+		return true
+	}
+	return false
+}
+
+//parent的object list里面可以出现的record
+func allowedChild(parent RecordType, child RecordType) bool {
+	switch parent {
+	case LINE:
+		return lineChild(child)
+	case TMPL:
+		return templateChild(child)
+	case PILE, MATRIX:
+		return pileChild(child)
+	}
+	//EMBELL只能出现在embellishment list里
+	return child != EMBELL
+}
+
+func lineChild(tag RecordType) bool {
+	switch tag {
+	case CHAR, TMPL, PILE, MATRIX:
+		return true
+	}
+	return attributeRecord(tag)
+}
+
+func templateChild(tag RecordType) bool {
+	switch tag {
+	case LINE, CHAR, PILE:
+		return true
+	}
+	return attributeRecord(tag)
+}
+
+func pileChild(tag RecordType) bool {
+	return tag == LINE || attributeRecord(tag)
+}
+
+//读取parent的object list，size是object list开始时的字号，
+//返回END的位置，最外层数据直接结束的时候返回-1
+func (m *MTEFv5) parseObjectList(parent *MtAST, size RecordType) (end int64, err error) {
+	for {
+		node, offset, err := m.nextRecord()
+		if err == io.EOF {
+			//只有最外层可以直接结束
+			if parent.tag == ROOT {
+				return -1, nil
+			}
+			return offset, newParseError(offset, parent.tag, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return offset, err
+		}
+
+		if node.tag == END {
+			return offset, nil
+		}
+		if !allowedChild(parent.tag, node.tag) {
+			return offset, newParseError(offset, node.tag, fmt.Errorf("%w in %v", ErrUnexpectedRecord, parent.tag))
+		}
+
+		parent.children = append(parent.children, node)
+		switch node.tag {
+		case LINE:
+			err = m.parseLine(node, size)
+		case TMPL:
+			err = m.parseTemplate(node, offset, size)
+		case PILE:
+			err = m.parsePile(node, offset, size)
+		case MATRIX:
+			err = m.parseMatrix(node, offset, size)
+		case CHAR:
+			//后面跟着以END结束的embellishment list
+			char := node.value.(*MtChar)
+			if MtefOptCharEmbell == MtefOptCharEmbell&OptionType(char.options) {
+				err = m.parseEmbellList(char)
+			}
+		case COLOR_DEF, FONT_STYLE_DEF, FONT_DEF, ENCODING_DEF, EQN_PREFS:
+			//定义record按出现的顺序编号，COLOR和CHAR的typeface通过编号引用
+			m.addDef(node)
+		default:
+			//字号和颜色作用于同一个object list里后面的节点，保留在原来的位置，渲染的时候按顺序处理
+			if _size, ok := node.typesize(); ok {
+				size = _size
+			}
+		}
+		if err != nil {
+			return offset, err
+		}
+	}
+}
+
+//LINE记住开始时的字号，渲染的时候只输出和它不一样的字号，null line没有object list
+func (m *MTEFv5) parseLine(node *MtAST, size RecordType) (err error) {
+	line := node.value.(*MtLine)
+	line.size = size
+	if line.null {
+		return nil
+	}
+	_, err = m.parseObjectList(node, size)
+	return err
+}
+
+func (m *MTEFv5) parseTemplate(node *MtAST, offset int64, size RecordType) (err error) {
+	if _, err = m.parseObjectList(node, size); err != nil {
+		return err
+	}
+	if err = templateSlotsError(node); err != nil {
+		return newParseError(offset, TMPL, err)
+	}
+	return nil
+}
+
+func (m *MTEFv5) parsePile(node *MtAST, offset int64, size RecordType) (err error) {
+	if _, err = m.parseObjectList(node, size); err != nil {
+		return err
+	}
+	if err = pileLinesError(node); err != nil {
+		return newParseError(offset, PILE, err)
+	}
+	return nil
+}
+
+func (m *MTEFv5) parseMatrix(node *MtAST, offset int64, size RecordType) (err error) {
+	if _, err = m.parseObjectList(node, size); err != nil {
+		return err
+	}
+	if err = matrixCellsError(node); err != nil {
+		return newParseError(offset, MATRIX, err)
+	}
+	return nil
+}
+
+//检查TMPL、PILE、MATRIX的子节点个数，JSON也使用
+func objectCountError(node *MtAST) error {
+	switch node.tag {
+	case TMPL:
+		return templateSlotsError(node)
+	case PILE:
+		return pileLinesError(node)
+	case MATRIX:
+		return matrixCellsError(node)
+	}
+	return nil
+}
+
+//没有在templateSlots里的selector不检查
+func templateSlotsError(node *MtAST) error {
+	selector := SelectorType(node.value.(*MtTmpl).selector)
+	count, ok := templateSlots[selector]
+	if slots := len(node.slots()); ok && (slots < count[0] || slots > count[1]) {
+		return fmt.Errorf("%w: %v template has %d slots", ErrObjectCount, selector, slots)
+	}
+	return nil
+}
+
+func pileLinesError(node *MtAST) error {
+	if len(node.slots()) == 0 {
+		return fmt.Errorf("%w: PILE has no LINE", ErrObjectCount)
+	}
+	return nil
+}
+
+func matrixCellsError(node *MtAST) error {
+	matrix := node.value.(*MtMatrix)
+	if cells := len(node.slots()); cells != int(matrix.rows)*int(matrix.cols) {
+		return fmt.Errorf("%w: %dx%d MATRIX has %d cells", ErrObjectCount, matrix.rows, matrix.cols, cells)
+	}
+	return nil
+}
+
+//读取CHAR后面的embellishment list，按顺序挂到CHAR上，由渲染决定放在字符的什么位置
+func (m *MTEFv5) parseEmbellList(char *MtChar) (err error) {
+	var last *MtEmbell
+	for {
+		node, offset, err := m.nextRecord()
+		if err == io.EOF {
+			return newParseError(offset, CHAR, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch node.tag {
+		case END:
+			return nil
+		case EMBELL:
+			rd := node.value.(*MtEmbellRd)
+			embell := &MtEmbell{nudgeX: rd.nudgeX, nudgeY: rd.nudgeY, embell: rd.embellType}
+			if last == nil {
+				char.embellishments = embell
+			} else {
+				last.next = embell
+			}
+			last = embell
+		default:
+			return newParseError(offset, node.tag, fmt.Errorf("%w in embellishment list", ErrUnexpectedRecord))
+		}
+	}
+}
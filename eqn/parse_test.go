@@ -0,0 +1,134 @@
+package eqn
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+//MTEFv5 header：DSMT6，不是行内公式
+var testHeader = []byte{5, 1, 0, 6, 9, 'D', 'S', 'M', 'T', '6', 0, 0}
+
+//x的CHAR record
+var testChar = []byte{2, 0, 128 + 3, 'x', 0}
+
+func mtefData(records ...[]byte) []byte {
+	return append(append([]byte{}, testHeader...), bytes.Join(records, nil)...)
+}
+
+var parseTests = []struct {
+	name   string
+	data   []byte
+	offset int64
+	record RecordType
+	err    error
+}{
+	{
+		"valid line",
+		mtefData([]byte{1, 0}, testChar, []byte{0, 0}),
+		0, 0, nil,
+	},
+	{
+		"valid fraction",
+		mtefData([]byte{1, 0, 3, 0, 11, 0, 0}, []byte{1, 0}, testChar, []byte{0}, []byte{1, 0}, testChar, []byte{0, 0, 0, 0}),
+		0, 0, nil,
+	},
+	{
+		"valid 1x2 matrix",
+		mtefData([]byte{1, 0, 5, 0, 1, 1, 1, 1, 2, 0, 0}, []byte{1, 1, 1, 1}, []byte{0, 0, 0}),
+		0, 0, nil,
+	},
+	{
+		"LINE in LINE",
+		mtefData([]byte{1, 0}, []byte{1, 0}, testChar, []byte{0, 0, 0}),
+		14, LINE, ErrUnexpectedRecord,
+	},
+	{
+		"CHAR in PILE",
+		mtefData([]byte{1, 0, 4, 0, 1, 1}, testChar, []byte{0, 0, 0}),
+		18, CHAR, ErrUnexpectedRecord,
+	},
+	{
+		"fraction with one slot",
+		mtefData([]byte{1, 0, 3, 0, 11, 0, 0}, []byte{1, 0}, testChar, []byte{0, 0, 0, 0}),
+		14, TMPL, ErrObjectCount,
+	},
+	{
+		"fraction with three slots",
+		mtefData([]byte{1, 0, 3, 0, 11, 0, 0}, []byte{1, 1, 1, 1, 1, 1}, []byte{0, 0, 0}),
+		14, TMPL, ErrObjectCount,
+	},
+	{
+		"2x2 matrix with three cells",
+		mtefData([]byte{1, 0, 5, 0, 1, 1, 1, 2, 2, 0, 0}, []byte{1, 1, 1, 1, 1, 1}, []byte{0, 0, 0}),
+		14, MATRIX, ErrObjectCount,
+	},
+	{
+		"empty PILE",
+		mtefData([]byte{4, 0, 1, 1, 0, 0}),
+		12, PILE, ErrObjectCount,
+	},
+	{
+		"stray END after the equation",
+		mtefData([]byte{1, 0}, testChar, []byte{0, 0, 0}),
+		21, END, ErrUnexpectedRecord,
+	},
+	{
+		"EMBELL outside an embellishment list",
+		mtefData([]byte{1, 0, 6, 0, 2}, []byte{0, 0}),
+		14, EMBELL, ErrUnexpectedRecord,
+	},
+}
+
+func TestParseNesting(t *testing.T) {
+	for _, test := range parseTests {
+		_, err := OpenMTEF(bytes.NewReader(test.data))
+		if test.err == nil {
+			if err != nil {
+				t.Errorf("%v: %v", test.name, err)
+			}
+			continue
+		}
+
+		var parseError *ParseError
+		if !errors.As(err, &parseError) {
+			t.Errorf("%v: got %v, want *ParseError", test.name, err)
+			continue
+		}
+		if !errors.Is(err, test.err) || parseError.Offset != test.offset || parseError.Record != test.record {
+			t.Errorf("%v: got %v at offset %d (%v), want %v at offset %d (%v)",
+				test.name, parseError.Err, parseError.Offset, parseError.Record, test.err, test.offset, test.record)
+		}
+	}
+}
+
+//解析时允许的最少slot，转换的时候不能越界，LaTeX需要的slot不够时返回LatexError
+func TestShortTemplates(t *testing.T) {
+	for selector, count := range templateSlots {
+		tmpl := &MtAST{TMPL, &MtTmpl{selector: uint8(selector)}, nil}
+		for i := 0; i < count[0]; i++ {
+			tmpl.children = append(tmpl.children, NewLine(NewChar('x', int(fnVARIABLE))).mtAST())
+		}
+		data, err := New(NewLine(&Template{tmpl})).MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := OpenMTEF(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%v with %d slots: %v", selector, count[0], err)
+			continue
+		}
+
+		_, err = m.Translate()
+		var latexErr *LatexError
+		if need := latexSlots[selector]; count[0] < need && (!errors.As(err, &latexErr) || !errors.Is(err, ErrObjectCount)) {
+			t.Errorf("%v with %d slots: Translate error %v, want LatexError", selector, count[0], err)
+		}
+		if _, err = m.TranslateMathML(); err != nil {
+			t.Errorf("%v with %d slots: TranslateMathML: %v", selector, count[0], err)
+		}
+		if _, err = m.TranslateOMML(); err != nil {
+			t.Errorf("%v with %d slots: TranslateOMML: %v", selector, count[0], err)
+		}
+	}
+}
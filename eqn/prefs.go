@@ -0,0 +1,190 @@
+package eqn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//EQN_PREFS里尺寸的单位
+type DimensionUnit uint8
+
+const (
+	UnitInch    DimensionUnit = 0
+	UnitCm      DimensionUnit = 1
+	UnitPoint   DimensionUnit = 2
+	UnitPica    DimensionUnit = 3
+	UnitPercent DimensionUnit = 4
+)
+
+//带单位的尺寸，百分比是相对于full size（正文字号）的
+type Dimension struct {
+	Value float64
+	Unit  DimensionUnit
+}
+
+//转换成point，百分比按照base（point）计算
+func (d Dimension) Points(base float64) float64 {
+	switch d.Unit {
+	case UnitInch:
+		return d.Value * 72
+	case UnitCm:
+		return d.Value * 72 / 2.54
+	case UnitPica:
+		return d.Value * 12
+	case UnitPercent:
+		return d.Value * base / 100
+	}
+	return d.Value
+}
+
+//转换成em，fontSize是字号（point）
+func (d Dimension) Ems(fontSize float64) float64 {
+	if fontSize == 0 {
+		return 0
+	}
+	return d.Points(fontSize) / fontSize
+}
+
+func (d Dimension) String() string {
+	value := strconv.FormatFloat(d.Value, 'f', -1, 64)
+	switch d.Unit {
+	case UnitInch:
+		return value + "in"
+	case UnitCm:
+		return value + "cm"
+	case UnitPoint:
+		return value + "pt"
+	case UnitPica:
+		return value + "pc"
+	case UnitPercent:
+		return value + "%"
+	}
+	return fmt.Sprintf("%v(unit %d)", value, d.Unit)
+}
+
+//JSON里面保存成"12pt"、"150%"这样的字符串
+func (d Dimension) MarshalText() ([]byte, error) {
+	if d.Unit > UnitPercent {
+		return nil, fmt.Errorf("invalid dimension unit %d", d.Unit)
+	}
+	return []byte(d.String()), nil
+}
+
+func (d *Dimension) UnmarshalText(text []byte) (err error) {
+	units := []struct {
+		suffix string
+		unit   DimensionUnit
+	}{{"in", UnitInch}, {"cm", UnitCm}, {"pt", UnitPoint}, {"pc", UnitPica}, {"%", UnitPercent}}
+
+	for _, u := range units {
+		if value := strings.TrimSuffix(string(text), u.suffix); value != string(text) {
+			d.Unit = u.unit
+			d.Value, err = strconv.ParseFloat(value, 64)
+			return err
+		}
+	}
+	return fmt.Errorf("invalid dimension %q", text)
+}
+
+//typeface（fnTEXT到fnTEXT_FE）的字体和样式
+type TypefaceStyle struct {
+	Typeface uint8
+	//没有指定字体的时候Font.Index为0
+	Font   FontDef
+	Bold   bool
+	Italic bool
+}
+
+//EQN_PREFS，公式的字号、间距和各个typeface的样式
+type EquationPreferences struct {
+	//字号，顺序和MathType的Define Sizes一样
+	FullSize         Dimension
+	SubscriptSize    Dimension
+	SubSubscriptSize Dimension
+	SymbolSize       Dimension
+	SubSymbolSize    Dimension
+	User1Size        Dimension
+	User2Size        Dimension
+
+	//间距，顺序和MathType的Define Spacing一样，这里只列出前面常用的几个
+	LineSpacing         Dimension
+	MatrixRowSpacing    Dimension
+	MatrixColumnSpacing Dimension
+	SuperscriptHeight   Dimension
+	SubscriptDepth      Dimension
+	SubSupGap           Dimension
+
+	//原始数据，包括上面没有列出的值
+	Sizes   []Dimension
+	Spacing []Dimension
+
+	//下标i对应typeface i+1
+	Styles []TypefaceStyle
+}
+
+//full size的point值，没有EQN_PREFS或者full size是百分比的时候默认12pt
+func (p EquationPreferences) FullSizePoints() float64 {
+	if p.FullSize.Unit == UnitPercent || p.FullSize.Value == 0 {
+		return 12
+	}
+	return p.FullSize.Points(0)
+}
+
+//typeface对应的样式，typeface是CHAR里减去128后的值
+func (p EquationPreferences) Style(typeface uint8) (TypefaceStyle, bool) {
+	idx := int(typeface) - 1
+	if idx < 0 || idx >= len(p.Styles) {
+		return TypefaceStyle{}, false
+	}
+	return p.Styles[idx], true
+}
+
+//公式的EQN_PREFS，MTEFv3/v4和没有EQN_PREFS的公式ok为false
+func (m *MTEFv5) Preferences() (prefs EquationPreferences, ok bool) {
+	if m.eqnPrefs == nil {
+		return prefs, false
+	}
+
+	dimension := func(list []Dimension, idx int) Dimension {
+		if idx < len(list) {
+			return list[idx]
+		}
+		return Dimension{}
+	}
+
+	sizes, spaces := m.eqnPrefs.sizes, m.eqnPrefs.spaces
+	prefs = EquationPreferences{
+		FullSize:         dimension(sizes, 0),
+		SubscriptSize:    dimension(sizes, 1),
+		SubSubscriptSize: dimension(sizes, 2),
+		SymbolSize:       dimension(sizes, 3),
+		SubSymbolSize:    dimension(sizes, 4),
+		User1Size:        dimension(sizes, 5),
+		User2Size:        dimension(sizes, 6),
+
+		LineSpacing:         dimension(spaces, 0),
+		MatrixRowSpacing:    dimension(spaces, 1),
+		MatrixColumnSpacing: dimension(spaces, 2),
+		SuperscriptHeight:   dimension(spaces, 3),
+		SubscriptDepth:      dimension(spaces, 4),
+		SubSupGap:           dimension(spaces, 5),
+
+		Sizes:   append([]Dimension(nil), sizes...),
+		Spacing: append([]Dimension(nil), spaces...),
+	}
+
+	for idx, style := range m.eqnPrefs.styles {
+		typefaceStyle := TypefaceStyle{
+			Typeface: uint8(idx + 1),
+			Bold:     style.style&fontStyleBold != 0,
+			Italic:   style.style&fontStyleItalic != 0,
+		}
+		if style.fontDefIndex != 0 {
+			typefaceStyle.Font = m.fontDef(int(style.fontDefIndex))
+		}
+		prefs.Styles = append(prefs.Styles, typefaceStyle)
+	}
+
+	return prefs, true
+}
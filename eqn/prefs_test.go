@@ -0,0 +1,122 @@
+package eqn
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPreferences(t *testing.T) {
+	prefs, ok := openFixture(t, "oleObject1.bin").Preferences()
+	if !ok {
+		t.Fatal("oleObject1.bin has no EQN_PREFS")
+	}
+
+	dimensions := []struct {
+		name  string
+		value Dimension
+		want  Dimension
+	}{
+		{"FullSize", prefs.FullSize, Dimension{12, UnitPoint}},
+		{"SubscriptSize", prefs.SubscriptSize, Dimension{58, UnitPercent}},
+		{"SubSubscriptSize", prefs.SubSubscriptSize, Dimension{42, UnitPercent}},
+		{"SymbolSize", prefs.SymbolSize, Dimension{150, UnitPercent}},
+		{"User1Size", prefs.User1Size, Dimension{75, UnitPercent}},
+		{"LineSpacing", prefs.LineSpacing, Dimension{150, UnitPercent}},
+		{"SuperscriptHeight", prefs.SuperscriptHeight, Dimension{45, UnitPercent}},
+		{"SubSupGap", prefs.SubSupGap, Dimension{8, UnitPercent}},
+		//没有命名的值在Spacing里
+		{"Spacing[13]", prefs.Spacing[13], Dimension{2.5, UnitPercent}},
+	}
+	for _, d := range dimensions {
+		if d.value != d.want {
+			t.Errorf("%v = %v, want %v", d.name, d.value, d.want)
+		}
+	}
+	if len(prefs.Sizes) != 8 || len(prefs.Spacing) != 30 || len(prefs.Styles) != 12 {
+		t.Errorf("%d sizes, %d spacing values, %d styles, want 8, 30, 12", len(prefs.Sizes), len(prefs.Spacing), len(prefs.Styles))
+	}
+	if points := prefs.FullSizePoints(); points != 12 {
+		t.Errorf("FullSizePoints() = %v, want 12", points)
+	}
+
+	styles := []struct {
+		typeface     uint8
+		font         string
+		bold, italic bool
+	}{
+		{fnTEXT, "Times New Roman", false, false},
+		{fnVARIABLE, "Times New Roman", false, true},
+		{fnLCGREEK, "Symbol", false, true},
+		{fnVECTOR, "Times New Roman", true, false},
+		{fnMTEXTRA, "MT Extra", false, false},
+	}
+	for _, test := range styles {
+		style, ok := prefs.Style(test.typeface)
+		if !ok || style.Typeface != test.typeface || style.Font.Name != test.font || style.Bold != test.bold || style.Italic != test.italic {
+			t.Errorf("Style(%d) = %+v, %v, want %v bold %v italic %v", test.typeface, style, ok, test.font, test.bold, test.italic)
+		}
+	}
+	for _, typeface := range []uint8{0, 13} {
+		if _, ok := prefs.Style(typeface); ok {
+			t.Errorf("Style(%d) ok, want no style", typeface)
+		}
+	}
+
+	//MTEFv3没有EQN_PREFS
+	if _, ok := openFixture(t, "oleObject3.bin").Preferences(); ok {
+		t.Errorf("oleObject3.bin has EQN_PREFS")
+	}
+}
+
+func TestDimension(t *testing.T) {
+	tests := []struct {
+		dimension Dimension
+		text      string
+		points    float64
+		ems       float64
+	}{
+		{Dimension{1, UnitInch}, "1in", 72, 6},
+		{Dimension{2.54, UnitCm}, "2.54cm", 72, 6},
+		{Dimension{12, UnitPoint}, "12pt", 12, 1},
+		{Dimension{1, UnitPica}, "1pc", 12, 1},
+		//百分比按字号12pt计算
+		{Dimension{150, UnitPercent}, "150%", 18, 1.5},
+	}
+	for _, test := range tests {
+		if points := test.dimension.Points(12); math.Abs(points-test.points) > 1e-9 {
+			t.Errorf("%v.Points(12) = %v, want %v", test.dimension, points, test.points)
+		}
+		if ems := test.dimension.Ems(12); math.Abs(ems-test.ems) > 1e-9 {
+			t.Errorf("%v.Ems(12) = %v, want %v", test.dimension, ems, test.ems)
+		}
+
+		text, err := test.dimension.MarshalText()
+		if err != nil || string(text) != test.text {
+			t.Errorf("%v.MarshalText() = %q, %v, want %q", test.dimension, text, err, test.text)
+		}
+		var decoded Dimension
+		if err := decoded.UnmarshalText(text); err != nil || decoded != test.dimension {
+			t.Errorf("UnmarshalText(%q) = %v, %v", text, decoded, err)
+		}
+	}
+
+	if ems := (Dimension{12, UnitPoint}).Ems(0); ems != 0 {
+		t.Errorf("Ems(0) = %v, want 0", ems)
+	}
+	if _, err := (Dimension{1, UnitPercent + 1}).MarshalText(); err == nil {
+		t.Errorf("MarshalText with unit %d: no error", UnitPercent+1)
+	}
+	for _, text := range []string{"12", "12px", "pt"} {
+		var d Dimension
+		if err := d.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %v, want error", text, d)
+		}
+	}
+
+	//full size是百分比或者没有EQN_PREFS时按12pt
+	for _, prefs := range []EquationPreferences{{}, {FullSize: Dimension{100, UnitPercent}}} {
+		if points := prefs.FullSizePoints(); points != 12 {
+			t.Errorf("%v FullSizePoints() = %v, want 12", prefs.FullSize, points)
+		}
+	}
+}
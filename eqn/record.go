@@ -30,6 +30,40 @@ const (
 	ROOT           RecordType = 255
 )
 
+var recordNames = map[RecordType]string{
+	END:            "END",
+	LINE:           "LINE",
+	CHAR:           "CHAR",
+	TMPL:           "TMPL",
+	PILE:           "PILE",
+	MATRIX:         "MATRIX",
+	EMBELL:         "EMBELL",
+	RULER:          "RULER",
+	FONT_STYLE_DEF: "FONT_STYLE_DEF",
+	SIZE:           "SIZE",
+	FULL:           "FULL",
+	SUB:            "SUB",
+	SUB2:           "SUB2",
+	SYM:            "SYM",
+	SUBSYM:         "SUBSYM",
+	COLOR:          "COLOR",
+	COLOR_DEF:      "COLOR_DEF",
+	FONT_DEF:       "FONT_DEF",
+	EQN_PREFS:      "EQN_PREFS",
+	ENCODING_DEF:   "ENCODING_DEF",
+	ROOT:           "ROOT",
+}
+
+func (r RecordType) String() string {
+	if name, ok := recordNames[r]; ok {
+		return name
+	}
+	if r >= FUTURE {
+		return fmt.Sprintf("FUTURE(%d)", uint8(r))
+	}
+	return fmt.Sprintf("RECORD(%d)", uint8(r))
+}
+
 const (
 	MtefOptNudge           OptionType = 0x08
 	MtefOptCharEmbell      OptionType = 0x01
@@ -67,9 +101,21 @@ const (
 	fnSPACE    uint8 = 24
 )
 
+//tab stop的对齐方式
+type TabStopType uint8
+
+const (
+	TabStopLeft       TabStopType = 0
+	TabStopCenter     TabStopType = 1
+	TabStopRight      TabStopType = 2
+	TabStopRelational TabStopType = 3
+	TabStopDecimal    TabStopType = 4
+)
+
+//offset单位是1/32 point，从line的左边开始计算
 type MtTabStop struct {
 	next   *MtTabStop
-	_type  int16
+	_type  TabStopType
 	offset int16
 }
 
@@ -78,11 +124,47 @@ type MtRuler struct {
 	tabStopList *MtTabStop
 }
 
+//对外暴露的tab stop
+type TabStop struct {
+	Type   TabStopType
+	Offset int16
+}
+
+//按顺序返回ruler的所有tab stop，ruler为nil时返回nil
+func (r *MtRuler) TabStops() []TabStop {
+	if r == nil {
+		return nil
+	}
+
+	stops := make([]TabStop, 0, r.nStops)
+	for stop := r.tabStopList; stop != nil; stop = stop.next {
+		stops = append(stops, TabStop{Type: stop._type, Offset: stop.offset})
+	}
+	return stops
+}
+
+func (t TabStopType) String() string {
+	switch t {
+	case TabStopLeft:
+		return "left"
+	case TabStopCenter:
+		return "center"
+	case TabStopRight:
+		return "right"
+	case TabStopRelational:
+		return "relational"
+	case TabStopDecimal:
+		return "decimal"
+	}
+	return fmt.Sprintf("TabStopType(%d)", uint8(t))
+}
+
 type MtLine struct {
 	nudgeX     int16
 	nudgeY     int16
 	lineSpace  uint8
 	null       bool
+	size       RecordType
 	ruler      *MtRuler
 	objectList *MtObjList
 }
@@ -109,19 +191,22 @@ type MtChar struct {
 }
 
 type MtEqnPrefs struct {
-	sizes  []string
-	spaces []string
-	styles []byte
+	options uint8
+	sizes   []Dimension
+	spaces  []Dimension
+	styles  []MtfontStyleDef
 }
 
+//lsize为101时dsize是字号（1/32 point），否则dsize是相对lsize的增量
 type MtSize struct {
 	lsize uint8
-	dsize uint8
+	dsize int16
 }
 
+//style: 1 粗体，2 斜体
 type MtfontStyleDef struct {
 	fontDefIndex uint8
-	name         string
+	style        uint8
 }
 
 type MtfontDef struct {
@@ -134,8 +219,10 @@ type MtColorDefIndex struct {
 }
 
 type MtColorDef struct {
-	values []uint8
-	name   string
+	//mtefCOLOR_SPOT等，CMYK和name由values和name决定
+	options OptionType
+	values  []uint16
+	name    string
 }
 
 type MtObjList struct {
@@ -176,8 +263,9 @@ type MtMatrix struct {
 	rows uint8
 	cols uint8
 
-	//row_parts uint8
-	//col_parts uint8
+	//行和列的分隔线，每条2个bit（0 没有，1 实线，2 虚线，3 点线），分别有rows+1和cols+1条
+	rowParts []byte
+	colParts []byte
 
 	//objectList可以不读，不影响后面字节错位，因为这个是一个完整的额外record数据
 	objectList *MtObjList
@@ -198,6 +286,32 @@ type MtAST struct {
 
 type MtObject interface{}
 
+//SIZE、COLOR和各种定义record不占用template的slot，按位置读取slot的时候需要去掉
+func (ast *MtAST) slots() []*MtAST {
+	slots := make([]*MtAST, 0, len(ast.children))
+	for _, child := range ast.children {
+		switch child.tag {
+		case LINE, CHAR, TMPL, PILE, MATRIX, EMBELL:
+			slots = append(slots, child)
+		}
+	}
+	return slots
+}
+
+//FULL、SUB、SUB2、SYM、SUBSYM和SIZE record对应的字号，
+//SIZE的lsize是0-4的时候和前面5个一样，其他（用户自定义字号、直接指定的字号）没有对应的字号
+func (ast *MtAST) typesize() (RecordType, bool) {
+	switch ast.tag {
+	case FULL, SUB, SUB2, SYM, SUBSYM:
+		return ast.tag, true
+	case SIZE:
+		if lsize := ast.value.(*MtSize).lsize; lsize <= uint8(SUBSYM-FULL) {
+			return FULL + RecordType(lsize), true
+		}
+	}
+	return 0, false
+}
+
 func (ast *MtAST) debug(indent int) {
 	fmt.Printf("> %#v MtAST %#v\n", indent, ast)
 	indent += 1
@@ -367,6 +481,57 @@ const (
 	//0×0010	tvBX_BOTTOM	bottom side is present
 )
 
+//Template variations，对应上面注释里的variation bits
+const (
+	tvFENCE_L       uint16 = 0x0001
+	tvFENCE_R       uint16 = 0x0002
+	tvINTV_LEFT_LP  uint16 = 0x0000
+	tvINTV_LEFT_RP  uint16 = 0x0001
+	tvINTV_LEFT_LB  uint16 = 0x0002
+	tvINTV_LEFT_RB  uint16 = 0x0003
+	tvINTV_RIGHT_LP uint16 = 0x0000
+	tvINTV_RIGHT_RP uint16 = 0x0010
+	tvINTV_RIGHT_LB uint16 = 0x0020
+	tvINTV_RIGHT_RB uint16 = 0x0030
+	tvROOT_SQ       uint16 = 0x0000
+	tvROOT_NTH      uint16 = 0x0001
+	tvFR_SMALL      uint16 = 0x0001
+	tvFR_SLASH      uint16 = 0x0002
+	tvFR_BASE       uint16 = 0x0004
+	tvBAR_DOUBLE    uint16 = 0x0001
+	tvAR_DOUBLE     uint16 = 0x0001
+	tvAR_TOP        uint16 = 0x0004
+	tvAR_BOTTOM     uint16 = 0x0008
+	tvAR_LEFT       uint16 = 0x0010
+	tvAR_RIGHT      uint16 = 0x0020
+	tvINT_1         uint16 = 0x0001
+	tvINT_2         uint16 = 0x0002
+	tvINT_3         uint16 = 0x0003
+	tvINT_LOOP      uint16 = 0x0004
+	tvHB_TOP        uint16 = 0x0001
+	tvLD_UPPER      uint16 = 0x0001
+	tvSU_PRECEDES   uint16 = 0x0001
+	tvDI_LEFT       uint16 = 0x0001
+	tvDI_RIGHT      uint16 = 0x0002
+	tvVE_LEFT       uint16 = 0x0001
+	tvVE_RIGHT      uint16 = 0x0002
+	tvVE_UNDER      uint16 = 0x0004
+	tvVE_HARPOON    uint16 = 0x0008
+	tvST_HORIZ      uint16 = 0x0001
+	tvST_UP         uint16 = 0x0002
+	tvST_DOWN       uint16 = 0x0004
+	tvBX_ROUND      uint16 = 0x0001
+	tvBX_LEFT       uint16 = 0x0002
+	tvBX_RIGHT      uint16 = 0x0004
+	tvBX_TOP        uint16 = 0x0008
+	tvBX_BOTTOM     uint16 = 0x0010
+
+	//Limit Variations (tmINTEG, tmSUM ... tmLIM)
+	tvBO_LOWER uint16 = 0x0010
+	tvBO_UPPER uint16 = 0x0020
+	tvBO_SUM   uint16 = 0x0040
+)
+
 type EmbellType uint8
 
 const (
@@ -0,0 +1,142 @@
+package eqn
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//COLOR_DEF、FONT_STYLE_DEF在最外层，SIZE和COLOR在LINE和TMPL里面
+var styledData = mtefData(
+	//RGB红色；CMYK带名字
+	[]byte{16, 0, 0xFF, 0xFF, 0, 0, 0, 0},
+	[]byte{16, 0x05, 0, 0, 0, 0, 0xFF, 0xFF, 0, 0, 'b', 'l', 'u', 'e', 0},
+	[]byte{8, 1, 2},
+	[]byte{1, 0},
+	//10.5pt（1/32 point）
+	[]byte{9, 101, 0x50, 0x01},
+	[]byte{2, 0, 0x83, 'a', 0},
+	//lsize 2，dsize +3；dsize超出一个字节时lsize前面是100
+	[]byte{9, 2, 131},
+	[]byte{15, 1},
+	[]byte{2, 0, 0x83, 'b', 0},
+	[]byte{9, 100, 7, 0xD4, 0xFE},
+	//分数，分子前面有SUB
+	[]byte{3, 0, 11, 0, 0, 11},
+	[]byte{1, 0, 2, 0, 0x88, '1', 0, 0},
+	[]byte{1, 0, 2, 0, 0x88, '2', 0, 0},
+	[]byte{0, 0, 0},
+)
+
+func recordsOf(nodes []Node) []RecordType {
+	var records []RecordType
+	for _, node := range nodes {
+		records = append(records, node.Record())
+	}
+	return records
+}
+
+func TestStyleRecords(t *testing.T) {
+	eqn, err := OpenMTEF(bytes.NewReader(styledData))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects := eqn.Objects()
+	if records, want := recordsOf(objects), []RecordType{COLOR_DEF, COLOR_DEF, FONT_STYLE_DEF, LINE}; !reflect.DeepEqual(records, want) {
+		t.Fatalf("Objects() = %v, want %v", records, want)
+	}
+	children := objects[3].Children()
+	if records, want := recordsOf(children), []RecordType{SIZE, CHAR, SIZE, COLOR, CHAR, SIZE, TMPL}; !reflect.DeepEqual(records, want) {
+		t.Fatalf("LINE children = %v, want %v", records, want)
+	}
+
+	sizes := []struct {
+		node     Node
+		lsize    uint8
+		dsize    int16
+		typesize RecordType
+		ok       bool
+	}{
+		{children[0], lsizeExplicit, 10*32 + 16, 0, false},
+		{children[2], 2, 3, SUB2, true},
+		{children[5], 7, -300, 0, false},
+	}
+	for i, test := range sizes {
+		size := test.node.(*Size)
+		typesize, ok := size.Typesize()
+		if size.LSize() != test.lsize || size.DSize() != test.dsize || typesize != test.typesize || ok != test.ok {
+			t.Errorf("SIZE %d: lsize %d, dsize %d, typesize %v, %v, want %d, %d, %v, %v", i, size.LSize(), size.DSize(), typesize, ok, test.lsize, test.dsize, test.typesize, test.ok)
+		}
+	}
+	if index := children[3].(*Color).Index(); index != 1 {
+		t.Errorf("COLOR index = %d, want 1", index)
+	}
+
+	//SUB不占用slot
+	tmpl := children[6].(*Template)
+	if records, want := recordsOf(tmpl.Children()), []RecordType{SUB, LINE, LINE}; !reflect.DeepEqual(records, want) {
+		t.Errorf("TMPL children = %v, want %v", records, want)
+	}
+	if latex, err := eqn.Translate(); err != nil || !strings.Contains(latex, `\frac`) {
+		t.Errorf("Translate() = %q, %v", latex, err)
+	}
+
+	//写出去的数据和读进来的一样
+	data, err := eqn.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, styledData) {
+		t.Errorf("MarshalBinary() =\n%v, want\n%v", data, styledData)
+	}
+}
+
+//PILE和第一个LINE都带RULER，offset是1/32 point
+func TestTabStops(t *testing.T) {
+	pileStops := []TabStop{{TabStopRelational, 0x0140}, {TabStopDecimal, 0x0280}}
+	lineStops := []TabStop{{TabStopCenter, 0x20}}
+	v5 := mtefData(
+		[]byte{4, 0x02, 1, 1, 7, 2, 3, 0x40, 0x01, 4, 0x80, 0x02},
+		[]byte{1, 0x02, 7, 1, 1, 0x20, 0x00}, testChar, []byte{0},
+		[]byte{1, 0}, testChar, []byte{0},
+		[]byte{0, 0},
+	)
+	//v3：RULER跟在tag后面，option是xfRULER
+	v3 := []byte{3, 1, 1, 3, 0,
+		0x24, 1, 1, 7, 2, 3, 0x40, 0x01, 4, 0x80, 0x02,
+		0x21, 7, 1, 1, 0x20, 0x00, 0x02, 0x83, 'x', 0, 0x00,
+		0x01, 0x02, 0x83, 'x', 0, 0x00,
+		0x00,
+		0x00,
+	}
+
+	//写出去再读回来，tab stop不变
+	written, err := OpenMTEF(bytes.NewReader(v3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewritten, err := written.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range [][]byte{v5, v3, rewritten} {
+		eqn, err := OpenMTEF(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pile := eqn.Objects()[len(eqn.Objects())-1].(*Pile)
+		if stops := pile.TabStops(); !reflect.DeepEqual(stops, pileStops) {
+			t.Errorf("MTEFv%d PILE tab stops = %v, want %v", data[0], stops, pileStops)
+		}
+		lines := pile.Lines()
+		if stops := lines[0].TabStops(); !reflect.DeepEqual(stops, lineStops) {
+			t.Errorf("MTEFv%d LINE tab stops = %v, want %v", data[0], stops, lineStops)
+		}
+		if stops := lines[1].TabStops(); stops != nil {
+			t.Errorf("MTEFv%d LINE without RULER has tab stops %v", data[0], stops)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package eqn
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//LINE开始时的字号由template决定，渲染的时候已经会自动缩小上下标，只需要输出作者手动修改的字号，
+//所以按字号record把LINE分成几段，每段和LINE开始时的字号比较
+
+//SIZE record的lsize为101时直接指定字号
+const lsizeExplicit = 101
+
+//LINE里的一段，从一个字号record开始到下一个字号record为止
+type sizeRun struct {
+	//这一段的字号（FULL、SUB、SUB2、SYM、SUBSYM）
+	size RecordType
+	//SIZE record直接指定的字号（point），0表示按size
+	points float64
+	nodes  []*MtAST
+}
+
+//按字号record把LINE的子节点分段，第一段的字号是LINE开始时的字号，字号record本身不在nodes里，
+//没有节点的段去掉
+func lineRuns(line *MtAST) []sizeRun {
+	var runs []sizeRun
+	run := sizeRun{size: line.value.(*MtLine).size}
+	for _, child := range line.children {
+		size, ok := child.typesize()
+		points := explicitPoints(child)
+		if !ok && points == 0 {
+			run.nodes = append(run.nodes, child)
+			continue
+		}
+
+		if len(run.nodes) > 0 {
+			runs = append(runs, run)
+		}
+		run = sizeRun{size: run.size, points: points}
+		if ok {
+			run.size = size
+		}
+	}
+	if len(run.nodes) > 0 {
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+//SIZE record直接指定的字号（point），其他record返回0
+func explicitPoints(ast *MtAST) float64 {
+	if size, ok := ast.value.(*MtSize); ok && size.lsize == lsizeExplicit {
+		return float64(size.dsize) / 32
+	}
+	return 0
+}
+
+//字号对应的MathML scriptlevel，SYM是正文里的大型运算符，SUBSYM是上下标里的大型运算符
+var scriptLevels = map[RecordType]int{
+	FULL:   0,
+	SUB:    1,
+	SUB2:   2,
+	SYM:    0,
+	SUBSYM: 1,
+}
+
+//和LINE开始时的字号不一样的段用mstyle包起来，scriptlevel是相对的，SYM用displaystyle
+func mathmlSizeAttrs(lineSize RecordType, run sizeRun) string {
+	attrs := ""
+	if level := scriptLevels[run.size] - scriptLevels[lineSize]; level != 0 {
+		attrs += fmt.Sprintf(` scriptlevel="%+d"`, level)
+	}
+	if (run.size == SYM) != (lineSize == SYM) {
+		attrs += fmt.Sprintf(` displaystyle="%v"`, run.size == SYM)
+	}
+	if run.points != 0 {
+		attrs += fmt.Sprintf(` mathsize="%vpt"`, strconv.FormatFloat(run.points, 'f', -1, 64))
+	}
+	return attrs
+}
+
+//MathType默认的Define Sizes
+var defaultTypesizes = map[RecordType]Dimension{
+	SUB:    {58, UnitPercent},
+	SUB2:   {42, UnitPercent},
+	SYM:    {150, UnitPercent},
+	SUBSYM: {100, UnitPercent},
+}
+
+//typesize对应的字号（point），按照EQN_PREFS的Define Sizes计算，没有的时候用MathType默认的
+func (p EquationPreferences) TypesizePoints(size RecordType) float64 {
+	full := p.FullSizePoints()
+	dimension := map[RecordType]Dimension{
+		SUB:    p.SubscriptSize,
+		SUB2:   p.SubSubscriptSize,
+		SYM:    p.SymbolSize,
+		SUBSYM: p.SubSymbolSize,
+	}[size]
+	if dimension.Value == 0 {
+		dimension = defaultTypesizes[size]
+	}
+	if dimension.Value == 0 {
+		return full
+	}
+	return dimension.Points(full)
+}
+
+//OMML没有相对的字号，手动修改了字号的字符在m:r里加上w:sz（半point）
+func ommlSizeProps(prefs EquationPreferences, lineSize RecordType, run sizeRun) string {
+	points := run.points
+	if points == 0 {
+		if run.size == lineSize {
+			return ""
+		}
+		points = prefs.TypesizePoints(run.size)
+	}
+	return fmt.Sprintf(`<w:rPr><w:sz w:val="%d"/></w:rPr>`, int(points*2+0.5))
+}
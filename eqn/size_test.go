@@ -0,0 +1,76 @@
+package eqn
+
+import (
+	"strings"
+	"testing"
+)
+
+func sizeNode(size RecordType) Node {
+	return &Size{&MtAST{size, nil, nil}}
+}
+
+func TestSizeChanges(t *testing.T) {
+	//a \scriptstyle b \textstyle c，SUBSYM和上下标一样
+	m := New(NewLine(
+		NewChar('a', int(fnVARIABLE)),
+		sizeNode(SUB), NewChar('b', int(fnVARIABLE)),
+		sizeNode(FULL), NewChar('c', int(fnVARIABLE)),
+		sizeNode(SUBSYM), NewChar(0x2211, int(fnSYMBOL)),
+	))
+
+	latex, err := m.Translate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `a \scriptstyle b \textstyle c \scriptstyle ∑`; !strings.Contains(latex, want) {
+		t.Errorf("latex %q does not contain %q", latex, want)
+	}
+
+	mathml, err := m.TranslateMathML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<mi>a</mi><mstyle scriptlevel="+1"><mi>b</mi></mstyle><mi>c</mi><mstyle scriptlevel="+1"><mo>∑</mo></mstyle>`; !strings.Contains(mathml, want) {
+		t.Errorf("mathml %q does not contain %q", mathml, want)
+	}
+
+	omml, err := m.TranslateOMML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//默认的EQN_PREFS：12pt，下标58%，上下标里的大型运算符100%
+	for _, want := range []string{
+		`<m:r><m:t>a</m:t></m:r>`,
+		`<m:r><w:rPr><w:sz w:val="14"/></w:rPr><m:t>b</m:t></m:r>`,
+		`<m:r><m:t>c</m:t></m:r>`,
+		`<m:r><w:rPr><w:sz w:val="24"/></w:rPr><m:t>∑</m:t></m:r>`,
+	} {
+		if !strings.Contains(omml, want) {
+			t.Errorf("omml %q does not contain %q", omml, want)
+		}
+	}
+}
+
+func TestExplicitSize(t *testing.T) {
+	m := New(NewLine(
+		NewChar('a', int(fnVARIABLE)),
+		&Size{&MtAST{SIZE, &MtSize{lsize: lsizeExplicit, dsize: 10*32 + 16}, nil}},
+		NewChar('b', int(fnVARIABLE)),
+	))
+
+	mathml, err := m.TranslateMathML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<mstyle mathsize="10.5pt"><mi>b</mi></mstyle>`; !strings.Contains(mathml, want) {
+		t.Errorf("mathml %q does not contain %q", mathml, want)
+	}
+
+	omml, err := m.TranslateOMML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<w:sz w:val="21"/>`; !strings.Contains(omml, want) {
+		t.Errorf("omml %q does not contain %q", omml, want)
+	}
+}
@@ -0,0 +1,196 @@
+package eqn
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+//检查MTEF数据读取后重新编码是否和原来一样：
+//	先比较字节，一样就结束
+//	不一样的时候把两边的数据都按record切开，按最长公共子序列对齐，返回不一样的record和它们的位置
+//MTEF数据逐字节比较，不去掉任何数据。载体里MTEF数据的长度（EQNOLEFILEHDR的CbObject，metafile的totalLen）
+//后面补齐的数据不属于公式，不算差异，只记录在Padding里
+//MTEFv3/v4的数据重新编码后是MTEFv5，不可能一样，Diffs里是升级后的差异
+
+//一个record在MTEF数据里的位置，header的Record是ROOT
+type RecordSpan struct {
+	Offset int64
+	Record RecordType
+	Data   []byte
+}
+
+//一处差异，Original或Encoded为nil表示这一边没有对应的record
+type RecordDiff struct {
+	Original *RecordSpan
+	Encoded  *RecordSpan
+}
+
+type Verification struct {
+	//原来数据的MTEF版本
+	Version uint8
+
+	//原来的MTEF数据（不包括载体补齐的数据）和重新编码的数据
+	Original []byte
+	Encoded  []byte
+
+	//载体里MTEF数据后面补齐的字节数
+	Padding int
+
+	Equal bool
+	Diffs []RecordDiff
+}
+
+//读取MTEF数据（不包括EQNOLEFILEHDR），重新编码后和原来的数据比较，data的所有字节都要一样
+func Verify(data []byte) (*Verification, error) {
+	return VerifyPayload(data, len(data))
+}
+
+//data是载体里的数据，前面length个字节是MTEF数据，后面的是补齐的数据，只比较MTEF数据
+func VerifyPayload(data []byte, length int) (*Verification, error) {
+	if length < 0 || length > len(data) {
+		return nil, fmt.Errorf("mtef: verify: payload length %d out of range 0..%d", length, len(data))
+	}
+
+	eqn, err := OpenMTEF(bytes.NewReader(data[:length]))
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := eqn.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	v := &Verification{Version: eqn.mMtefVer, Original: data[:length], Encoded: encoded, Padding: len(data) - length}
+
+	v.Equal = bytes.Equal(v.Original, v.Encoded)
+	if v.Equal {
+		return v, nil
+	}
+
+	original, err := splitRecords(v.Original)
+	if err != nil {
+		return nil, err
+	}
+	records, err := splitRecords(v.Encoded)
+	if err != nil {
+		return nil, err
+	}
+	v.Diffs = diffRecords(original, records)
+	return v, nil
+}
+
+//按扩展名取出文件里的MTEF数据再Verify，支持的格式和OpenFile一样，LaTeX、MathML、JSON没有原始数据，不支持，
+//不是compound file的当作不带EQNOLEFILEHDR的MTEF数据
+func VerifyFile(filepath string) (*Verification, error) {
+	buffer, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(buffer)
+	data, length := buffer, len(buffer)
+	switch ext := strings.ToLower(filepath[strings.LastIndex(filepath, ".")+1:]); ext {
+	case "wmf", "emf":
+		data, length, err = metafilePayload(reader)
+	case "gif", "png", "eps", "svg":
+		//图片里编码的数据就是MTEF数据，没有补齐
+		data, err = ExtractImage(reader)
+		length = len(data)
+	case "json", "tex", "mml", "mathml":
+		return nil, fmt.Errorf("mtef: verify %v: no MTEF data in .%v files", filepath, ext)
+	default:
+		if bytes.HasPrefix(buffer, cfbSignature) {
+			var hdr OleHeader
+			hdr, data, err = readEquationNative(reader)
+			length = int(hdr.CbObject)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return VerifyPayload(data, length)
+}
+
+//把MTEF数据切成record，每个record从上一个结束的位置开始（跳过的FUTURE record算在后面的record里）
+func splitRecords(data []byte) (spans []RecordSpan, err error) {
+	m := &MTEFv5{reader: bytes.NewReader(data)}
+	if err = m.readHeader(); err != nil {
+		return nil, newParseError(0, ROOT, err)
+	}
+	spans = append(spans, RecordSpan{0, ROOT, data[:m.offset()]})
+
+	start := m.offset()
+	for {
+		node, _, err := m.nextRecord()
+		if err == io.EOF {
+			return spans, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		end := m.offset()
+		spans = append(spans, RecordSpan{start, node.tag, data[start:end]})
+		start = end
+	}
+}
+
+//按最长公共子序列对齐两边的record，连续的删除和插入两两配对
+func diffRecords(original []RecordSpan, encoded []RecordSpan) (diffs []RecordDiff) {
+	same := func(i int, j int) bool {
+		return bytes.Equal(original[i].Data, encoded[j].Data)
+	}
+
+	//lcs[i][j]是original[i:]和encoded[j:]的最长公共子序列长度
+	lcs := make([][]int, len(original)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(encoded)+1)
+	}
+	for i := len(original) - 1; i >= 0; i-- {
+		for j := len(encoded) - 1; j >= 0; j-- {
+			switch {
+			case same(i, j):
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var removed, added []*RecordSpan
+	flush := func() {
+		for len(removed) > 0 || len(added) > 0 {
+			var diff RecordDiff
+			if len(removed) > 0 {
+				diff.Original, removed = removed[0], removed[1:]
+			}
+			if len(added) > 0 {
+				diff.Encoded, added = added[0], added[1:]
+			}
+			diffs = append(diffs, diff)
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(original) || j < len(encoded) {
+		switch {
+		case i < len(original) && j < len(encoded) && same(i, j):
+			flush()
+			i, j = i+1, j+1
+		case j == len(encoded) || (i < len(original) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, &original[i])
+			i++
+		default:
+			added = append(added, &encoded[j])
+			j++
+		}
+	}
+	flush()
+	return diffs
+}
@@ -0,0 +1,96 @@
+package eqn
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+)
+
+//test目录里的所有文件重新编码后都要和原来的MTEF数据完全一样，
+//MTEFv3/v4写回去是MTEFv5，检查升级后的数据再编码一次不变
+func TestVerifyFixtures(t *testing.T) {
+	infos, err := ioutil.ReadDir("../test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, info := range infos {
+		file := path.Join("../test", info.Name())
+		t.Run(info.Name(), func(t *testing.T) {
+			v, err := VerifyFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Version != 5 {
+				upgraded, err := Verify(v.Encoded)
+				if err != nil {
+					t.Fatal(err)
+				}
+				v = upgraded
+			}
+			if !v.Equal || len(v.Diffs) > 0 {
+				t.Errorf("%v: %d bytes, re-encoded %d bytes, %d records differ", file, len(v.Original), len(v.Encoded), len(v.Diffs))
+			}
+			for _, diff := range v.Diffs {
+				t.Errorf("original %+v, encoded %+v", diff.Original, diff.Encoded)
+			}
+		})
+	}
+}
+
+func TestVerifyPadding(t *testing.T) {
+	data, err := New(NewLine(NewChar('x', int(fnVARIABLE)))).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//MTEF数据后面的0只有在载体的长度之外才不算差异
+	padded := append(append([]byte{}, data...), 0, 0, 0)
+	v, err := VerifyPayload(padded, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Equal || v.Padding != 3 {
+		t.Errorf("VerifyPayload = equal %v, padding %d, want equal with 3 bytes of padding", v.Equal, v.Padding)
+	}
+
+	if v, err = Verify(padded); err == nil && v.Equal {
+		t.Errorf("Verify ignored %d trailing zeros inside the payload", len(padded)-len(data))
+	}
+}
+
+//手写的MTEF数据：2个字节和4个字节的nudge，只有一个方向的nudge，embellishment的nudge，都要逐字节一样
+func TestVerifyNudges(t *testing.T) {
+	data := append(testPreamble(t),
+		//LINE，nudge (5, 0)
+		1, 8, 133, 128,
+		//CHAR x，nudge (1000, -1000)
+		2, 8, 128, 128, 0xe8, 0x03, 0x18, 0xfc, 128+3, 'x', 0,
+		//CHAR y，dot的nudge (0, -7)，hat的nudge (8, 8)
+		2, 1, 128+3, 'y', 0,
+		6, 8, 128, 121, 2,
+		6, 8, 136, 136, 9,
+		0,
+		//分数，nudge (0, 512)
+		3, 8, 128, 128, 0, 0, 0, 2, 11, 0, 0,
+		1, 0, 2, 0, 128+3, 'a', 0, 0,
+		1, 8, 1, 255, 2, 0, 128+3, 'b', 0, 0,
+		0,
+		0, 0)
+
+	v, err := Verify(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Equal || v.Padding != 0 {
+		t.Errorf("Verify: equal %v, padding %d, diffs %+v", v.Equal, v.Padding, v.Diffs)
+	}
+	if eqn, err := OpenMTEF(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	} else if nudges, want := collectNudges(eqn), [][2]int16{
+		{5, 0}, {1000, -1000}, {0, 0}, {0, -7}, {8, 8}, {0, 512}, {0, 0}, {0, 0}, {-127, 127}, {0, 0},
+	}; !reflect.DeepEqual(nudges, want) {
+		t.Errorf("nudges = %v, want %v", nudges, want)
+	}
+}
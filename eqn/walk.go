@@ -0,0 +1,144 @@
+package eqn
+
+//和go/ast一样的遍历方式：
+//	Walk    Visitor的Visit在进入节点时调用，返回的Visitor用来访问子节点，子节点访问完以后再调用一次Visit(nil)
+//	Inspect 只需要进入节点时的回调，返回false不访问子节点
+//	Apply   pre/post分别在进入和离开节点时调用，可以通过Cursor替换、删除、插入节点
+
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+//深度优先遍历node和它的子节点，Char的embellishment不是节点，通过Char.Embellishments()读取
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range node.Children() {
+		Walk(v, child)
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+//深度优先遍历，f返回false时不访问子节点，子节点访问完以后调用f(nil)
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+//Apply的回调
+type ApplyFunc func(*Cursor) bool
+
+//Apply遍历时的当前节点，以及它在父节点里的位置
+type Cursor struct {
+	parent Node
+	node   Node
+	index  int
+	iter   *iterator
+}
+
+type iterator struct {
+	index int
+	step  int
+}
+
+func (c *Cursor) Node() Node   { return c.node }
+func (c *Cursor) Parent() Node { return c.parent }
+
+//在父节点的子节点（包括字号、颜色等record）里的下标
+func (c *Cursor) Index() int { return c.index }
+
+//替换当前节点，新节点的子节点会继续被访问
+func (c *Cursor) Replace(node Node) {
+	c.parent.mtAST().children[c.index] = node.mtAST()
+	c.node = node
+}
+
+//删除当前节点，之后不再访问它的子节点，也不会调用post
+func (c *Cursor) Delete() {
+	parent := c.parent.mtAST()
+	parent.children = append(parent.children[:c.index], parent.children[c.index+1:]...)
+	c.node = nil
+	c.iter.step--
+}
+
+//在当前节点前面插入，插入的节点不会被访问
+func (c *Cursor) InsertBefore(node Node) {
+	c.insert(c.index, node)
+	c.index++
+	c.iter.index++
+}
+
+//在当前节点后面插入，插入的节点不会被访问
+func (c *Cursor) InsertAfter(node Node) {
+	c.insert(c.index+1, node)
+	c.iter.step++
+}
+
+func (c *Cursor) insert(idx int, node Node) {
+	parent := c.parent.mtAST()
+	parent.children = append(parent.children, nil)
+	copy(parent.children[idx+1:], parent.children[idx:])
+	parent.children[idx] = node.mtAST()
+}
+
+//遍历root的子节点，pre返回false时不访问子节点也不调用post，post返回false时停止遍历。
+//root本身不会被替换，需要替换最外层的节点时从MTEFv5.Root()开始
+func Apply(root Node, pre ApplyFunc, post ApplyFunc) {
+	a := &application{pre: pre, post: post}
+	a.applyList(root)
+}
+
+type application struct {
+	pre  ApplyFunc
+	post ApplyFunc
+	iter iterator
+}
+
+func (a *application) applyList(parent Node) bool {
+	saved := a.iter
+	defer func() { a.iter = saved }()
+
+	a.iter.index = 0
+	for a.iter.index < len(parent.mtAST().children) {
+		a.iter.step = 1
+		if !a.apply(parent, a.iter.index) {
+			return false
+		}
+		a.iter.index += a.iter.step
+	}
+	return true
+}
+
+func (a *application) apply(parent Node, idx int) bool {
+	cursor := &Cursor{
+		parent: parent,
+		node:   wrapNode(parent.mtAST().children[idx]),
+		index:  idx,
+		iter:   &a.iter,
+	}
+
+	if a.pre != nil && !a.pre(cursor) {
+		return true
+	}
+	if cursor.node == nil {
+		return true
+	}
+	if !a.applyList(cursor.node) {
+		return false
+	}
+	if a.post != nil && !a.post(cursor) {
+		return false
+	}
+	return true
+}
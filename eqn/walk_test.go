@@ -0,0 +1,115 @@
+package eqn
+
+import (
+	"reflect"
+	"testing"
+)
+
+//进入节点时记录record，离开时记录END
+type recordVisitor struct{ records *[]RecordType }
+
+func (v recordVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		*v.records = append(*v.records, END)
+		return nil
+	}
+	*v.records = append(*v.records, node.Record())
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	eqn := New(NewLine(NewChar('a', int(fnVARIABLE)), NewChar('+', int(fnSYMBOL)), NewChar('b', int(fnVARIABLE))))
+	line := eqn.Objects()[len(eqn.Objects())-1]
+
+	var records []RecordType
+	Walk(recordVisitor{&records}, line)
+	if want := []RecordType{LINE, CHAR, END, CHAR, END, CHAR, END, END}; !reflect.DeepEqual(records, want) {
+		t.Errorf("Walk visited %v, want %v", records, want)
+	}
+
+	//返回false不访问子节点，也不调用f(nil)
+	records = nil
+	Inspect(eqn.Root(), func(node Node) bool {
+		if node == nil {
+			records = append(records, END)
+			return false
+		}
+		records = append(records, node.Record())
+		return node.Record() == ROOT
+	})
+	if want := append(recordsOf(eqn.Objects()), END); records[0] != ROOT || !reflect.DeepEqual(records[1:], want) {
+		t.Errorf("Inspect visited %v, want ROOT %v", records, want)
+	}
+}
+
+//oleObject1.bin的节点都被访问到，Apply替换的节点写进MTEF数据
+func TestApply(t *testing.T) {
+	eqn := openFixture(t, "oleObject1.bin")
+
+	var walked, applied []RecordType
+	Inspect(eqn.Root(), func(node Node) bool {
+		if node != nil && node.Record() != ROOT {
+			walked = append(walked, node.Record())
+		}
+		return true
+	})
+	Apply(eqn.Root(), func(c *Cursor) bool {
+		applied = append(applied, c.Node().Record())
+		return true
+	}, nil)
+	if !reflect.DeepEqual(walked, applied) {
+		t.Errorf("Inspect visited %v, Apply visited %v", walked, applied)
+	}
+
+	//b换成q
+	Apply(eqn.Root(), func(c *Cursor) bool {
+		if char, ok := c.Node().(*Char); ok && char.Rune() == 'b' {
+			c.Replace(NewChar('q', char.Typeface()))
+		}
+		return true
+	}, nil)
+	if latex, err := eqn.Translate(); err != nil || latex != `$$ \frac { -q±\sqrt[] { q ^ { 2 } -4ac } } { 2a } $$` {
+		t.Errorf("after replacing b Translate() = %q, %v", latex, err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	eqn := New(NewLine(NewChar('a', int(fnVARIABLE)), NewChar('+', int(fnSYMBOL)), NewChar('b', int(fnVARIABLE))))
+	line := eqn.Objects()[len(eqn.Objects())-1]
+
+	//+前面插入x，后面插入y，删除b；插入的节点不访问
+	var visited []rune
+	Apply(line, func(c *Cursor) bool {
+		char := c.Node().(*Char)
+		visited = append(visited, char.Rune())
+		switch char.Rune() {
+		case '+':
+			c.InsertBefore(NewChar('x', int(fnVARIABLE)))
+			c.InsertAfter(NewChar('y', int(fnVARIABLE)))
+			if c.Index() != 2 || c.Parent().mtAST() != line.mtAST() {
+				t.Errorf("cursor index %d after InsertBefore, want 2", c.Index())
+			}
+		case 'b':
+			c.Delete()
+		}
+		return true
+	}, nil)
+	if want := []rune{'a', '+', 'b'}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Apply visited %q, want %q", visited, want)
+	}
+	if latex, err := eqn.Translate(); err != nil || latex != "$$ ax+y $$" {
+		t.Errorf("Translate() = %q, %v, want ax+y", latex, err)
+	}
+
+	//post返回false时停止遍历
+	visited = nil
+	Apply(line, func(c *Cursor) bool {
+		visited = append(visited, c.Node().(*Char).Rune())
+		return true
+	}, func(c *Cursor) bool {
+		return c.Node().(*Char).Rune() != 'x'
+	})
+	if want := []rune{'a', 'x'}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Apply with post visited %q, want %q", visited, want)
+	}
+}
@@ -0,0 +1,394 @@
+package eqn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//把公式编码成MTEFv5数据，和读取的时候一样按record顺序写：
+//	header:  版本(5) platform product version versionSub application\0 options
+//	records: 定义record + 公式 + END，LINE、TMPL、PILE、MATRIX的object list和CHAR的embellishment list也以END结束
+//option flag按照节点的内容重新计算（nudge、ruler、null line、embellishment等），
+//MTEFv3/v4的公式没有定义record，写的时候加上默认的字体和EQN_PREFS
+
+//MathType 6默认的字体和EQN_PREFS，typeface 1-12对应的字体和样式
+var defaultPreamble = []*MtAST{
+	{ENCODING_DEF, "WinAllBasicCodePages", nil},
+	{FONT_DEF, &MtfontDef{encDefIndex: 5, name: "Times New Roman"}, nil},
+	{FONT_DEF, &MtfontDef{encDefIndex: 3, name: "Symbol"}, nil},
+	{FONT_DEF, &MtfontDef{encDefIndex: 5, name: "Courier New"}, nil},
+	{FONT_DEF, &MtfontDef{encDefIndex: 4, name: "MT Extra"}, nil},
+	{EQN_PREFS, &MtEqnPrefs{
+		sizes: []Dimension{
+			{12, UnitPoint}, {58, UnitPercent}, {42, UnitPercent}, {150, UnitPercent},
+			{100, UnitPercent}, {75, UnitPercent}, {150, UnitPercent}, {1, UnitPoint},
+		},
+		spaces: []Dimension{
+			{150, UnitPercent}, {150, UnitPercent}, {100, UnitPercent}, {45, UnitPercent}, {25, UnitPercent},
+			{8, UnitPercent}, {25, UnitPercent}, {100, UnitPercent}, {100, UnitPercent}, {35, UnitPercent},
+			{100, UnitPercent}, {8, UnitPercent}, {5, UnitPercent}, {2.5, UnitPercent}, {8, UnitPercent},
+			{8, UnitPercent}, {100, UnitPercent}, {100, UnitPercent}, {0, UnitPercent}, {8, UnitPercent},
+			{17, UnitPercent}, {8, UnitPercent}, {100, UnitPercent}, {12.5, UnitPercent}, {45, UnitPercent},
+			{5, UnitPercent}, {5, UnitPercent}, {5, UnitPercent}, {5, UnitPercent}, {10, UnitPercent},
+		},
+		styles: []MtfontStyleDef{
+			{1, 0}, {1, 0}, {1, fontStyleItalic}, {2, fontStyleItalic}, {2, 0}, {2, 0},
+			{1, fontStyleBold}, {1, 0}, {3, 0}, {1, 0}, {4, 0}, {1, 0},
+		},
+	}, nil},
+}
+
+//新建MTEFv5公式，header和MathType 6保存的一样，带上默认的字体和EQN_PREFS，
+//objects是公式本身，一般是一个LINE或者PILE
+func New(objects ...Node) *MTEFv5 {
+	m := &MTEFv5{
+		mMtefVer:     5,
+		mPlatform:    PlatformWindows,
+		mProduct:     ProductMathType,
+		mVersion:     6,
+		mVersionSub:  9,
+		mApplication: "DSMT6",
+		Valid:        true,
+	}
+
+	m.ast = &MtAST{tag: ROOT}
+	for _, def := range defaultPreamble {
+		m.ast.children = append(m.ast.children, def)
+		m.addDef(def)
+	}
+	m.ast.children = append(m.ast.children, &MtAST{FULL, nil, nil})
+	for _, object := range objects {
+		m.ast.children = append(m.ast.children, object.mtAST())
+	}
+	return m
+}
+
+//记录定义record，COLOR和CHAR的typeface通过编号引用
+func (m *MTEFv5) addDef(node *MtAST) {
+	switch def := node.value.(type) {
+	case *MtColorDef:
+		m.colorDefs = append(m.colorDefs, def)
+	case *MtfontStyleDef:
+		m.fontStyleDefs = append(m.fontStyleDefs, def)
+	case *MtfontDef:
+		m.fontDefs = append(m.fontDefs, def)
+	case *MtEqnPrefs:
+		m.eqnPrefs = def
+	case string:
+		m.encodingDefs = append(m.encodingDefs, def)
+	}
+}
+
+//编码成MTEFv5数据，不包括EQNOLEFILEHDR
+func (m *MTEFv5) MarshalBinary() ([]byte, error) {
+	w := new(mtefWriter)
+	if err := w.writeEquation(m); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+//把MarshalBinary的结果写到w
+func (m *MTEFv5) WriteTo(w io.Writer) (n int64, err error) {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := w.Write(data)
+	return int64(count), err
+}
+
+type mtefWriter struct {
+	bytes.Buffer
+}
+
+func (w *mtefWriter) write(data ...interface{}) {
+	for _, d := range data {
+		//写到bytes.Buffer不会出错
+		_ = binary.Write(w, binary.LittleEndian, d)
+	}
+}
+
+func (w *mtefWriter) writeString(s string) {
+	w.WriteString(s)
+	w.WriteByte(0)
+}
+
+func (w *mtefWriter) writeEquation(m *MTEFv5) (err error) {
+	//MTEFv3/v4的header没有application key
+	application := m.mApplication
+	if application == "" {
+		application = "DSMT4"
+	}
+	w.write(uint8(5), m.mPlatform, m.mProduct, m.mVersion, m.mVersionSub)
+	w.writeString(application)
+	w.write(m.mInline)
+
+	if m.ast == nil {
+		w.write(END)
+		return nil
+	}
+
+	//没有定义record的时候（MTEFv3/v4或者直接生成的公式）加上默认的
+	hasDefs := false
+	for _, child := range m.ast.children {
+		switch child.tag {
+		case COLOR_DEF, FONT_STYLE_DEF, FONT_DEF, ENCODING_DEF, EQN_PREFS:
+			hasDefs = true
+		}
+	}
+	if !hasDefs {
+		for _, def := range defaultPreamble {
+			if err = w.writeRecord(def); err != nil {
+				return err
+			}
+		}
+	}
+
+	//最外层的record也以END结束
+	return w.writeObjectList(m.ast)
+}
+
+func (w *mtefWriter) writeObjectList(ast *MtAST) (err error) {
+	for _, child := range ast.children {
+		if err = w.writeRecord(child); err != nil {
+			return err
+		}
+	}
+	w.write(END)
+	return nil
+}
+
+func (w *mtefWriter) writeRecord(ast *MtAST) (err error) {
+	switch value := ast.value.(type) {
+	case *MtLine:
+		options := nudgeOption(value.nudgeX, value.nudgeY)
+		if value.lineSpace != 0 {
+			options |= MtefOptLineLspace
+		}
+		if value.ruler != nil {
+			options |= mtefOPT_LP_RULER
+		}
+		if value.null {
+			options |= MtefOptLineNull
+		}
+
+		w.write(LINE, options)
+		w.writeNudge(value.nudgeX, value.nudgeY)
+		if value.lineSpace != 0 {
+			w.write(value.lineSpace)
+		}
+		w.writeRuler(value.ruler)
+		if value.null {
+			return nil
+		}
+		return w.writeObjectList(ast)
+	case *MtChar:
+		//encoding相关的bit保留原来的，nudge和embellishment按内容决定
+		options := OptionType(value.options) &^ (MtefOptNudge | MtefOptCharEmbell)
+		options |= nudgeOption(value.nudgeX, value.nudgeY)
+		if value.embellishments != nil {
+			options |= MtefOptCharEmbell
+		}
+
+		w.write(CHAR, options)
+		w.writeNudge(value.nudgeX, value.nudgeY)
+		w.write(value.typeface)
+		if MtefOptCharEncNoMtcode != MtefOptCharEncNoMtcode&options {
+			w.write(value.mtcode)
+		}
+		if MtefOptCharEncChar8 == MtefOptCharEncChar8&options {
+			w.write(value.bits8)
+		}
+		if MtefOptCharEncChar16 == MtefOptCharEncChar16&options {
+			w.write(value.bits16)
+		}
+
+		if value.embellishments != nil {
+			for embell := value.embellishments; embell != nil; embell = embell.next {
+				w.write(EMBELL, nudgeOption(embell.nudgeX, embell.nudgeY))
+				w.writeNudge(embell.nudgeX, embell.nudgeY)
+				w.write(embell.embell)
+			}
+			w.write(END)
+		}
+		return nil
+	case *MtTmpl:
+		w.write(TMPL, nudgeOption(value.nudgeX, value.nudgeY))
+		w.writeNudge(value.nudgeX, value.nudgeY)
+		w.write(value.selector)
+
+		//variation小于0x80时1个字节，否则第一个字节的最高位为1，后面再跟1个字节
+		if value.variation < 0x80 {
+			w.write(uint8(value.variation))
+		} else {
+			w.write(uint8(value.variation&0x7F|0x80), uint8(value.variation>>8))
+		}
+		w.write(value.options)
+		return w.writeObjectList(ast)
+	case *MtPile:
+		options := nudgeOption(value.nudgeX, value.nudgeY)
+		if value.ruler != nil {
+			options |= mtefOPT_LP_RULER
+		}
+
+		w.write(PILE, options)
+		w.writeNudge(value.nudgeX, value.nudgeY)
+		w.write(value.halign, value.valign)
+		w.writeRuler(value.ruler)
+		return w.writeObjectList(ast)
+	case *MtMatrix:
+		w.write(MATRIX, nudgeOption(value.nudgeX, value.nudgeY))
+		w.writeNudge(value.nudgeX, value.nudgeY)
+		w.write(value.valign, value.h_just, value.v_just, value.rows, value.cols)
+		w.writeParts(value.rowParts, int(value.rows)+1)
+		w.writeParts(value.colParts, int(value.cols)+1)
+		return w.writeObjectList(ast)
+	case *MtSize:
+		switch {
+		case value.lsize == 101:
+			w.write(SIZE, value.lsize, value.dsize)
+		case value.lsize < 100 && value.dsize >= -128 && value.dsize < 128:
+			//dsize加上128偏移
+			w.write(SIZE, value.lsize, uint8(value.dsize+128))
+		default:
+			w.write(SIZE, uint8(100), value.lsize, value.dsize)
+		}
+		return nil
+	case *MtColorDefIndex:
+		w.write(COLOR, value.index)
+		return nil
+	case *MtColorDef:
+		options := value.options &^ (mtefCOLOR_CMYK | mtefCOLOR_NAME)
+		switch len(value.values) {
+		case 3:
+		case 4:
+			options |= mtefCOLOR_CMYK
+		default:
+			return fmt.Errorf("mtef: encode COLOR_DEF record: %d color values", len(value.values))
+		}
+		if value.name != "" {
+			options |= mtefCOLOR_NAME
+		}
+
+		w.write(COLOR_DEF, options, value.values)
+		if value.name != "" {
+			w.writeString(value.name)
+		}
+		return nil
+	case *MtfontStyleDef:
+		w.write(FONT_STYLE_DEF, value.fontDefIndex, value.style)
+		return nil
+	case *MtfontDef:
+		w.write(FONT_DEF, value.encDefIndex)
+		w.writeString(value.name)
+		return nil
+	case string:
+		w.write(ENCODING_DEF)
+		w.writeString(value)
+		return nil
+	case *MtEqnPrefs:
+		w.write(EQN_PREFS, value.options)
+		if err = w.writeDimensions(value.sizes); err != nil {
+			return err
+		}
+		if err = w.writeDimensions(value.spaces); err != nil {
+			return err
+		}
+
+		w.write(uint8(len(value.styles)))
+		for _, style := range value.styles {
+			w.write(style.fontDefIndex)
+			if style.fontDefIndex != 0 {
+				w.write(style.style)
+			}
+		}
+		return nil
+	case nil:
+		switch ast.tag {
+		case FULL, SUB, SUB2, SYM, SUBSYM:
+			w.write(ast.tag)
+			return nil
+		}
+	}
+	return fmt.Errorf("mtef: encode %v record: unexpected value %T", ast.tag, ast.value)
+}
+
+func nudgeOption(nudgeX int16, nudgeY int16) OptionType {
+	if nudgeX != 0 || nudgeY != 0 {
+		return MtefOptNudge
+	}
+	return 0
+}
+
+func (w *mtefWriter) writeNudge(nudgeX int16, nudgeY int16) {
+	/**
+	和readNudge相反，-128 < dx, dy < 128 的时候每个值加128偏移写1个字节，只有一个值为0时的128是合法的，
+	否则写2个128，后面跟着2个int16，2个字节都是128的(0, 0)不需要写
+	*/
+	switch {
+	case nudgeX == 0 && nudgeY == 0:
+	case nudgeX > -128 && nudgeX < 128 && nudgeY > -128 && nudgeY < 128:
+		w.write(uint8(nudgeX+128), uint8(nudgeY+128))
+	default:
+		w.write(uint8(128), uint8(128), nudgeX, nudgeY)
+	}
+}
+
+func (w *mtefWriter) writeRuler(ruler *MtRuler) {
+	if ruler == nil {
+		return
+	}
+
+	stops := ruler.TabStops()
+	w.write(RULER, uint8(len(stops)))
+	for _, stop := range stops {
+		w.write(stop.Type, stop.Offset)
+	}
+}
+
+func (w *mtefWriter) writeParts(parts []byte, count int) {
+	//每条分隔线2个bit，长度不够的时候补0
+	buffer := make([]byte, (2*count+7)/8)
+	copy(buffer, parts)
+	w.write(buffer)
+}
+
+func (w *mtefWriter) writeDimensions(dimensions []Dimension) error {
+	/**
+	和readDimensionArrays相反，每个值是单位、数字、小数点或负号的半字节，0x0f结束，
+	半字节连续排列，最后一个字节不满的时候低4位补0
+	*/
+	var nibbles []byte
+	for _, dimension := range dimensions {
+		if dimension.Unit > UnitPercent {
+			return fmt.Errorf("mtef: encode EQN_PREFS record: invalid dimension unit %d", dimension.Unit)
+		}
+
+		nibbles = append(nibbles, byte(dimension.Unit))
+		for _, c := range strconv.FormatFloat(dimension.Value, 'f', -1, 64) {
+			switch {
+			case c >= '0' && c <= '9':
+				nibbles = append(nibbles, byte(c-'0'))
+			case c == '.':
+				nibbles = append(nibbles, 0x0a)
+			case c == '-':
+				nibbles = append(nibbles, 0x0b)
+			}
+		}
+		nibbles = append(nibbles, 0x0f)
+	}
+	if len(nibbles)%2 != 0 {
+		nibbles = append(nibbles, 0)
+	}
+
+	w.write(uint8(len(dimensions)))
+	for i := 0; i < len(nibbles); i += 2 {
+		w.WriteByte(nibbles[i]<<4 | nibbles[i+1])
+	}
+	return nil
+}
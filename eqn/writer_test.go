@@ -0,0 +1,174 @@
+package eqn
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+//nudge的各种取值，包括只有一个值为0、1个字节放不下的情况
+var nudgeTests = [][2]int16{
+	{5, 3},
+	{5, 0},
+	{0, -7},
+	{127, -127},
+	{-128, 1},
+	{1, 128},
+	{1000, -1000},
+}
+
+//每种可以带nudge的record都设置同样的nudge：LINE、CHAR、EMBELL、TMPL、PILE、MATRIX
+func nudgedEquation(x, y int16) *MTEFv5 {
+	char := &MtAST{CHAR, &MtChar{nudgeX: x, nudgeY: y, typeface: 128 + 3, mtcode: 'x',
+		embellishments: &MtEmbell{nudgeX: x, nudgeY: y, embell: uint8(emb1DOT)}}, nil}
+	slot := func() *MtAST {
+		return &MtAST{LINE, &MtLine{nudgeX: x, nudgeY: y, size: FULL}, []*MtAST{
+			{CHAR, &MtChar{typeface: 128 + 3, mtcode: 'y'}, nil},
+		}}
+	}
+	fraction := &MtAST{TMPL, &MtTmpl{nudgeX: x, nudgeY: y, selector: uint8(tmFRACT)}, []*MtAST{slot(), slot()}}
+	pile := &MtAST{PILE, &MtPile{nudgeX: x, nudgeY: y}, []*MtAST{slot()}}
+	matrix := &MtAST{MATRIX, &MtMatrix{nudgeX: x, nudgeY: y, rows: 1, cols: 1}, []*MtAST{slot()}}
+	line := &MtAST{LINE, &MtLine{nudgeX: x, nudgeY: y, size: FULL}, []*MtAST{char, fraction, pile, matrix}}
+	return New(&Line{line})
+}
+
+//按遍历顺序列出所有nudge
+func collectNudges(m *MTEFv5) (nudges [][2]int16) {
+	Inspect(m.Root(), func(node Node) bool {
+		nudged, ok := node.(interface{ Nudge() (int16, int16) })
+		if ok {
+			x, y := nudged.Nudge()
+			nudges = append(nudges, [2]int16{x, y})
+		}
+		if char, ok := node.(*Char); ok {
+			for _, embell := range char.Embellishments() {
+				nudges = append(nudges, [2]int16{embell.NudgeX, embell.NudgeY})
+			}
+		}
+		return node != nil
+	})
+	return nudges
+}
+
+func TestNudgeRoundTrip(t *testing.T) {
+	for _, test := range nudgeTests {
+		t.Run(fmt.Sprint(test), func(t *testing.T) {
+			m := nudgedEquation(test[0], test[1])
+			data, err := m.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			eqn, err := OpenMTEF(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := collectNudges(eqn), collectNudges(m); !reflect.DeepEqual(got, want) {
+				t.Errorf("nudges = %v, want %v", got, want)
+			}
+
+			//再写一次和第一次完全一样
+			again, err := eqn.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Errorf("second MarshalBinary differs:\n%x\n%x", again, data)
+			}
+		})
+	}
+}
+
+func TestWriteNudge(t *testing.T) {
+	//只有一个值为0的时候也是2个字节，超出±127的时候才用4个字节的写法
+	tests := []struct {
+		x, y int16
+		data []byte
+	}{
+		{0, 0, nil},
+		{5, 3, []byte{133, 131}},
+		{-127, 127, []byte{1, 255}},
+		{5, 0, []byte{133, 128}},
+		{0, -7, []byte{128, 121}},
+		{-128, 1, []byte{128, 128, 0x80, 0xff, 1, 0}},
+		{0, 1000, []byte{128, 128, 0, 0, 0xe8, 0x03}},
+	}
+	for _, test := range tests {
+		w := &mtefWriter{}
+		w.writeNudge(test.x, test.y)
+		if !bytes.Equal(w.Bytes(), test.data) {
+			t.Errorf("writeNudge(%d, %d) = %v, want %v", test.x, test.y, w.Bytes(), test.data)
+		}
+	}
+}
+
+//header、默认的定义record和FULL，后面接公式的record
+func testPreamble(t *testing.T) []byte {
+	t.Helper()
+	data, err := New().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//去掉最后的END
+	return data[:len(data)-1]
+}
+
+func TestShortNudgeRoundTrip(t *testing.T) {
+	//只有一个方向的nudge用2个字节写的CHAR，读出来再写回去完全一样
+	for _, nudge := range [][]byte{{133, 128}, {128, 121}} {
+		data := append(testPreamble(t), 1, 0, 2, byte(MtefOptNudge), nudge[0], nudge[1], 128+3, 'x', 0, 0, 0)
+		eqn, err := OpenMTEF(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := eqn.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Errorf("nudge %v re-encoded as\n%x, want\n%x", nudge, encoded, data)
+		}
+	}
+}
+
+//LaTeX、MathML、OMML的输出，出错的时候是错误信息
+func translations(eqn *MTEFv5) (outputs [3]string) {
+	for i, translate := range []func() (string, error){eqn.Translate, eqn.TranslateMathML, eqn.TranslateOMML} {
+		output, err := translate()
+		if err != nil {
+			output = err.Error()
+		}
+		outputs[i] = output
+	}
+	return outputs
+}
+
+//MarshalBinary写出去再读回来，得到的公式一样，再写一次数据不变；MTEFv3、v4写成v5
+func TestWriteFixtures(t *testing.T) {
+	for _, file := range []string{"oleObject1.bin", "oleObject2.bin", "oleObject3.bin", "oleObject4.bin", "oleObject5.bin"} {
+		eqn := openFixture(t, file)
+		data, err := eqn.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		written, err := OpenMTEF(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		if version := written.Header().MtefVersion; version != 5 {
+			t.Errorf("%v: written MTEF version %d, want 5", file, version)
+		}
+
+		again, err := written.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+		if !bytes.Equal(again, data) {
+			t.Errorf("%v: MTEF data changed:\n%x\n%x", file, again, data)
+		}
+		if got, want := translations(written), translations(eqn); got != want {
+			t.Errorf("%v: written equation translates to %q, want %q", file, got, want)
+		}
+	}
+}
@@ -4,5 +4,7 @@ go 1.13
 
 require (
 	github.com/extrame/ole2 v0.0.0-20160812065207-d69429661ad7
+	github.com/richardlehane/mscfb v1.0.9
 	github.com/urfave/cli v1.22.1
+	golang.org/x/text v0.3.8
 )
@@ -1,17 +1,20 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/urfave/cli"
 	"github.com/zhexiao/mtef-go/docx"
 	"github.com/zhexiao/mtef-go/eqn"
+	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"time"
 )
 
 func main() {
-	var filepath, docxDocument string
+	var filepath, docxDocument, format string
 
 	app := cli.NewApp()
 	app.Name = "Mtef"
@@ -22,9 +25,15 @@ func main() {
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
 			Name:        "filepath, f",
-			Usage:       "Mathtype Ole object filepath",
+			Usage:       "Mathtype Ole object filepath, WMF/EMF preview (.wmf/.emf) or MathType image (.gif/.png/.eps/.svg)",
 			Destination: &filepath,
 		},
+		cli.StringFlag{
+			Name:        "format",
+			Value:       "latex",
+			Usage:       "Output format of --filepath: latex, mathml or omml",
+			Destination: &format,
+		},
 		cli.StringFlag{
 			Name:        "wordDocx, w",
 			Usage:       "Office word docx documents",
@@ -32,6 +41,33 @@ func main() {
 		},
 	}
 
+	app.Commands = []cli.Command{
+		{
+			Name:      "dump",
+			Usage:     "Print the equation tree of a Mathtype Ole object, preview or image",
+			ArgsUsage: "<filepath>",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the tree as JSON",
+				},
+			},
+			Action: dump,
+		},
+		{
+			Name:      "ole",
+			Usage:     "Write a Mathtype Ole object from a LaTeX equation (.tex), MathML (.mml), JSON dump or another Mathtype file",
+			ArgsUsage: "<filepath> <output>",
+			Action:    ole,
+		},
+		{
+			Name:      "verify",
+			Usage:     "Check that Mathtype files are written back byte for byte, directories are checked file by file",
+			ArgsUsage: "<filepath>...",
+			Action:    verify,
+		},
+	}
+
 	app.Action = func(c *cli.Context) error {
 		if filepath != "" {
 			if _, err := os.Stat(filepath); os.IsNotExist(err) {
@@ -40,8 +76,11 @@ func main() {
 			}
 
 			//转换数据
-			latex := eqn.Convert(filepath)
-			fmt.Println(latex)
+			output, err := convert(filepath, format)
+			if err != nil {
+				return cli.NewExitError(err.Error(), 1)
+			}
+			fmt.Println(output)
 			return nil
 		}
 
@@ -56,8 +95,17 @@ func main() {
 				Target:   fmt.Sprintf("/tmp/%v", time.Now().UnixNano()),
 			}
 
-			//转换数据
-			err := dw.ParseDocx()
+			//转换数据，转换失败的公式打印出来，不影响其他公式
+			latexes, err := dw.ParseDocx()
+			for _, latex := range latexes {
+				fmt.Println(latex)
+			}
+			if errs, ok := err.(docx.Errors); ok {
+				for _, fileErr := range errs {
+					log.Println(fileErr)
+				}
+				return cli.NewExitError(fmt.Sprintf("%d equations failed", len(errs)), 1)
+			}
 			if err != nil {
 				return err
 			}
@@ -80,3 +128,154 @@ func main() {
 	//	fmt.Println("num:", i, "latex:", latex)
 	//}
 }
+
+//按format转换公式，默认是LaTeX
+func convert(filepath string, format string) (string, error) {
+	if format == "latex" {
+		return eqn.Convert(filepath)
+	}
+
+	mtef, err := eqn.OpenFile(filepath)
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case "mathml":
+		return mtef.TranslateMathML()
+	case "omml":
+		return mtef.TranslateOMML()
+	}
+	return "", fmt.Errorf("unknown format %q", format)
+}
+
+func dump(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.NewExitError("dump needs one filepath", 1)
+	}
+
+	mtef, err := eqn.OpenFile(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	if c.Bool("json") {
+		data, err := json.MarshalIndent(mtef, "", "  ")
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	//每行一个节点，按层级缩进
+	depth := -1
+	eqn.Inspect(mtef.Root(), func(node eqn.Node) bool {
+		if node == nil {
+			depth--
+			return false
+		}
+
+		depth++
+		if depth > 0 {
+			fmt.Printf("%v%v\n", strings.Repeat("  ", depth-1), describe(node))
+		}
+		return true
+	})
+	return nil
+}
+
+func ole(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return cli.NewExitError("ole needs an input filepath and an output filepath", 1)
+	}
+
+	mtef, err := eqn.OpenFile(c.Args().Get(0))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+
+	data, err := mtef.MarshalOLE()
+	if err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	if err = ioutil.WriteFile(c.Args().Get(1), data, 0644); err != nil {
+		return cli.NewExitError(err.Error(), 1)
+	}
+	return nil
+}
+
+func verify(c *cli.Context) error {
+	if c.NArg() == 0 {
+		return cli.NewExitError("verify needs at least one filepath", 1)
+	}
+
+	var files []string
+	for _, arg := range c.Args() {
+		infos, err := ioutil.ReadDir(arg)
+		if err != nil {
+			//不是目录的直接检查
+			files = append(files, arg)
+			continue
+		}
+		for _, info := range infos {
+			if !info.IsDir() {
+				files = append(files, fmt.Sprintf("%v/%v", strings.TrimSuffix(arg, "/"), info.Name()))
+			}
+		}
+	}
+
+	failed := 0
+	for _, file := range files {
+		v, err := eqn.VerifyFile(file)
+		if err != nil {
+			failed++
+			fmt.Printf("%v: %v\n", file, err)
+			continue
+		}
+
+		padding := ""
+		if v.Padding > 0 {
+			padding = fmt.Sprintf(" (%v bytes of padding after the payload ignored)", v.Padding)
+		}
+		if v.Equal {
+			fmt.Printf("%v: ok, %v bytes%v\n", file, len(v.Encoded), padding)
+			continue
+		}
+
+		//MTEFv3/v4写回去是MTEFv5，只列出差异
+		if v.Version == 5 {
+			failed++
+		} else {
+			padding += fmt.Sprintf(" (MTEF v%v written as v5)", v.Version)
+		}
+		fmt.Printf("%v: %v bytes, re-encoded %v bytes, %v records differ%v\n", file, len(v.Original), len(v.Encoded), len(v.Diffs), padding)
+		for _, diff := range v.Diffs {
+			fmt.Printf("  original %v\n  encoded  %v\n", describeSpan(diff.Original), describeSpan(diff.Encoded))
+		}
+	}
+
+	if failed > 0 {
+		return cli.NewExitError(fmt.Sprintf("%v of %v files differ", failed, len(files)), 1)
+	}
+	return nil
+}
+
+func describeSpan(span *eqn.RecordSpan) string {
+	if span == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%#06x %-8v % x", span.Offset, span.Record, span.Data)
+}
+
+func describe(node eqn.Node) string {
+	switch n := node.(type) {
+	case *eqn.Char:
+		return fmt.Sprintf("CHAR %q typeface=%v", n.Rune(), n.Typeface())
+	case *eqn.Template:
+		return fmt.Sprintf("TMPL %v variation=%#x", n.Selector(), uint16(n.Variation()))
+	case *eqn.Matrix:
+		return fmt.Sprintf("MATRIX %vx%v", n.Rows(), n.Cols())
+	}
+	return node.Record().String()
+}